@@ -13,19 +13,22 @@ import (
 func TestDirtyWrite(t *testing.T, db Database) {
 	exec := NewTxnsExecutor(db)
 
-	// Initial state: both positions empty (value 0)
-	// Key 1 = first_place, Key 2 = second_place
+	// Keys name the podium positions and values the racers; both positions start empty (value 0)
+	const (
+		firstPlace, secondPlace = 1, 2
+		racer1, racer2          = 100, 200
+	)
 
 	// Transaction 1: Put racer1 in first, racer2 in second
 	txn1 := exec.NewTxn("txn1")
 	txn1.BeginTx()
-	txn1.Set(1, 100) // first_place = racer1 (represented by 100)
+	txn1.Set(firstPlace, racer1)
 	txn1.Barrier("txn1_wrote_first")
 	// Use timeout-based wait: if T2's writes complete (no locking), we continue immediately.
 	// If T2 is blocked on row lock (depending on implementation), we timeout and continue.
 	txn1.WaitForWithTimeout("txn2_wrote_second", 1000*time.Millisecond)
 	txn1.PrintDbState()
-	txn1.Set(2, 200) // second_place = racer2 (dirty write over T2 in read-uncommitted!)
+	txn1.Set(secondPlace, racer2) // dirty write over T2 in read-uncommitted!
 	txn1.Commit()
 	txn1.Barrier("txn1_committed")
 
@@ -34,8 +37,8 @@ func TestDirtyWrite(t *testing.T, db Database) {
 	txn2.BeginTx()
 	txn2.WaitFor("txn1_wrote_first") // Wait for T1's first write
 	txn2.PrintDbState()
-	txn2.Set(1, 200) // first_place = racer2
-	txn2.Set(2, 100) // second_place = racer1
+	txn2.Set(firstPlace, racer2)
+	txn2.Set(secondPlace, racer1)
 	txn2.Barrier("txn2_wrote_second")
 	txn2.WaitFor("txn1_committed")
 	txn2.Commit()
@@ -46,8 +49,8 @@ func TestDirtyWrite(t *testing.T, db Database) {
 	txn3.BeginTx()
 	txn3.WaitFor("txn2_committed")
 	txn3.WaitFor("txn1_committed")
-	first := txn3.Get(1)
-	second := txn3.Get(2)
+	first := txn3.Get(firstPlace)
+	second := txn3.Get(secondPlace)
 	txn3.Commit()
 
 	results := exec.Execute(true)
@@ -55,7 +58,24 @@ func TestDirtyWrite(t *testing.T, db Database) {
 	firstValue := results.GetValue(first)
 	secondValue := results.GetValue(second)
 
-	// If dirty writes are prevented: should be either (100,200) or (200,100)
-	// If dirty writes occur: might be (100,100) or (200,200) - INCONSISTENT!
+	// If dirty writes are prevented: should be either (racer1, racer2) or (racer2, racer1)
+	// If dirty writes occur: might be (racer1, racer1) or (racer2, racer2) - INCONSISTENT!
 	assert.NotEqual(t, firstValue, secondValue, "Both values should be different. firstValue: %d, secondValue: %d", firstValue, secondValue)
 }
+
+// TestDirtyWrite_G0 runs the Write Cycles (G0) case from the hermitage documentation.
+// In a database with write locks, T2's first update blocks until T1 commits, so the writes
+// of the two transactions cannot interleave and the final state is T2's values for both keys.
+// A database without write locks fails, because T2's update overwrites T1's uncommitted one at once.
+// https://github.com/ept/hermitage/blob/master/postgres.md#read-committed-basic-requirements-g0-g1a-g1b-g1c
+func TestDirtyWrite_G0(t *testing.T, db Database) {
+	exec, update := hermitageG0(db)
+	results := exec.Execute(true)
+
+	assert.True(t, update.blocked(results), "T2's update of key 1 should block until T1 commits")
+	assert.Equal(t, OutcomeCommitted, results.Outcome("T1"))
+	assert.Equal(t, OutcomeCommitted, results.Outcome("T2"))
+	finalReads := exec.Reads("check")
+	assert.Equal(t, 12, results.GetValue(finalReads[0]), "Final key 1 should be T2's 12")
+	assert.Equal(t, 22, results.GetValue(finalReads[1]), "Final key 2 should be T2's 22")
+}
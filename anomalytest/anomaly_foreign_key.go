@@ -0,0 +1,70 @@
+package anomalytest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestForeignKeyViolation tests that a foreign key holds when one transaction deletes the parent while
+// another concurrently inserts a child referencing it.
+//
+// Setup: key 2 references key 1, key 1 = 10
+//
+// The test simulates:
+//
+//	T1: begin
+//	T2: begin
+//	T1: delete key 1
+//	T2: insert key 2 = 20
+//	T1: commit
+//	T2: commit -- must fail: key 2 would reference the deleted key 1
+//
+// Each transaction is fine on its own, so only a database that checks the constraint against the state
+// its commit leaves, rather than against what the transaction saw, prevents the violation. Serializable
+// isolation does; weaker levels may let both commit. Skipped for databases without CapForeignKey.
+func TestForeignKeyViolation(t *testing.T, db Database) {
+	RequireCapabilities(t, db, CapForeignKey)
+	db.(ForeignKeyDatabase).AddForeignKey(2, 1)
+	exec := NewTxnsExecutor(db)
+
+	setup := exec.NewTxn("setup")
+	setup.BeginTx()
+	setup.Set(1, 10)
+	setup.Commit()
+	setup.Barrier("setup_done")
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.WaitFor("setup_done")
+	txn1.BeginTx()
+	txn1.Delete(1)
+	txn1.Barrier("txn1_deleted")
+	txn1.WaitFor("txn2_inserted")
+	txn1.Commit()
+	txn1.Barrier("txn1_done")
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("setup_done")
+	txn2.BeginTx()
+	txn2.WaitFor("txn1_deleted")
+	txn2.Set(2, 20)
+	txn2.Barrier("txn2_inserted")
+	txn2.WaitFor("txn1_done")
+	txn2.Commit()
+	txn2.Barrier("txn2_done")
+
+	txn3 := exec.NewTxn("txn3")
+	txn3.WaitFor("txn2_done")
+	txn3.BeginTx()
+	parent := txn3.Get(1)
+	child := txn3.Get(2)
+	txn3.Commit()
+
+	results := exec.Execute(true)
+
+	// A missing key reads as 0
+	if results.GetValue(child) != 0 {
+		assert.NotZero(t, results.GetValue(parent), "key 2 was committed but the key 1 it references was deleted")
+	}
+	assert.NotEqual(t, OutcomeCommitted, results.Outcome("txn2"), "txn2's commit would leave key 2 referencing nothing")
+}
@@ -1,6 +1,7 @@
 package anomalytest
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -70,3 +71,129 @@ func TestLostUpdateIncrement(t *testing.T, db Database) {
 	// If proper isolation: final value = 2 (both increments applied)
 	assert.Equal(t, 2, finalValue, "Final value should be 2 (both increments applied), but got %d (lost update!)", finalValue)
 }
+
+// TestLostUpdateAtomicIncrement runs the same two concurrent increments as TestLostUpdateIncrement, but
+// with a single Increment operation instead of a read followed by a write. There is no read to go
+// stale, so no increment should be lost. Skipped for databases without CapIncrement.
+func TestLostUpdateAtomicIncrement(t *testing.T, db Database) {
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Barrier("txn1_began")
+	txn1.WaitFor("txn2_began")
+	txn1.Increment(1, 1)
+	txn1.Commit()
+	txn1.Barrier("txn1_committed")
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.BeginTx()
+	txn2.Barrier("txn2_began")
+	txn2.WaitFor("txn1_began")
+	txn2.Increment(1, 1)
+	txn2.Commit()
+	txn2.Barrier("txn2_committed")
+
+	txn3 := exec.NewTxn("txn3")
+	txn3.WaitFor("txn1_committed")
+	txn3.WaitFor("txn2_committed")
+	txn3.BeginTx()
+	finalRead := txn3.Get(1)
+	txn3.Commit()
+
+	RequireScheduleCapabilities(t, exec)
+	results := exec.Execute(true)
+
+	finalValue := results.GetValue(finalRead)
+	assert.Equal(t, 2, finalValue, "Final value should be 2 (both increments applied), but got %d (lost update!)", finalValue)
+}
+
+// TestLostUpdateCompareAndSwap runs the two concurrent read-increment-write transactions of
+// TestLostUpdateIncrement, T1 adding 10 and T2 adding 1, but T1 writes with a compare-and-swap: just
+// before writing it reads the counter again and only writes if the value has not changed since its first
+// read. T2 commits in between, so T1's first attempt finds a changed value and writes nothing, and T1
+// retries from a fresh read. On a database where T1 sees T2's committed write, both increments land.
+func TestLostUpdateCompareAndSwap(t *testing.T, db Database) {
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	read1 := txn1.Get(1)
+	txn1.Barrier("txn1_read")
+	txn1.WaitFor("txn2_committed")
+	check1 := txn1.Get(1)
+	swapped := func() bool { return exec.resultStore.GetValue(check1) == exec.resultStore.GetValue(read1) }
+	txn1.SetIf(1, func() int { return exec.resultStore.GetValue(read1) + 10 }, swapped)
+	// Retry once if the swap failed
+	retryRead := txn1.Get(1)
+	retryCheck := txn1.Get(1)
+	txn1.SetIf(1, func() int { return exec.resultStore.GetValue(retryRead) + 10 }, func() bool {
+		return !swapped() && exec.resultStore.GetValue(retryCheck) == exec.resultStore.GetValue(retryRead)
+	})
+	txn1.Commit()
+	txn1.Barrier("txn1_committed")
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_read")
+	txn2.BeginTx()
+	read2 := txn2.Get(1)
+	txn2.SetComputed(1, func() int { return exec.resultStore.GetValue(read2) + 1 })
+	txn2.Commit()
+	txn2.Barrier("txn2_committed")
+
+	txn3 := exec.NewTxn("txn3")
+	txn3.WaitFor("txn1_committed")
+	txn3.BeginTx()
+	finalRead := txn3.Get(1)
+	txn3.Commit()
+
+	results := exec.Execute(true)
+
+	assert.Empty(t, results.Errors())
+	assert.Equal(t, 1, results.GetValue(check1), "T1's check should see T2's committed increment")
+	finalValue := results.GetValue(finalRead)
+	assert.Equal(t, 11, finalValue, "Final value should be 11 (both increments applied), but got %d (lost update!)", finalValue)
+}
+
+// lostUpdateRacers is the number of concurrent read-increment-write transactions in DetectLostUpdate
+const lostUpdateRacers = 4
+
+// DetectLostUpdate runs a read-increment-write race between concurrent transactions, with no barriers
+// forcing an interleaving, runs times against a fresh database each time. It reports whether any run
+// lost an update, i.e. ended with a value lower than the number of increments that succeeded.
+// Unlike TestLostUpdateIncrement it is not deterministic: a false result is evidence, not proof.
+func DetectLostUpdate(factory func() Database, runs int) bool {
+	var finalRead *GetResult
+	build := func(db Database) *TxnsExecutor {
+		exec := NewTxnsExecutor(db)
+		check := exec.NewTxn("check")
+		for i := 0; i < lostUpdateRacers; i++ {
+			txn := exec.NewTxn(fmt.Sprintf("racer%d", i))
+			txn.BeginTx()
+			read := txn.Get(1)
+			txn.SetComputed(1, func() int {
+				return exec.resultStore.GetValue(read) + 1
+			})
+			txn.Commit()
+			txn.Barrier(fmt.Sprintf("racer%d_done", i))
+			check.WaitFor(fmt.Sprintf("racer%d_done", i))
+		}
+		check.BeginTx()
+		finalRead = check.Get(1)
+		check.Commit()
+		return exec
+	}
+
+	for _, results := range ExecuteN(factory, build, runs, false) {
+		succeeded := 0
+		for i := 0; i < lostUpdateRacers; i++ {
+			if !results.Failed(fmt.Sprintf("racer%d", i)) {
+				succeeded++
+			}
+		}
+		if results.GetValue(finalRead) < succeeded {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package anomalytest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestNonRepeatableRead tests that a transaction reading the same key twice gets the same value both times,
+// even if another transaction updates the key and commits in between (a fuzzy read, P2).
+//
+// Setup: key 1 = 10, key 2 = 20
+//
+//	T1: begin
+//	T2: begin
+//	T1: select key 1 -- 10
+//	T2: update key 1 = 11, BLOCKS in a database that holds read locks until commit
+//	T2: commit
+//	T1: select key 1 -- must still read 10
+//	T1: commit
+//
+// Read locks held until commit and snapshot reads both prevent it; read uncommitted and read committed allow it.
+func TestNonRepeatableRead(t *testing.T, db Database) {
+	s := newHermitageSchedule(db)
+	t1 := s.exec.NewTxn("T1")
+	t2 := s.exec.NewTxn("T2")
+
+	var first, second *GetResult
+	s.step(t1, func() { t1.BeginTx() })
+	s.step(t2, func() { t2.BeginTx() })
+	s.step(t1, func() { first = t1.Get(1) })
+	s.blockingStep(t2, func() { t2.Set(1, 11) })
+	s.blockingStep(t2, func() { t2.Commit() })
+	s.step(t1, func() { second = t1.Get(1) })
+	s.step(t1, func() { t1.Commit() })
+
+	results := s.exec.Execute(true)
+
+	assert.Equal(t, 10, results.GetValue(first))
+	assert.Equal(t, results.GetValue(first), results.GetValue(second),
+		"T1 read key 1 twice and got %d, then %d (non-repeatable read!)", results.GetValue(first), results.GetValue(second))
+}
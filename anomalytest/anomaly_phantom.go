@@ -0,0 +1,66 @@
+package anomalytest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPhantomRead_G2 tests that phantoms are prevented: a transaction that runs the same predicate query
+// twice must get the same answer, even if another transaction inserts a matching row in between.
+// The predicate is "keys 1 to 10 with a value above 10", read with Scan. Skipped for databases without CapScan.
+//
+// Setup: key 1 = 10, key 2 = 20
+//
+//	T1: begin
+//	T2: begin
+//	T1: count keys 1 to 10 with value > 10 -- 1
+//	T2: insert key 3 = 30, BLOCKS in a database that locks the range
+//	T2: commit
+//	T1: count keys 1 to 10 with value > 10 -- still 1, the new key 3 is a phantom
+//	T1: commit
+func TestPhantomRead_G2(t *testing.T, db Database) {
+	exec, first, second := phantomReadSchedule(db)
+	RequireScheduleCapabilities(t, exec)
+	results := exec.Execute(true)
+
+	assert.Equal(t, 1, countAbove10(results.Rows(first)))
+	assert.Equal(t, countAbove10(results.Rows(first)), countAbove10(results.Rows(second)),
+		"T1's second query saw T2's insert: %v then %v", results.Rows(first), results.Rows(second))
+}
+
+// DetectPhantom runs the schedule of TestPhantomRead_G2 against db and reports whether T1's second query saw
+// T2's insert, so that a test can check for phantoms either way, e.g. with a database's phantom protection
+// on and off. db must have CapScan.
+func DetectPhantom(db Database) bool {
+	exec, first, second := phantomReadSchedule(db)
+	results := exec.Execute(false)
+	return countAbove10(results.Rows(first)) != countAbove10(results.Rows(second))
+}
+
+// phantomReadSchedule builds the schedule of TestPhantomRead_G2 and returns T1's two queries
+func phantomReadSchedule(db Database) (exec *TxnsExecutor, first, second *ScanResult) {
+	s := newHermitageSchedule(db)
+	t1 := s.exec.NewTxn("T1")
+	t2 := s.exec.NewTxn("T2")
+
+	s.step(t1, func() { t1.BeginTx() })
+	s.step(t2, func() { t2.BeginTx() })
+	s.step(t1, func() { first = t1.Scan(1, 10) })
+	s.blockingStep(t2, func() { t2.Set(3, 30) })
+	s.blockingStep(t2, func() { t2.Commit() })
+	s.step(t1, func() { second = t1.Scan(1, 10) })
+	s.step(t1, func() { t1.Commit() })
+	return s.exec, first, second
+}
+
+// countAbove10 counts the rows of a query with a value above 10, the predicate of TestPhantomRead_G2
+func countAbove10(rows map[int]int) int {
+	count := 0
+	for _, value := range rows {
+		if value > 10 {
+			count++
+		}
+	}
+	return count
+}
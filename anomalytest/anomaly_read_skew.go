@@ -0,0 +1,113 @@
+package anomalytest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// transferSetup schedules a setup transaction that commits key 1 = 50 and key 2 = 50, a total of 100 that
+// a transfer of 10 from key 1 to key 2 conserves, and signals "setup_done"
+func transferSetup(exec *TxnsExecutor) {
+	setup := exec.NewTxn("setup")
+	setup.BeginTx()
+	setup.Set(1, 50)
+	setup.Set(2, 50)
+	setup.Commit()
+	setup.Barrier("setup_done")
+}
+
+// TestReadSkew tests that a transaction reading two keys one at a time does not see one of them from before
+// a concurrent transfer between them and the other from after it.
+//
+// Setup: key 1 = 50, key 2 = 50
+//
+// The test simulates:
+//
+//	T1: begin
+//	T1: select key 1 -- 50
+//	T2: begin
+//	T2: update key 1 = 40
+//	T2: update key 2 = 60
+//	T2: commit
+//	T1: select key 2 -- must read 50, or the two reads add up to 110
+//	T1: select sum of keys 1 and 2 -- must read 100
+//	T1: commit
+//
+// T2 may block on T1 until it commits. Repeatable read and stronger levels prevent read skew; read
+// committed allows it. Skipped for databases without CapAggregate.
+func TestReadSkew(t *testing.T, db Database) {
+	exec := NewTxnsExecutor(db)
+	transferSetup(exec)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.WaitFor("setup_done")
+	txn1.BeginTx()
+	first := txn1.Get(1)
+	txn1.Barrier("txn1_read_first")
+	txn1.WaitForWithTimeout("txn2_committed", hermitageBlockTimeout)
+	second := txn1.Get(2)
+	total := txn1.Sum(1, 2)
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_read_first")
+	txn2.BeginTx()
+	txn2.Set(1, 40)
+	txn2.Set(2, 60)
+	txn2.Commit()
+	txn2.Barrier("txn2_committed")
+
+	RequireScheduleCapabilities(t, exec)
+	results := exec.Execute(true)
+
+	assert.Equal(t, 100, results.GetValue(first)+results.GetValue(second), "T1's reads straddle T2's transfer (read skew)")
+	assert.Equal(t, 100, results.GetValue(total))
+}
+
+// TestConservedSum tests that a sum computed by the database never sees a transfer half done.
+//
+// Setup: key 1 = 50, key 2 = 50
+//
+// The test simulates:
+//
+//	T1: begin
+//	T1: update key 1 = 40
+//	T2: begin
+//	T2: select sum of keys 1 and 2 -- must read 100, not the torn 90
+//	T1: update key 2 = 60
+//	T1: commit
+//	T2: select sum of keys 1 and 2 -- must read 100
+//	T2: commit
+//
+// T2's first sum may block on T1 until it commits. Read committed and stronger levels prevent the torn
+// read. Skipped for databases without CapAggregate.
+func TestConservedSum(t *testing.T, db Database) {
+	exec := NewTxnsExecutor(db)
+	transferSetup(exec)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.WaitFor("setup_done")
+	txn1.BeginTx()
+	txn1.Set(1, 40)
+	txn1.Barrier("txn1_debited")
+	txn1.WaitForWithTimeout("txn2_summed", hermitageBlockTimeout)
+	txn1.Set(2, 60)
+	txn1.Commit()
+	txn1.Barrier("txn1_committed")
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_debited")
+	txn2.BeginTx()
+	during := txn2.Sum(1, 2)
+	txn2.Barrier("txn2_summed")
+	txn2.WaitFor("txn1_committed")
+	after := txn2.Sum(1, 2)
+	txn2.Commit()
+
+	RequireScheduleCapabilities(t, exec)
+	results := exec.Execute(true)
+
+	assert.Equal(t, 100, results.GetValue(during), "T2 summed T1's transfer half done")
+	assert.Equal(t, 100, results.GetValue(after))
+}
@@ -0,0 +1,45 @@
+package anomalytest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestReadYourOwnWrites tests that a transaction reads its own uncommitted write, while a concurrent
+// transaction does not see it until it commits.
+//
+// Setup: key 1 = 10, key 2 = 20
+//
+//	T1: begin
+//	T2: begin
+//	T1: update key 1 = 11
+//	T1: select key 1 -- 11, its own write
+//	T2: select key 1 -- 10, BLOCKS in a database that holds read locks until commit
+//	T1: commit
+//	T2: commit
+//
+// Every level passes the first read. Read uncommitted fails the second, because its writes are visible to
+// everyone as soon as they are made. A T2 that waited for T1's lock reads key 1 only after T1 has committed,
+// so any value it reads then is allowed.
+func TestReadYourOwnWrites(t *testing.T, db Database) {
+	s := newHermitageSchedule(db)
+	t1 := s.exec.NewTxn("T1")
+	t2 := s.exec.NewTxn("T2")
+
+	var own, other *GetResult
+	s.step(t1, func() { t1.BeginTx() })
+	s.step(t2, func() { t2.BeginTx() })
+	s.step(t1, func() { t1.Set(1, 11) })
+	s.step(t1, func() { own = t1.Get(1) })
+	s.blockingStep(t2, func() { other = t2.Get(1) })
+	s.step(t1, func() { t1.Commit() })
+	s.step(t2, func() { t2.Commit() })
+
+	results := s.exec.Execute(true)
+
+	assert.Equal(t, 11, results.GetValue(own), "T1 should read its own write")
+	if !results.DidBlock(other) {
+		assert.Equal(t, 10, results.GetValue(other), "T2 should not read T1's uncommitted 11")
+	}
+}
@@ -0,0 +1,93 @@
+package anomalytest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAntiDependencyCycles_G2Item tests that write skew (G2-item) is prevented: two transactions each read
+// keys 1 and 2 and then update a different one of them, so neither sees the other's write. At most one
+// of them may commit, leaving the keys as a serial execution would.
+// https://github.com/ept/hermitage/blob/master/postgres.md#write-skew-g2-item
+func TestAntiDependencyCycles_G2Item(t *testing.T, db Database) {
+	exec := HermitageG2Item(db)
+	results := exec.Execute(true)
+
+	final := exec.Reads("check")
+	bothCommitted := results.Outcome("T1") == OutcomeCommitted && results.Outcome("T2") == OutcomeCommitted
+	assert.False(t, bothCommitted, "T1 and T2 both committed writes based on reads the other invalidated")
+	assert.NotEqual(t, [2]int{11, 21}, [2]int{results.GetValue(final[0]), results.GetValue(final[1])},
+		"final state has both updates, which no serial order of T1 and T2 produces")
+}
+
+// Keys of the two doctors in OnCallDoctors; a value of 1 means on call, 0 off
+const (
+	aliceOnCall = 1
+	bobOnCall   = 2
+)
+
+// OnCallDoctors builds the classic write skew scenario. Alice and Bob are both on call, and the rule is
+// that at least one doctor must be. Each of them, feeling unwell, checks in their own transaction that two
+// doctors are on call and, seeing both, takes themselves off. Each only writes their own key, so neither
+// write conflicts with the other, but together they leave nobody on call.
+// Reads: "alice" and "bob" each read both keys, and "check" reads them after both transactions end.
+func OnCallDoctors(db Database) *TxnsExecutor {
+	exec := NewTxnsExecutor(db)
+
+	setup := exec.NewTxn("setup")
+	setup.BeginTx()
+	setup.Set(aliceOnCall, 1)
+	setup.Set(bobOnCall, 1)
+	setup.Commit()
+	setup.Barrier("setup_done")
+
+	for _, doctor := range []struct {
+		name, other string
+		key         int
+	}{{"alice", "bob", aliceOnCall}, {"bob", "alice", bobOnCall}} {
+		txn := exec.NewTxn(doctor.name)
+		txn.WaitFor("setup_done")
+		txn.BeginTx()
+		alice := txn.Get(aliceOnCall)
+		bob := txn.Get(bobOnCall)
+		txn.Barrier(doctor.name + "_checked")
+		txn.WaitFor(doctor.other + "_checked") // both check before either goes off call
+		txn.SetComputed(doctor.key, func() int {
+			if exec.resultStore.GetValue(alice)+exec.resultStore.GetValue(bob) >= 2 {
+				return 0 // someone else is on call
+			}
+			return 1
+		})
+		txn.Commit()
+		txn.Barrier(doctor.name + "_done")
+	}
+
+	check := exec.NewTxn("check")
+	check.WaitFor("alice_done")
+	check.WaitFor("bob_done")
+	check.BeginTx()
+	check.Get(aliceOnCall)
+	check.Get(bobOnCall)
+	check.Commit()
+	return exec
+}
+
+// TestWriteSkew runs OnCallDoctors and tests that write skew is prevented: at least one doctor is still on
+// call at the end, so at most one of the two transactions went through.
+//
+// Expected result by isolation level:
+//   - read uncommitted, read committed, snapshot isolation: both transactions commit and nobody is on call,
+//     since neither wrote a key the other wrote
+//   - serializable: one of the transactions is aborted, e.g. as a deadlock victim under two-phase locking,
+//     where each waits to write a key the other has read
+func TestWriteSkew(t *testing.T, db Database) {
+	exec := OnCallDoctors(db)
+	results := exec.Execute(true)
+
+	final := exec.Reads("check")
+	onCall := results.GetValue(final[0]) + results.GetValue(final[1])
+	bothCommitted := results.Outcome("alice") == OutcomeCommitted && results.Outcome("bob") == OutcomeCommitted
+	assert.False(t, bothCommitted, "alice and bob both went off call, each having seen the other on call")
+	assert.GreaterOrEqual(t, onCall, 1, "nobody is on call")
+}
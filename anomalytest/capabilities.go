@@ -0,0 +1,357 @@
+package anomalytest
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Capability is a bitmask of optional features a Database supports beyond the core Database interface
+type Capability uint
+
+const (
+	CapLocking    Capability = 1 << iota // row locks that can be inspected; see LockingDatabase
+	CapMVCC                              // multiple committed versions per key
+	CapScan                              // range reads; see ScanDatabase
+	CapIncrement                         // single-operation increments; see IncrementDatabase
+	CapSnapshot                          // full state visible to a transaction; see Snapshotter
+	CapIndex                             // lookups by value through a secondary index; see IndexedDatabase
+	CapForeignKey                        // referential constraints checked at commit; see ForeignKeyDatabase
+	CapAggregate                         // sums computed by the database as a single read; see SumDatabase
+	CapSavepoint                         // partial rollback to a named point in a transaction; see SavepointDatabase
+	CapWriteSet                          // write locks taken up front, in key order; see WriteSetDeclarer
+	CapBatch                             // several keys written as a single operation; see BatchDatabase
+)
+
+var capabilityNames = []struct {
+	cap  Capability
+	name string
+}{
+	{CapLocking, "locking"},
+	{CapMVCC, "mvcc"},
+	{CapScan, "scan"},
+	{CapIncrement, "increment"},
+	{CapSnapshot, "snapshot"},
+	{CapIndex, "index"},
+	{CapForeignKey, "foreign key"},
+	{CapAggregate, "aggregate"},
+	{CapSavepoint, "savepoint"},
+	{CapWriteSet, "write set"},
+	{CapBatch, "batch"},
+}
+
+// Has reports whether every capability in want is present in c
+func (c Capability) Has(want Capability) bool {
+	return c&want == want
+}
+
+func (c Capability) String() string {
+	if c == 0 {
+		return "none"
+	}
+	var names []string
+	for _, entry := range capabilityNames {
+		if c.Has(entry.cap) {
+			names = append(names, entry.name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// CapabilityReporter is implemented by databases that declare their capabilities explicitly
+type CapabilityReporter interface {
+	Capabilities() Capability
+}
+
+// CapabilitiesOf returns the capabilities of db. Databases that implement CapabilityReporter are taken
+// at their word; for any other database the capabilities are inferred from the optional interfaces it implements.
+func CapabilitiesOf(db Database) Capability {
+	if reporter, ok := db.(CapabilityReporter); ok {
+		return reporter.Capabilities()
+	}
+	var caps Capability
+	if _, ok := db.(LockingDatabase); ok {
+		caps |= CapLocking
+	}
+	if _, ok := db.(ScanDatabase); ok {
+		caps |= CapScan
+	}
+	if _, ok := db.(IncrementDatabase); ok {
+		caps |= CapIncrement
+	}
+	if _, ok := db.(Snapshotter); ok {
+		caps |= CapSnapshot
+	}
+	if _, ok := db.(IndexedDatabase); ok {
+		caps |= CapIndex
+	}
+	if _, ok := db.(ForeignKeyDatabase); ok {
+		caps |= CapForeignKey
+	}
+	if _, ok := db.(SumDatabase); ok {
+		caps |= CapAggregate
+	}
+	if _, ok := db.(SavepointDatabase); ok {
+		caps |= CapSavepoint
+	}
+	if _, ok := db.(WriteSetDeclarer); ok {
+		caps |= CapWriteSet
+	}
+	if _, ok := db.(BatchDatabase); ok {
+		caps |= CapBatch
+	}
+	return caps
+}
+
+// RequireCapabilities skips the calling test unless db supports every capability in want
+func RequireCapabilities(t testing.TB, db Database, want Capability) {
+	t.Helper()
+	if missing := want &^ CapabilitiesOf(db); missing != 0 {
+		t.Skipf("%T lacks %s, required by %s", db, missing, t.Name())
+	}
+}
+
+// RequireScheduleCapabilities skips the calling test unless the executor's databases support every
+// capability needed by the operations scheduled on them so far
+func RequireScheduleCapabilities(t testing.TB, exec *TxnsExecutor) {
+	t.Helper()
+	for dbName, want := range exec.RequiredCapabilities() {
+		exec.mu.Lock()
+		db := exec.dbs[dbName]
+		exec.mu.Unlock()
+		if db != nil {
+			RequireCapabilities(t, db, want)
+		}
+	}
+}
+
+// LockingDatabase is implemented by databases that protect rows with locks.
+//
+// Implementations guarantee that:
+//   - a write lock taken by Set or Delete is held until the transaction commits or rolls back
+//   - a transaction that needs a lock held by another transaction blocks until it is released
+//   - HoldsLock reflects the lock table at the moment it is called, without blocking
+//   - AcquireLock takes the same lock Set would, blocking the same way, but writes nothing
+//   - WriteLocked never blocks, and fails with ErrLockNotHeld unless the transaction holds the lock
+type LockingDatabase interface {
+	Database
+	HoldsLock(txId int64, key int) bool
+	AcquireLock(txId int64, key int) error
+	WriteLocked(txId int64, key int, value int) error
+}
+
+// WriteSetDeclarer is implemented by locking databases that can take a transaction's write locks up front.
+// DeclareWriteSet takes the exclusive row lock on each of keys in ascending key order, blocking while
+// another transaction holds one. Transactions that declare every key they write before writing any never
+// deadlock on write locks, since they all take the locks in the same order; the price is that a
+// transaction must know its writes before it starts, and holds every lock for its whole length.
+type WriteSetDeclarer interface {
+	DeclareWriteSet(txId int64, keys []int) error
+}
+
+// VersionStatus is the state of the transaction that wrote a version
+type VersionStatus int
+
+const (
+	VersionPending VersionStatus = iota
+	VersionCommitted
+	VersionAborted
+)
+
+func (s VersionStatus) String() string {
+	switch s {
+	case VersionCommitted:
+		return "committed"
+	case VersionAborted:
+		return "aborted"
+	default:
+		return "pending"
+	}
+}
+
+// VersionInfo describes one stored version of a key in an MVCC database.
+// A version is visible to snapshots taken at or after BeginTs and before EndTs; an EndTs of 0 means
+// the version has not been superseded. Aborted versions are never visible and are kept only for inspection.
+type VersionInfo struct {
+	TxId    int64
+	Value   int
+	Deleted bool // the version is a tombstone written by Delete
+	BeginTs int64
+	EndTs   int64
+	Status  VersionStatus
+}
+
+// VersionInspector is implemented by MVCC databases that can list every stored version of a key
+type VersionInspector interface {
+	VersionHistory(key int) []VersionInfo
+}
+
+// Historian is implemented by databases that keep every value committed to a key, to show how the key got
+// to its current value when debugging an anomaly. History returns the values oldest first; a delete is
+// not a value and is left out.
+type Historian interface {
+	History(key int) []int
+}
+
+// SnapshotReader is implemented by MVCC databases that can begin read-only transactions. BeginSnapshot pins
+// the transaction to the latest committed snapshot: every read it makes returns the value as of that
+// snapshot however many writers commit meanwhile, it never blocks or aborts a writer, and its writes fail
+// with ErrReadOnly.
+type SnapshotReader interface {
+	BeginSnapshot() (int64, error)
+}
+
+// ReadTimestamper is implemented by MVCC databases that give each transaction a snapshot when it begins.
+// ReadTimestamp returns the timestamp of txId's snapshot: it reads the writes of transactions that committed
+// at or before it. The timestamp is assigned by BeginTx or BeginSnapshot and does not change for the life of
+// the transaction.
+type ReadTimestamper interface {
+	ReadTimestamp(txId int64) (int64, bool)
+}
+
+// BatchDatabase is implemented by databases that can write several keys as a single operation. SetMany
+// applies every write in kv or, if it fails, none of them, and no other transaction sees some of the writes
+// without the others while it runs.
+type BatchDatabase interface {
+	Database
+	SetMany(txId int64, kv map[int]int) error
+}
+
+// IncrementDatabase is implemented by databases that can apply an increment to a key
+// as a single operation instead of a separate read and write
+type IncrementDatabase interface {
+	Database
+	Increment(txId int64, key int, delta int) error
+}
+
+// ScanDatabase is implemented by databases that can read every key in a range in one operation. Scan
+// returns the key-value pairs with lo <= key <= hi visible to the transaction; a key that does not exist is
+// left out rather than read as 0, so a scan can see keys appear and disappear.
+type ScanDatabase interface {
+	Scan(txId int64, lo, hi int) (map[int]int, error)
+}
+
+// SavepointDatabase is implemented by databases that can roll a transaction back part of the way. Savepoint
+// marks the transaction's current point under name, replacing any earlier savepoint of that name.
+// RollbackTo undoes every write made since the savepoint and forgets the savepoints set after it; the
+// savepoint itself stays, so the transaction can roll back to it again. A name with no savepoint fails with
+// ErrNoSavepoint. The transaction stays active either way.
+type SavepointDatabase interface {
+	Savepoint(txId int64, name string) error
+	RollbackTo(txId int64, name string) error
+}
+
+// SumDatabase is implemented by databases that can total several keys in one operation. Sum returns the sum
+// of the values of keys visible to the transaction, read from a single view of the data that no write can
+// change partway through, as a snapshot or a set of locks provides. A missing key counts as 0.
+type SumDatabase interface {
+	Sum(txId int64, keys []int) (int, error)
+}
+
+// IndexedDatabase is implemented by databases with a secondary index on values. GetByValue returns the keys
+// whose value is value, in ascending order, as visible to the transaction under the database's isolation
+// level, so an uncommitted or rolled back write must affect it exactly as it would affect Get.
+type IndexedDatabase interface {
+	Database
+	GetByValue(txId int64, value int) ([]int, error)
+}
+
+// ForeignKeyDatabase is implemented by databases that enforce referential constraints between keys.
+// AddForeignKey declares that childKey may only exist while parentKey exists. The constraint is checked
+// when a transaction that wrote or deleted either key commits, against the state the commit would leave;
+// a commit that would violate it fails with a ConstraintViolationError and the transaction is rolled back.
+type ForeignKeyDatabase interface {
+	AddForeignKey(childKey, parentKey int)
+}
+
+// Snapshotter is implemented by databases that can return every key-value pair visible to a transaction
+type Snapshotter interface {
+	Snapshot(txId int64) (map[int]int, error)
+}
+
+// StateInspector is implemented by databases that can return their current contents outside of any transaction
+type StateInspector interface {
+	State() map[int]int
+}
+
+// StateDumper is implemented by databases that can save their committed contents and restore them later,
+// to set up fixtures without a setup transaction or to capture the state of a failing run.
+// Both methods fail while any transaction is active.
+type StateDumper interface {
+	DumpState() ([]byte, error)
+	LoadState(dump []byte) error
+}
+
+// Resetter is implemented by databases that can discard all data and transactions and restart their
+// transaction ids at 1, so that one database can serve several runs of a schedule
+type Resetter interface {
+	Reset()
+}
+
+// ActivityInspector is implemented by databases that can list the transactions that have begun
+// but not yet committed or rolled back
+type ActivityInspector interface {
+	ActiveTxns() []int64
+}
+
+// WriterInspector is implemented by databases that can tell which active transaction wrote the uncommitted
+// value of a key, the primitive for spotting dirty reads and write-read dependencies. ModifiedBy returns the
+// last transaction that wrote or deleted key and has not yet committed or rolled back; ok is false once the
+// key's value is committed.
+type WriterInspector interface {
+	ModifiedBy(key int) (txId int64, ok bool)
+}
+
+// LockWaitInspector is implemented by locking databases that can list the transactions currently
+// blocked waiting for a row lock, mapped to the key each one is waiting for
+type LockWaitInspector interface {
+	LockWaiters() map[int64]int
+}
+
+// LockObserver receives the row lock waits of a LockObservable database as they happen: OnLockWait when a
+// transaction's request starts waiting for a lock another transaction holds, and OnLockAcquired when that
+// request is granted. Requests that are granted without waiting are not reported. The calls are made while
+// the database holds its internal locks, so an observer must not call back into the database.
+type LockObserver interface {
+	OnLockWait(txId int64, key int)
+	OnLockAcquired(txId int64, key int)
+}
+
+// LockObservable is implemented by locking databases that can report lock waits to a LockObserver.
+// A nil observer stops the reports.
+type LockObservable interface {
+	SetLockObserver(observer LockObserver)
+}
+
+// LockWaitCounter is implemented by locking databases that count, per transaction, how many times an
+// operation had to wait for a lock held by another transaction
+type LockWaitCounter interface {
+	LockWaitCount(txId int64) int
+}
+
+// UnblockInspector is implemented by locking databases that record which waiting transactions each
+// transaction's commit or rollback let through. UnblockedBy returns the transactions that were granted a
+// lock they were waiting for because txId released it.
+type UnblockInspector interface {
+	UnblockedBy(txId int64) []int64
+}
+
+// LockTiming is when a row lock was requested and when it was granted; the difference is the time spent
+// waiting for other transactions to release it
+type LockTiming struct {
+	Key       int
+	Requested time.Time
+	Granted   time.Time
+}
+
+// LockTimer is implemented by locking databases that record when each transaction's most recent lock
+// request was made and granted. A request for a lock the transaction already holds is not recorded.
+type LockTimer interface {
+	LastLockTiming(txId int64) (LockTiming, bool)
+}
+
+// VisibilityInspector is implemented by databases where a commit can take effect for other
+// transactions some time after Commit returns. It lists the committed transactions that are not visible yet.
+type VisibilityInspector interface {
+	PendingCommits() []int64
+}
@@ -0,0 +1,175 @@
+package anomalytest
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+// Shape of the random schedules CertifySerializable runs
+const (
+	certifyRuns        = 50
+	certifyTxns        = 3
+	certifyOpsPerTxn   = 3
+	certifyKeys        = 2
+	certifyWaitTimeout = 10 * time.Millisecond // bound on each random wait for another transaction's operation
+	certifyOpTimeout   = time.Second           // bound on each operation, so a deadlock aborts a transaction instead of hanging
+)
+
+// certifyOp is one read or write of a random certification schedule
+type certifyOp struct {
+	write   bool
+	key     int
+	value   int        // for writes, unique across the run so every read identifies the write it saw
+	read    *GetResult // for reads
+	opIndex int
+}
+
+// CertifySerializable runs a battery of random schedules against fresh databases from factory and fails the test
+// unless every run is serializable: some serial order of the transactions that committed must explain both
+// the value each of their reads returned and the final contents of the database. Transactions that the
+// database aborted, e.g. to prevent a non-serializable outcome, are left out. The schedules are random but
+// seeded, so a failure is reported with the run's seed and a Report of its history and can be reproduced.
+// It is meant as a gate for databases that claim to be serializable.
+func CertifySerializable(t *testing.T, factory func() Database) {
+	t.Helper()
+	for run := 0; run < certifyRuns; run++ {
+		if failure := certifyRun(factory(), uint64(run)); failure != "" {
+			t.Fatalf("run %d: %s", run, failure)
+		}
+	}
+}
+
+// certifyRun runs one random schedule generated from seed and returns why its history is not serializable,
+// or "" if it is
+func certifyRun(db Database, seed uint64) string {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	exec := NewTxnsExecutor(db)
+
+	setup := exec.NewTxn("setup")
+	setup.BeginTx()
+	for key := 1; key <= certifyKeys; key++ {
+		setup.Set(key, key)
+	}
+	setup.Commit()
+	setup.Barrier("setup_committed")
+
+	check := exec.NewTxn("check")
+	names := make([]string, certifyTxns)
+	plans := make(map[string][]certifyOp, certifyTxns)
+	for i := range names {
+		names[i] = fmt.Sprintf("T%d", i+1)
+	}
+	for i, name := range names {
+		txn := exec.NewTxn(name)
+		txn.SetTimeout(certifyOpTimeout)
+		txn.WaitFor("setup_committed")
+		txn.BeginTx()
+		for j := 0; j < certifyOpsPerTxn; j++ {
+			if rng.IntN(2) == 0 {
+				other := names[(i+1+rng.IntN(certifyTxns-1))%certifyTxns]
+				txn.WaitForWithTimeout(fmt.Sprintf("%s_op%d", other, rng.IntN(certifyOpsPerTxn)), certifyWaitTimeout)
+			}
+			op := certifyOp{write: rng.IntN(2) == 0, key: 1 + rng.IntN(certifyKeys), opIndex: txn.opCounter}
+			if op.write {
+				op.value = 100*(i+1) + j + 1
+				txn.Set(op.key, op.value)
+			} else {
+				op.read = txn.Get(op.key)
+			}
+			plans[name] = append(plans[name], op)
+			txn.Barrier(fmt.Sprintf("%s_op%d", name, j))
+		}
+		txn.Commit()
+		txn.Barrier(name + "_done")
+		check.WaitFor(name + "_done")
+	}
+	check.BeginTx()
+	for key := 1; key <= certifyKeys; key++ {
+		check.Get(key)
+	}
+	check.Commit()
+
+	results := exec.Execute(false)
+
+	failed := make(map[string]map[int]bool) // txn name -> indexes of operations that returned an error
+	for _, opErr := range results.Errors() {
+		if failed[opErr.TxnName] == nil {
+			failed[opErr.TxnName] = make(map[int]bool)
+		}
+		failed[opErr.TxnName][opErr.OpIndex] = true
+	}
+	var committed []string
+	for _, name := range names {
+		if results.Outcome(name) == OutcomeCommitted {
+			committed = append(committed, name)
+		}
+	}
+	final := make(map[int]int, certifyKeys)
+	for i, read := range exec.Reads("check") {
+		final[i+1] = results.GetValue(read)
+	}
+
+	explains := func(order []string) bool {
+		state := make(map[int]int, certifyKeys)
+		for key := 1; key <= certifyKeys; key++ {
+			state[key] = key
+		}
+		for _, name := range order {
+			for _, op := range plans[name] {
+				switch {
+				case failed[name][op.opIndex]:
+				case op.write:
+					state[op.key] = op.value
+				case results.GetValue(op.read) != state[op.key]:
+					return false
+				}
+			}
+		}
+		for key, value := range final {
+			if state[key] != value {
+				return false
+			}
+		}
+		return true
+	}
+	if anyPermutation(committed, explains) {
+		return ""
+	}
+
+	var report bytes.Buffer
+	if err := results.Report(&report); err != nil {
+		fmt.Fprintf(&report, "writing report: %v", err)
+	}
+	return fmt.Sprintf("history with seed %d is not serializable: no serial order of committed txns %v "+
+		"explains their reads and the final state %v\n%s", seed, committed, final, report.String())
+}
+
+// anyPermutation reports whether ok holds for some ordering of names
+func anyPermutation(names []string, ok func(order []string) bool) bool {
+	order := make([]string, 0, len(names))
+	used := make([]bool, len(names))
+	var permute func() bool
+	permute = func() bool {
+		if len(order) == len(names) {
+			return ok(order)
+		}
+		for i, name := range names {
+			if used[i] {
+				continue
+			}
+			used[i] = true
+			order = append(order, name)
+			found := permute()
+			order = order[:len(order)-1]
+			used[i] = false
+			if found {
+				return true
+			}
+		}
+		return false
+	}
+	return permute()
+}
@@ -0,0 +1,89 @@
+package anomalytest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// commitTracker counts the successful commits of a run, for WaitForCommitCount
+type commitTracker struct {
+	mu      sync.Mutex
+	commits int
+	running int           // transactions that have not finished running
+	waiting int           // running transactions blocked in WaitForCommitCount
+	changed chan struct{} // closed and replaced whenever any count changes
+}
+
+// reset starts counting for a run of running transactions
+func (c *commitTracker) reset(running int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commits = 0
+	c.running = running
+	c.waiting = 0
+	c.changed = make(chan struct{})
+}
+
+// broadcastLocked wakes every waiter so it rechecks the counts. Caller must hold mu.
+func (c *commitTracker) broadcastLocked() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// recordCommit counts a successful commit
+func (c *commitTracker) recordCommit() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commits++
+	c.broadcastLocked()
+}
+
+// finish notes that a transaction has finished running and can commit no more
+func (c *commitTracker) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.running--
+	c.broadcastLocked()
+}
+
+// wait blocks until n commits have been counted. It fails with ErrTimeout once timeout expires, if it is
+// positive, or once every running transaction is waiting here, since then no more commits can happen.
+// It returns ctx's error if ctx is cancelled first.
+func (c *commitTracker) wait(ctx context.Context, n int, timeout time.Duration) error {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	c.mu.Lock()
+	c.waiting++
+	c.broadcastLocked()
+	defer func() {
+		c.mu.Lock()
+		c.waiting--
+		c.broadcastLocked()
+		c.mu.Unlock()
+	}()
+	for {
+		commits, stuck, changed := c.commits, c.waiting == c.running, c.changed
+		c.mu.Unlock()
+		if commits >= n {
+			return nil
+		}
+		if stuck {
+			return fmt.Errorf("only %d of %d commits happened before every other txn finished or began waiting for commits: %w", commits, n, ErrTimeout)
+		}
+		select {
+		case <-changed:
+		case <-expired:
+			return fmt.Errorf("only %d of %d commits happened after %v: %w", commits, n, timeout, ErrTimeout)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		c.mu.Lock()
+	}
+}
@@ -0,0 +1,88 @@
+package anomalytest
+
+import "slices"
+
+// barrierSite identifies a barrier by where it is signaled rather than by its name: the transaction and
+// the index of its Barrier operation. A barrier nothing signals has the zero site.
+type barrierSite struct {
+	txnName string
+	opIndex int
+}
+
+// barrierSites maps every barrier name in e's schedule to its site. Caller must hold e.mu.
+func (e *TxnsExecutor) barrierSites() map[string]barrierSite {
+	sites := make(map[string]barrierSite)
+	var visit func(txnName string, ops []operation)
+	visit = func(txnName string, ops []operation) {
+		for _, op := range ops {
+			switch op.kind {
+			case opBarrier:
+				sites[op.barrierName] = barrierSite{txnName: txnName, opIndex: op.opIndex}
+			case opParallel:
+				for _, branch := range op.branches {
+					visit(txnName, branch.operations)
+				}
+			}
+		}
+	}
+	for name, txn := range e.txns {
+		visit(name, txn.operations)
+	}
+	return sites
+}
+
+// SchedulesEquivalent reports whether a and b schedule the same plan: the same transactions, by name, on
+// the same databases, with the same operations, keys, values, timeouts and commit order, and the same
+// happens-before edges. Barrier names are not compared: a wait matches another if the barriers they wait
+// for are signaled at the same point of the same transaction. It is meant to check that a refactored
+// schedule builder still builds the schedule it replaced.
+func SchedulesEquivalent(a, b *TxnsExecutor) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a != b {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+	}
+	if len(a.txns) != len(b.txns) || !slices.Equal(a.commitOrder, b.commitOrder) {
+		return false
+	}
+	sitesA, sitesB := a.barrierSites(), b.barrierSites()
+	var sameOps func(opsA, opsB []operation) bool
+	sameOps = func(opsA, opsB []operation) bool {
+		if len(opsA) != len(opsB) {
+			return false
+		}
+		for i := range opsA {
+			x, y := opsA[i], opsB[i]
+			if x.kind != y.kind || x.name != y.name || x.opIndex != y.opIndex || x.requires != y.requires ||
+				x.timeout != y.timeout || x.count != y.count || len(x.branches) != len(y.branches) {
+				return false
+			}
+			switch x.kind {
+			case opDatabase:
+				// The description spells out the operation's keys and values
+				if x.description != y.description {
+					return false
+				}
+			case opWaitFor, opWaitForWithTimeout:
+				if sitesA[x.barrierName] != sitesB[y.barrierName] {
+					return false
+				}
+			case opParallel:
+				for j := range x.branches {
+					if !sameOps(x.branches[j].operations, y.branches[j].operations) {
+						return false
+					}
+				}
+			}
+		}
+		return true
+	}
+	for name, txnA := range a.txns {
+		txnB, ok := b.txns[name]
+		if !ok || txnA.dbName != txnB.dbName || txnA.timeout != txnB.timeout || !sameOps(txnA.operations, txnB.operations) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package anomalytest
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrAborted is wrapped by every error that means the database or the executor aborted a transaction
+	ErrAborted = errors.New("transaction aborted")
+
+	// ErrTimeout is returned for an operation that did not finish within its transaction's timeout
+	ErrTimeout = fmt.Errorf("%w: operation timed out", ErrAborted)
+
+	// ErrDeadlock is wrapped by every DeadlockError
+	ErrDeadlock = fmt.Errorf("%w: deadlock", ErrAborted)
+
+	// ErrSerializationFailure is returned by a database that aborted a transaction because it could not be
+	// serialized with the transactions that ran concurrently with it. The transaction can be retried.
+	ErrSerializationFailure = fmt.Errorf("%w: serialization failure", ErrAborted)
+
+	// ErrTxnNotActive is returned by a database for an operation on a transaction that has already ended
+	ErrTxnNotActive = errors.New("transaction is not active")
+
+	// ErrLockNotHeld is returned by a LockingDatabase when an operation needs a row lock the transaction does not hold
+	ErrLockNotHeld = errors.New("lock not held")
+
+	// ErrConstraintViolation is wrapped by every ConstraintViolationError
+	ErrConstraintViolation = fmt.Errorf("%w: constraint violation", ErrAborted)
+
+	// ErrUnsupportedIsolationLevel is returned by BeginTx for an isolation level the database does not implement
+	ErrUnsupportedIsolationLevel = errors.New("unsupported isolation level")
+
+	// ErrReadOnly is returned by a database for a write in a read-only transaction, such as one begun with BeginSnapshot
+	ErrReadOnly = errors.New("transaction is read-only")
+
+	// ErrNoSavepoint is returned by a SavepointDatabase for a rollback to a savepoint the transaction has not set
+	ErrNoSavepoint = errors.New("no such savepoint")
+)
+
+// IsRetryable reports whether err aborted a transaction in a way that running it again may avoid: a
+// deadlock or a serialization failure
+func IsRetryable(err error) bool {
+	return errors.Is(err, ErrDeadlock) || errors.Is(err, ErrSerializationFailure)
+}
+
+// DeadlockError is returned by a database that detected a deadlock and aborted one of the transactions
+// in it, the victim, to break it. The database has already rolled the victim back.
+type DeadlockError struct {
+	Victim int64
+	Cycle  []int64 // transactions in the wait-for cycle, each waiting for the next
+}
+
+func (e *DeadlockError) Error() string {
+	return fmt.Sprintf("deadlock between txns %v, aborted txn %d", e.Cycle, e.Victim)
+}
+
+func (e *DeadlockError) Unwrap() error {
+	return ErrDeadlock
+}
+
+// ConstraintViolationError is returned by a database for a commit that would violate a constraint, such as
+// a foreign key. The database has already rolled the transaction back.
+type ConstraintViolationError struct {
+	Constraint string // kind of constraint, e.g. "foreign key"
+	Keys       []int  // keys whose values violate it
+	Detail     string
+}
+
+func (e *ConstraintViolationError) Error() string {
+	return fmt.Sprintf("%s constraint violated on keys %v: %s", e.Constraint, e.Keys, e.Detail)
+}
+
+func (e *ConstraintViolationError) Unwrap() error {
+	return ErrConstraintViolation
+}
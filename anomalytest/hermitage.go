@@ -0,0 +1,246 @@
+package anomalytest
+
+import (
+	"fmt"
+	"time"
+)
+
+// ScheduleBuilder constructs a complete schedule against db, ready to Execute
+type ScheduleBuilder func(db Database) *TxnsExecutor
+
+// hermitageBlockTimeout bounds how long a step waits for a previous step that may be blocked on a lock
+const hermitageBlockTimeout = 500 * time.Millisecond
+
+// hermitageSchedule chains steps across transactions so they run one at a time, in the order
+// they are added, mirroring the numbered statements of a Hermitage test case.
+// https://github.com/ept/hermitage
+type hermitageSchedule struct {
+	exec         *TxnsExecutor
+	steps        int
+	lastBarrier  string              // barrier signaled when the previous step completed
+	lastMayBlock bool                // whether the previous step is expected to block in a locking database
+	lastBlocking *blockingStepResult // the most recent blockingStep
+}
+
+// blockingStepResult is a reference to a blockingStep, telling whether it held up the step after it
+type blockingStepResult struct {
+	next *WaitResult // the next step's wait for the blocking step, nil until the next step is added
+}
+
+// blocked reports whether the next step gave up waiting for the blocking step, i.e. the blocking step was
+// still blocked hermitageBlockTimeout after it started
+func (b *blockingStepResult) blocked(results *Results) bool {
+	if b.next == nil {
+		return false
+	}
+	timedOut, ok := results.WaitTimedOut(b.next)
+	return ok && timedOut
+}
+
+// newHermitageSchedule creates the executor and the setup transaction every Hermitage case starts from:
+// create table test (id int primary key, value int); insert into test (id, value) values (1, 10), (2, 20);
+func newHermitageSchedule(db Database) *hermitageSchedule {
+	s := &hermitageSchedule{exec: NewTxnsExecutor(db)}
+	setup := s.exec.NewTxn("setup")
+	s.step(setup, func() {
+		setup.BeginTx()
+		setup.Set(1, 10)
+		setup.Set(2, 20)
+		setup.Commit()
+	})
+	return s
+}
+
+// step schedules ops on txn that run only after the previous step has completed
+func (s *hermitageSchedule) step(txn *Txn, ops func()) {
+	s.addStep(txn, ops, false)
+}
+
+// blockingStep is like step, but the step is expected to block in a locking database (Hermitage's "BLOCKS").
+// The next step waits for it only until hermitageBlockTimeout, so the schedule can carry on and release the lock.
+func (s *hermitageSchedule) blockingStep(txn *Txn, ops func()) *blockingStepResult {
+	s.addStep(txn, ops, true)
+	s.lastBlocking = &blockingStepResult{}
+	return s.lastBlocking
+}
+
+func (s *hermitageSchedule) addStep(txn *Txn, ops func(), mayBlock bool) {
+	if s.lastBarrier != "" {
+		if s.lastMayBlock {
+			s.lastBlocking.next = txn.WaitForOrTimeout(s.lastBarrier, hermitageBlockTimeout)
+		} else {
+			txn.WaitFor(s.lastBarrier)
+		}
+	}
+	ops()
+	s.steps++
+	s.lastBarrier = fmt.Sprintf("step_%d", s.steps)
+	s.lastMayBlock = mayBlock
+	txn.Barrier(s.lastBarrier)
+}
+
+// selectAll schedules the equivalent of "select * from test" on txn
+func selectAll(txn *Txn) {
+	txn.Get(1)
+	txn.Get(2)
+}
+
+// HermitageG0 builds the Write Cycles (G0) case. Reads: "check" reads keys 1 and 2 after both commits.
+// https://github.com/ept/hermitage/blob/master/postgres.md#read-committed-basic-requirements-g0-g1a-g1b-g1c
+//
+//	begin; set session transaction isolation level read committed; -- T1
+//	begin; set session transaction isolation level read committed; -- T2
+//	update test set value = 11 where id = 1; -- T1
+//	update test set value = 12 where id = 1; -- T2, BLOCKS
+//	update test set value = 21 where id = 2; -- T1
+//	commit; -- T1. This unblocks T2
+//	update test set value = 22 where id = 2; -- T2
+//	commit; -- T2
+//	select * from test; -- either. Shows 1 => 12, 2 => 22
+//
+// Hermitage's informational "select * from test; -- T1" after T1's commit is omitted: it runs outside
+// any transaction and would race with T2's unblocked update.
+func HermitageG0(db Database) *TxnsExecutor {
+	exec, _ := hermitageG0(db)
+	return exec
+}
+
+// hermitageG0 builds HermitageG0 and also returns T2's blocking update of key 1
+func hermitageG0(db Database) (*TxnsExecutor, *blockingStepResult) {
+	s := newHermitageSchedule(db)
+	t1 := s.exec.NewTxn("T1")
+	t2 := s.exec.NewTxn("T2")
+	check := s.exec.NewTxn("check")
+
+	s.step(t1, func() { t1.BeginTx() })
+	s.step(t2, func() { t2.BeginTx() })
+	s.step(t1, func() { t1.Set(1, 11) })
+	update := s.blockingStep(t2, func() { t2.Set(1, 12) })
+	s.step(t1, func() { t1.Set(2, 21) })
+	s.step(t1, func() { t1.Commit() })
+	s.step(t2, func() { t2.Set(2, 22) })
+	s.step(t2, func() { t2.Commit() })
+	s.step(check, func() {
+		check.BeginTx()
+		selectAll(check)
+		check.Commit()
+	})
+	return s.exec, update
+}
+
+// HermitageG1a builds the Aborted Reads (G1a) case. Reads: T2 reads keys 1 and 2 twice.
+//
+//	begin; set session transaction isolation level read committed; -- T1
+//	begin; set session transaction isolation level read committed; -- T2
+//	update test set value = 101 where id = 1; -- T1
+//	select * from test; -- T2. Still shows 1 => 10
+//	abort;  -- T1
+//	select * from test; -- T2. Still shows 1 => 10
+//	commit; -- T2
+func HermitageG1a(db Database) *TxnsExecutor {
+	s := newHermitageSchedule(db)
+	t1 := s.exec.NewTxn("T1")
+	t2 := s.exec.NewTxn("T2")
+
+	s.step(t1, func() { t1.BeginTx() })
+	s.step(t2, func() { t2.BeginTx() })
+	s.step(t1, func() { t1.Set(1, 101) })
+	s.step(t2, func() { selectAll(t2) })
+	s.step(t1, func() { t1.Rollback() })
+	s.step(t2, func() { selectAll(t2) })
+	s.step(t2, func() { t2.Commit() })
+	return s.exec
+}
+
+// HermitageG1b builds the Intermediate Reads (G1b) case. Reads: T2 reads keys 1 and 2 twice.
+//
+//	begin; set session transaction isolation level read committed; -- T1
+//	begin; set session transaction isolation level read committed; -- T2
+//	update test set value = 101 where id = 1; -- T1
+//	select * from test; -- T2. Still shows 1 => 10
+//	update test set value = 11 where id = 1; -- T1
+//	commit; -- T1
+//	select * from test; -- T2. Now shows 1 => 11
+//	commit; -- T2
+func HermitageG1b(db Database) *TxnsExecutor {
+	s := newHermitageSchedule(db)
+	t1 := s.exec.NewTxn("T1")
+	t2 := s.exec.NewTxn("T2")
+
+	s.step(t1, func() { t1.BeginTx() })
+	s.step(t2, func() { t2.BeginTx() })
+	s.step(t1, func() { t1.Set(1, 101) })
+	s.step(t2, func() { selectAll(t2) })
+	s.step(t1, func() { t1.Set(1, 11) })
+	s.step(t1, func() { t1.Commit() })
+	s.step(t2, func() { selectAll(t2) })
+	s.step(t2, func() { t2.Commit() })
+	return s.exec
+}
+
+// HermitageG1c builds the Circular Information Flow (G1c) case.
+// Reads: T1 reads key 2, T2 reads key 1, and "check" reads keys 1 and 2 after both commits.
+//
+//	begin; set session transaction isolation level read committed; -- T1
+//	begin; set session transaction isolation level read committed; -- T2
+//	update test set value = 11 where id = 1; -- T1
+//	update test set value = 22 where id = 2; -- T2
+//	select * from test where id = 2; -- T1. Still shows 2 => 20
+//	select * from test where id = 1; -- T2. Still shows 1 => 10
+//	commit; -- T1
+//	commit; -- T2
+func HermitageG1c(db Database) *TxnsExecutor {
+	s := newHermitageSchedule(db)
+	t1 := s.exec.NewTxn("T1")
+	t2 := s.exec.NewTxn("T2")
+	check := s.exec.NewTxn("check")
+
+	s.step(t1, func() { t1.BeginTx() })
+	s.step(t2, func() { t2.BeginTx() })
+	s.step(t1, func() { t1.Set(1, 11) })
+	s.step(t2, func() { t2.Set(2, 22) })
+	s.step(t1, func() { t1.Get(2) })
+	s.step(t2, func() { t2.Get(1) })
+	s.step(t1, func() { t1.Commit() })
+	s.step(t2, func() { t2.Commit() })
+	s.step(check, func() {
+		check.BeginTx()
+		selectAll(check)
+		check.Commit()
+	})
+	return s.exec
+}
+
+// HermitageG2Item builds the Item Anti-Dependency Cycles (G2-item) case, also known as write skew.
+// Reads: T1 and T2 each read keys 1 and 2, and "check" reads them after both transactions end.
+// https://github.com/ept/hermitage/blob/master/postgres.md#write-skew-g2-item
+//
+//	begin; set session transaction isolation level serializable; -- T1
+//	begin; set session transaction isolation level serializable; -- T2
+//	select * from test where id in (1,2); -- T1
+//	select * from test where id in (1,2); -- T2
+//	update test set value = 11 where id = 1; -- T1, BLOCKS in a database that locks reads
+//	update test set value = 21 where id = 2; -- T2
+//	commit; -- T1
+//	commit; -- T2. Prevents write skew, fails with a serialization failure
+func HermitageG2Item(db Database) *TxnsExecutor {
+	s := newHermitageSchedule(db)
+	t1 := s.exec.NewTxn("T1")
+	t2 := s.exec.NewTxn("T2")
+	check := s.exec.NewTxn("check")
+
+	s.step(t1, func() { t1.BeginTx() })
+	s.step(t2, func() { t2.BeginTx() })
+	s.step(t1, func() { selectAll(t1) })
+	s.step(t2, func() { selectAll(t2) })
+	s.blockingStep(t1, func() { t1.Set(1, 11) })
+	s.blockingStep(t2, func() { t2.Set(2, 21) })
+	s.step(t1, func() { t1.Commit() })
+	s.step(t2, func() { t2.Commit() })
+	s.step(check, func() {
+		check.BeginTx()
+		selectAll(check)
+		check.Commit()
+	})
+	return s.exec
+}
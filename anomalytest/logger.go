@@ -0,0 +1,25 @@
+package anomalytest
+
+import (
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Logger is the leveled, structured logger used by the executor and the databases.
+// Arguments after msg are alternating keys and values, as in log/slog; *slog.Logger satisfies it directly.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// NewSlogLogger returns a Logger that writes slog text records at or above level to w
+func NewSlogLogger(w io.Writer, level slog.Level) Logger {
+	return slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: level}))
+}
+
+// DefaultLogger returns the Logger used when none has been set: Info level and above, written to stdout
+func DefaultLogger() Logger {
+	return NewSlogLogger(os.Stdout, slog.LevelInfo)
+}
@@ -0,0 +1,142 @@
+package anomalytest
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// IsolationLevel names an isolation level, in the form passed to Database.BeginTx
+type IsolationLevel string
+
+const (
+	ReadUncommitted   IsolationLevel = "READ_UNCOMMITTED"
+	ReadCommitted     IsolationLevel = "READ_COMMITTED"
+	RepeatableRead    IsolationLevel = "REPEATABLE_READ"
+	SnapshotIsolation IsolationLevel = "SNAPSHOT_ISOLATION"
+	Serializable      IsolationLevel = "SERIALIZABLE"
+)
+
+// IsolationLevels lists every level in the matrix, weakest first
+var IsolationLevels = []IsolationLevel{ReadUncommitted, ReadCommitted, RepeatableRead, SnapshotIsolation, Serializable}
+
+// Names of the anomalies the package has schedules for, as used in Hermitage
+const (
+	AnomalyG0         = "G0"  // write cycles; see HermitageG0
+	AnomalyG1a        = "G1a" // aborted reads; see HermitageG1a
+	AnomalyG1b        = "G1b" // intermediate reads; see HermitageG1b
+	AnomalyG1c        = "G1c" // circular information flow; see HermitageG1c
+	AnomalyLostUpdate = "P4"  // lost update; see TestLostUpdateIncrement
+)
+
+// Anomalies lists every anomaly in the matrix, in the order they are usually presented
+var Anomalies = []string{AnomalyG0, AnomalyG1a, AnomalyG1b, AnomalyG1c, AnomalyLostUpdate}
+
+// Verdict is whether an isolation level lets an anomaly happen
+type Verdict int
+
+const (
+	Prevented Verdict = iota // the anomaly can never be observed
+	Allowed                  // the anomaly is observed whenever the schedule interleaves as in its test
+	Sometimes                // whether the anomaly is observed depends on timing or on the implementation
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Allowed:
+		return "allowed"
+	case Sometimes:
+		return "sometimes"
+	default:
+		return "prevented"
+	}
+}
+
+// matrix is the canonical answer to which anomalies each level prevents, following Adya's definitions and
+// the results Hermitage reports for databases that implement each level as specified
+var matrix = map[IsolationLevel]map[string]Verdict{
+	ReadUncommitted: {
+		AnomalyG0:         Prevented,
+		AnomalyG1a:        Allowed,
+		AnomalyG1b:        Allowed,
+		AnomalyG1c:        Allowed,
+		AnomalyLostUpdate: Allowed,
+	},
+	ReadCommitted: {
+		AnomalyG0:         Prevented,
+		AnomalyG1a:        Prevented,
+		AnomalyG1b:        Prevented,
+		AnomalyG1c:        Prevented,
+		AnomalyLostUpdate: Allowed,
+	},
+	RepeatableRead: {
+		AnomalyG0:         Prevented,
+		AnomalyG1a:        Prevented,
+		AnomalyG1b:        Prevented,
+		AnomalyG1c:        Prevented,
+		AnomalyLostUpdate: Prevented,
+	},
+	SnapshotIsolation: {
+		AnomalyG0:         Prevented,
+		AnomalyG1a:        Prevented,
+		AnomalyG1b:        Prevented,
+		AnomalyG1c:        Prevented,
+		AnomalyLostUpdate: Prevented,
+	},
+	Serializable: {
+		AnomalyG0:         Prevented,
+		AnomalyG1a:        Prevented,
+		AnomalyG1b:        Prevented,
+		AnomalyG1c:        Prevented,
+		AnomalyLostUpdate: Prevented,
+	},
+}
+
+// Matrix returns, for every isolation level, the verdict on every anomaly. The result is a copy,
+// so callers may modify it.
+func Matrix() map[IsolationLevel]map[string]Verdict {
+	copied := make(map[IsolationLevel]map[string]Verdict, len(matrix))
+	for level, verdicts := range matrix {
+		copied[level] = make(map[string]Verdict, len(verdicts))
+		for anomaly, verdict := range verdicts {
+			copied[level][anomaly] = verdict
+		}
+	}
+	return copied
+}
+
+// Expected returns the matrix's verdict on anomaly at level. It panics if either is not in the matrix,
+// since that is a mistake in the calling test.
+func Expected(level IsolationLevel, anomaly string) Verdict {
+	verdicts, ok := matrix[level]
+	if !ok {
+		panic(fmt.Sprintf("unknown isolation level %q", level))
+	}
+	verdict, ok := verdicts[anomaly]
+	if !ok {
+		panic(fmt.Sprintf("unknown anomaly %q", anomaly))
+	}
+	return verdict
+}
+
+// WriteMatrix writes the matrix to w as a plain text table, one row per isolation level
+func WriteMatrix(w io.Writer) error {
+	width := 0
+	for _, level := range IsolationLevels {
+		width = max(width, len(level))
+	}
+	header := fmt.Sprintf("%-*s", width, "")
+	for _, anomaly := range Anomalies {
+		header += fmt.Sprintf("  %-9s", anomaly)
+	}
+	lines := []string{strings.TrimRight(header, " ")}
+	for _, level := range IsolationLevels {
+		line := fmt.Sprintf("%-*s", width, level)
+		for _, anomaly := range Anomalies {
+			line += fmt.Sprintf("  %-9s", matrix[level][anomaly])
+		}
+		lines = append(lines, strings.TrimRight(line, " "))
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
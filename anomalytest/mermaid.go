@@ -0,0 +1,57 @@
+package anomalytest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// mermaidDatabase is the participant that database operations are sent to in ToMermaid diagrams
+const mermaidDatabase = "DB"
+
+// ToMermaid renders a trace, as returned by TxnsExecutor.Trace, as a Mermaid sequence diagram. Each
+// transaction is a participant, in the order it first appears, and sends its database operations as
+// messages to a DB participant; a failed operation is drawn as a lost message with its error. Barriers,
+// waits, parallel groups and lock waits are notes over the transaction.
+func ToMermaid(trace []TraceEvent) string {
+	var b strings.Builder
+	b.WriteString("sequenceDiagram\n")
+
+	aliases := make(map[string]string) // txn name -> participant id, since names may not be valid ids
+	for _, event := range trace {
+		if _, ok := aliases[event.TxnName]; !ok {
+			aliases[event.TxnName] = fmt.Sprintf("p%d", len(aliases))
+			fmt.Fprintf(&b, "    participant %s as %s\n", aliases[event.TxnName], mermaidText(event.TxnName))
+		}
+	}
+	fmt.Fprintf(&b, "    participant %s\n", mermaidDatabase)
+
+	for _, event := range trace {
+		txn := aliases[event.TxnName]
+		switch event.Kind {
+		case TraceBarrier:
+			fmt.Fprintf(&b, "    Note over %s: BARRIER %s\n", txn, mermaidText(event.Barrier))
+		case TraceWaitFor:
+			fmt.Fprintf(&b, "    Note over %s: WAIT_FOR %s\n", txn, mermaidText(event.Barrier))
+		case TraceWaitOrTimeout:
+			note := "WAIT_FOR " + event.Barrier
+			if event.TimedOut {
+				note += " (timed out)"
+			}
+			fmt.Fprintf(&b, "    Note over %s: %s\n", txn, mermaidText(note))
+		case TraceParallel, TraceCommitCount, TraceSleep, TraceLockWait, TraceLockAcquired:
+			fmt.Fprintf(&b, "    Note over %s: %s\n", txn, mermaidText(event.Description))
+		default:
+			if event.Err != nil {
+				fmt.Fprintf(&b, "    %s-x%s: %s\n", txn, mermaidDatabase, mermaidText(event.Description+" failed: "+event.Err.Error()))
+			} else {
+				fmt.Fprintf(&b, "    %s->>%s: %s\n", txn, mermaidDatabase, mermaidText(event.Description))
+			}
+		}
+	}
+	return b.String()
+}
+
+// mermaidText escapes the characters that would end a Mermaid statement early
+func mermaidText(s string) string {
+	return strings.NewReplacer("\n", " ", ";", "#59;", "#", "#35;").Replace(s)
+}
@@ -0,0 +1,232 @@
+package anomalytest
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	minimizeRepeats    = 3           // runs a reduced schedule must reproduce the failure in to be kept
+	minimizeRunTimeout = time.Second // bound on each run, since a reduction can leave transactions blocked forever
+)
+
+// Minimize shrinks a schedule that reproduces a failure to a smaller one that still does, by delta debugging:
+// it repeatedly tries dropping a whole transaction or a single operation and keeps the change whenever check,
+// which reports whether a run shows the failure, still holds. A reduced schedule is only kept if it passes
+// Validate and reproduces the failure in every one of several runs, each against a fresh database from
+// factory. BeginTx, BeginSnapshot, Commit and Rollback are never dropped on their own, and neither are the
+// barriers and waits that fix the interleaving, so the result reproduces as deterministically as the
+// original: dropping a transaction drops the waits for its barriers, and barriers that nothing waits for
+// are dropped at the end.
+//
+// The schedule is reduced in place and returned; references such as GetResults taken while building it keep
+// working as long as the operation they refer to survives. The schedule must run against the default
+// database only. If the original schedule does not reproduce the failure it is returned unchanged.
+func Minimize(schedule *TxnsExecutor, factory func() Database, check func(*Results) bool) *TxnsExecutor {
+	if !schedule.reproduces(factory, check) {
+		return schedule
+	}
+	for reduced := true; reduced; {
+		reduced = false
+		for _, name := range schedule.txnNames() {
+			saved := schedule.saveSchedule()
+			schedule.dropTxn(name)
+			if schedule.reproduces(factory, check) {
+				reduced = true
+				continue
+			}
+			schedule.restoreSchedule(saved)
+		}
+		for _, name := range schedule.txnNames() {
+			for i := len(schedule.txns[name].operations) - 1; i >= 0; i-- {
+				if !droppable(schedule.txns[name].operations[i]) {
+					continue
+				}
+				saved := schedule.saveSchedule()
+				schedule.dropOp(name, i)
+				if schedule.reproduces(factory, check) {
+					reduced = true
+					continue
+				}
+				schedule.restoreSchedule(saved)
+			}
+		}
+	}
+	schedule.dropUnusedBarriers()
+	schedule.pruneReads()
+	return schedule
+}
+
+// droppable reports whether Minimize may try removing op on its own. Barriers and waits are kept, since
+// dropping one can turn a deterministic interleaving into a race that reproduces the failure only by
+// chance; a barrier goes with the transaction that signals it, or at the end if nothing waits for it.
+func droppable(op operation) bool {
+	switch op.kind {
+	case opDatabase:
+		return op.name != OpBegin && op.name != OpSnapshot && op.name != OpCommit && op.name != OpRollback
+	case opParallel, opWaitForCommitCount, opSleep:
+		return true
+	}
+	return false
+}
+
+// reproduces reports whether the schedule is valid and shows the failure in every one of minimizeRepeats runs
+func (e *TxnsExecutor) reproduces(factory func() Database, check func(*Results) bool) bool {
+	if e.Validate() != nil {
+		return false
+	}
+	for i := 0; i < minimizeRepeats; i++ {
+		e.replaceDefaultDatabase(factory())
+		ctx, cancel := context.WithTimeout(context.Background(), minimizeRunTimeout)
+		results := e.ExecuteContext(ctx, false)
+		hung := errors.Is(ctx.Err(), context.DeadlineExceeded)
+		cancel()
+		if hung || !check(results) {
+			return false
+		}
+	}
+	return true
+}
+
+// replaceDefaultDatabase points the executor and every transaction on the default database at db
+func (e *TxnsExecutor) replaceDefaultDatabase(db Database) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dbs[DefaultDatabase] = db
+	for _, txn := range e.txns {
+		if txn.dbName != DefaultDatabase {
+			continue
+		}
+		txn.db = db
+		for _, op := range txn.operations {
+			for _, branch := range op.branches {
+				branch.db = db
+			}
+		}
+	}
+}
+
+// txnNames returns the names of the executor's transactions in sorted order
+func (e *TxnsExecutor) txnNames() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	names := make([]string, 0, len(e.txns))
+	for name := range e.txns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// savedSchedule is the part of an executor's schedule that Minimize changes
+type savedSchedule struct {
+	txns        map[string]*Txn
+	operations  map[string][]operation
+	commitOrder []string
+}
+
+func (e *TxnsExecutor) saveSchedule() savedSchedule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	saved := savedSchedule{
+		txns:        make(map[string]*Txn, len(e.txns)),
+		operations:  make(map[string][]operation, len(e.txns)),
+		commitOrder: slices.Clone(e.commitOrder),
+	}
+	for name, txn := range e.txns {
+		saved.txns[name] = txn
+		saved.operations[name] = slices.Clone(txn.operations)
+	}
+	return saved
+}
+
+func (e *TxnsExecutor) restoreSchedule(saved savedSchedule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.txns = saved.txns
+	for name, txn := range e.txns {
+		txn.operations = saved.operations[name]
+	}
+	e.commitOrder = saved.commitOrder
+}
+
+// dropTxn removes the named transaction from the schedule, with the waits for the barriers it signaled
+func (e *TxnsExecutor) dropTxn(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	txns := make(map[string]*Txn, len(e.txns)-1)
+	for other, txn := range e.txns {
+		if other != name {
+			txns[other] = txn
+		}
+	}
+	e.txns = txns
+	e.commitOrder = slices.DeleteFunc(slices.Clone(e.commitOrder), func(other string) bool { return other == name })
+	e.dropOrphanedWaits()
+}
+
+// dropOp removes the named transaction's i-th operation
+func (e *TxnsExecutor) dropOp(name string, i int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	txn := e.txns[name]
+	txn.operations = slices.Delete(slices.Clone(txn.operations), i, i+1)
+}
+
+// dropOrphanedWaits removes every wait for a barrier that no operation signals any more. Caller must hold e.mu.
+func (e *TxnsExecutor) dropOrphanedWaits() {
+	signaled := make(map[string]bool)
+	for _, txn := range e.txns {
+		for _, op := range txn.operations {
+			if op.kind == opBarrier {
+				signaled[op.barrierName] = true
+			}
+		}
+	}
+	for _, txn := range e.txns {
+		txn.operations = slices.DeleteFunc(slices.Clone(txn.operations), func(op operation) bool {
+			return (op.kind == opWaitFor || op.kind == opWaitForWithTimeout) && !signaled[op.barrierName]
+		})
+	}
+}
+
+// dropUnusedBarriers removes every barrier that no operation waits for
+func (e *TxnsExecutor) dropUnusedBarriers() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	awaited := make(map[string]bool)
+	for _, txn := range e.txns {
+		for _, op := range txn.operations {
+			if op.kind == opWaitFor || op.kind == opWaitForWithTimeout {
+				awaited[op.barrierName] = true
+			}
+		}
+	}
+	for _, txn := range e.txns {
+		txn.operations = slices.DeleteFunc(txn.operations, func(op operation) bool {
+			return op.kind == opBarrier && !awaited[op.barrierName]
+		})
+	}
+}
+
+// pruneReads forgets the references to reads that are no longer in the schedule, so that Reads only
+// returns reads that run
+func (e *TxnsExecutor) pruneReads() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, txn := range e.txns {
+		present := make(map[int]bool)
+		for _, op := range txn.operations {
+			present[op.opIndex] = true
+			for _, branch := range op.branches {
+				for _, branchOp := range branch.operations {
+					present[branchOp.opIndex] = true
+				}
+			}
+		}
+		txn.reads = slices.DeleteFunc(txn.reads, func(read *GetResult) bool { return !present[read.opIndex] })
+	}
+}
@@ -0,0 +1,147 @@
+package anomalytest
+
+import "sync"
+
+// Method names recorded by MockDatabase
+const (
+	MethodBeginTx  = "BeginTx"
+	MethodSet      = "Set"
+	MethodGet      = "Get"
+	MethodDelete   = "Delete"
+	MethodCommit   = "Commit"
+	MethodRollback = "Rollback"
+)
+
+// MockCall is a single call made on a MockDatabase
+type MockCall struct {
+	Seq            int // position of the call across all goroutines, starting at 1
+	Method         string
+	TxId           int64 // for BeginTx, the id that was returned
+	Key            int
+	Value          int
+	IsolationLevel string
+}
+
+// MockDatabase is a Database that records every call made on it and returns programmed results,
+// for testing the executor in isolation from any real database implementation.
+// It is safe for concurrent use by the transaction goroutines of an executor.
+type MockDatabase struct {
+	mu        sync.Mutex
+	calls     []MockCall
+	errs      map[string]error // method -> error returned by every call
+	values    map[int]int      // key -> value returned by Get
+	nextTxnId int64
+}
+
+// NewMockDatabase creates a MockDatabase whose methods all succeed and whose Get returns 0
+func NewMockDatabase() *MockDatabase {
+	return &MockDatabase{
+		errs:      make(map[string]error),
+		values:    make(map[int]int),
+		nextTxnId: 1,
+	}
+}
+
+// SetError makes every subsequent call of method return err. A nil err makes the method succeed again.
+func (m *MockDatabase) SetError(method string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errs[method] = err
+}
+
+// SetGetValue makes Get return value for key
+func (m *MockDatabase) SetGetValue(key int, value int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.values[key] = value
+}
+
+// Calls returns all recorded calls in the order they were made
+func (m *MockDatabase) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
+
+// CallCount returns how many times method has been called
+func (m *MockDatabase) CallCount(method string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := 0
+	for _, call := range m.calls {
+		if call.Method == method {
+			count++
+		}
+	}
+	return count
+}
+
+// CallCountsByTxn returns, for each transaction id, how many times method has been called for it
+func (m *MockDatabase) CallCountsByTxn(method string) map[int64]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[int64]int)
+	for _, call := range m.calls {
+		if call.Method == method {
+			counts[call.TxId]++
+		}
+	}
+	return counts
+}
+
+// record appends a call and returns the programmed error for its method. Caller must hold mu.
+func (m *MockDatabase) record(call MockCall) error {
+	call.Seq = len(m.calls) + 1
+	m.calls = append(m.calls, call)
+	return m.errs[call.Method]
+}
+
+func (m *MockDatabase) BeginTx(isolationLevel string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	txId := m.nextTxnId
+	if err := m.record(MockCall{Method: MethodBeginTx, TxId: txId, IsolationLevel: isolationLevel}); err != nil {
+		return 0, err
+	}
+	m.nextTxnId++
+	return txId, nil
+}
+
+func (m *MockDatabase) Set(txId int64, key int, value int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.record(MockCall{Method: MethodSet, TxId: txId, Key: key, Value: value})
+}
+
+func (m *MockDatabase) Get(txId int64, key int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.record(MockCall{Method: MethodGet, TxId: txId, Key: key}); err != nil {
+		return 0, err
+	}
+	return m.values[key], nil
+}
+
+func (m *MockDatabase) Delete(txId int64, key int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.record(MockCall{Method: MethodDelete, TxId: txId, Key: key})
+}
+
+func (m *MockDatabase) Commit(txId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.record(MockCall{Method: MethodCommit, TxId: txId})
+}
+
+func (m *MockDatabase) Rollback(txId int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.record(MockCall{Method: MethodRollback, TxId: txId})
+}
+
+func (m *MockDatabase) PrintState() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	DefaultLogger().Info("mock calls", "calls", m.calls)
+}
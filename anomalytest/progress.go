@@ -0,0 +1,134 @@
+package anomalytest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// txnProgress is what a running transaction is doing, for reporting where a run got stuck
+type txnProgress struct {
+	mu       sync.Mutex
+	started  bool
+	finished bool
+	op       operation // the operation it is running
+	barrier  string    // the barrier op is waiting for, if any
+}
+
+// start marks the transaction as running op, waiting for barrier if it is not ""
+func (p *txnProgress) start(op operation, barrier string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started, p.op, p.barrier = true, op, barrier
+}
+
+// unblock marks the transaction as no longer waiting for a barrier
+func (p *txnProgress) unblock() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.barrier = ""
+}
+
+// finish marks the transaction as having run all its operations
+func (p *txnProgress) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.finished = true
+}
+
+// current returns the operation the transaction is running, or has run last
+func (p *txnProgress) current() operation {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.op
+}
+
+// reset forgets the progress of an earlier run
+func (p *txnProgress) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.started, p.finished, p.op, p.barrier = false, false, operation{}, ""
+}
+
+// describe returns what the transaction is doing, or "" if it has finished
+func (p *txnProgress) describe(txnName string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.finished:
+		return ""
+	case !p.started:
+		return fmt.Sprintf("txn %s has not started", txnName)
+	case p.barrier != "":
+		return fmt.Sprintf("txn %s op %d waiting for barrier %s", txnName, p.op.opIndex, p.barrier)
+	default:
+		return fmt.Sprintf("txn %s op %d (%s) running", txnName, p.op.opIndex, p.op.description)
+	}
+}
+
+// unfinished describes every transaction of sched that has not finished running, in name order
+func (s schedule) unfinished() []string {
+	names := make([]string, 0, len(s.txns))
+	for name := range s.txns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var stuck []string
+	for _, name := range names {
+		if description := s.txns[name].progress.describe(name); description != "" {
+			stuck = append(stuck, description)
+		}
+	}
+	return stuck
+}
+
+// Stats is a snapshot of what the transactions of a run are doing
+type Stats struct {
+	NotStarted int // have not run an operation yet
+	Running    int // running an operation
+	Blocked    int // waiting for a barrier
+	Finished   int // have run all their operations
+	Committed  int
+	RolledBack int
+	Aborted    int               // aborted by the database, or timed out or cancelled by the executor
+	WaitingFor map[string]string // barrier each blocked transaction is waiting for, by transaction name
+}
+
+// Stats returns what the transactions of the current run, or of the latest one if none is running, are doing.
+// It is safe to call from another goroutine, or from inside an operation, while the run is going.
+func (e *TxnsExecutor) Stats() Stats {
+	e.mu.Lock()
+	txns, results := e.runTxns, e.resultStore
+	e.mu.Unlock()
+
+	stats := Stats{WaitingFor: make(map[string]string)}
+	for name, txn := range txns {
+		txn.progress.count(name, &stats)
+		switch results.Outcome(name) {
+		case OutcomeCommitted:
+			stats.Committed++
+		case OutcomeRolledBack:
+			stats.RolledBack++
+		case OutcomeAborted, OutcomeTimedOut:
+			stats.Aborted++
+		}
+	}
+	return stats
+}
+
+// count adds the transaction's lifecycle state to stats
+func (p *txnProgress) count(txnName string, stats *Stats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.finished:
+		stats.Finished++
+	case !p.started:
+		stats.NotStarted++
+	case p.barrier != "":
+		stats.Blocked++
+		stats.WaitingFor[txnName] = p.barrier
+	default:
+		stats.Running++
+	}
+}
@@ -0,0 +1,65 @@
+package anomalytest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// quiescencePollInterval is how often WaitQuiescent checks the database
+const quiescencePollInterval = time.Millisecond
+
+// WaitQuiescent blocks until db has no active transactions, no transactions waiting for locks, and no
+// commits that are not yet visible, as far as the inspector interfaces db implements can tell. On timeout
+// it returns an error listing what is still pending. It fails immediately if db implements none of
+// ActivityInspector, LockWaitInspector and VisibilityInspector.
+func (e *TxnsExecutor) WaitQuiescent(db Database, timeout time.Duration) error {
+	activity, hasActivity := db.(ActivityInspector)
+	waits, hasWaits := db.(LockWaitInspector)
+	visibility, hasVisibility := db.(VisibilityInspector)
+	if !hasActivity && !hasWaits && !hasVisibility {
+		return fmt.Errorf("%T cannot report whether it is quiescent", db)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var pending []string
+		if hasActivity {
+			if txns := activity.ActiveTxns(); len(txns) > 0 {
+				pending = append(pending, fmt.Sprintf("active txns %v", sortedTxnIds(txns)))
+			}
+		}
+		if hasWaits {
+			if waiters := waits.LockWaiters(); len(waiters) > 0 {
+				ids := make([]int64, 0, len(waiters))
+				for txId := range waiters {
+					ids = append(ids, txId)
+				}
+				descriptions := make([]string, len(ids))
+				for i, txId := range sortedTxnIds(ids) {
+					descriptions[i] = fmt.Sprintf("txn %d on key %d", txId, waiters[txId])
+				}
+				pending = append(pending, "lock waiters ["+strings.Join(descriptions, ", ")+"]")
+			}
+		}
+		if hasVisibility {
+			if txns := visibility.PendingCommits(); len(txns) > 0 {
+				pending = append(pending, fmt.Sprintf("commits not yet visible %v", sortedTxnIds(txns)))
+			}
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("database not quiescent after %v: %s", timeout, strings.Join(pending, "; "))
+		}
+		time.Sleep(quiescencePollInterval)
+	}
+}
+
+func sortedTxnIds(txns []int64) []int64 {
+	sorted := append([]int64(nil), txns...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
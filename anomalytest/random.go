@@ -0,0 +1,143 @@
+package anomalytest
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	// randomPollInterval is how often ExecuteRandom checks whether a running operation is waiting for a lock
+	randomPollInterval = time.Millisecond
+	// randomStuckTimeout is how long ExecuteRandom waits for any operation to finish when every unfinished
+	// transaction is blocked before it gives up on the run
+	randomStuckTimeout = time.Second
+)
+
+// ExecuteRandom runs the scheduled transactions iterations times, each time in a random interleaving of
+// their database operations, and returns the distinct final states of the default database, ordered by
+// their contents. Barriers, waits, sleeps and the commit order are ignored. Each run starts from a reset
+// database and repeatedly picks a transaction at random among those ready to go on and runs its next
+// operation, so a seed reproduces the same interleavings. An operation that waits for a lock, as LockWaitInspector
+// reports, leaves its transaction blocked and the others go on until it is granted; if every unfinished
+// transaction stays blocked for a second, the run is cancelled, its transactions are rolled back and its
+// final state is counted like any other.
+// It panics if a transaction has a parallel group or the default database cannot be reset or inspected.
+func (e *TxnsExecutor) ExecuteRandom(seed uint64, iterations int) []map[int]int {
+	sched := e.fullSchedule()
+	for name, txn := range sched.txns {
+		for _, op := range txn.operations {
+			if op.kind == opParallel {
+				panic(fmt.Errorf("txn %s op %d is a parallel group, which cannot be interleaved at random", name, op.opIndex))
+			}
+		}
+	}
+	if _, ok := e.dbs[DefaultDatabase].(Resetter); !ok {
+		panic(fmt.Errorf("ExecuteRandom needs a database that implements Resetter"))
+	}
+	if _, ok := e.dbs[DefaultDatabase].(StateInspector); !ok {
+		panic(fmt.Errorf("ExecuteRandom needs a database that implements StateInspector"))
+	}
+
+	rng := rand.New(rand.NewPCG(seed, seed))
+	log := e.runLogger(false)
+	seen := make(map[string]map[int]int)
+	for i := 0; i < iterations; i++ {
+		e.Reset()
+		e.startRun(sched)
+		e.commits.reset(len(sched.txns))
+		e.runRandom(sched, rng, log)
+		e.finishRun()
+		state := e.resultStore.finalStates[DefaultDatabase]
+		seen[fmt.Sprint(state)] = state // fmt prints maps in key order
+	}
+
+	keys := slices.Sorted(maps.Keys(seen))
+	states := make([]map[int]int, 0, len(keys))
+	for _, key := range keys {
+		states = append(states, seen[key])
+	}
+	return states
+}
+
+// runRandom runs one random interleaving of the database operations of sched's transactions
+func (e *TxnsExecutor) runRandom(sched schedule, rng *rand.Rand, log Logger) {
+	names := make([]string, 0, len(sched.txns))
+	remaining := make(map[string][]operation, len(sched.txns))
+	for name, txn := range sched.txns {
+		txn.log = log
+		names = append(names, name)
+		for _, op := range txn.operations {
+			if op.kind == opDatabase {
+				remaining[name] = append(remaining[name], op)
+			}
+		}
+	}
+	sort.Strings(names) // pick from a stable order so the seed alone decides
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	finished := make(chan string, len(names))
+	running := make(map[string]bool)
+
+	for {
+		var ready []string
+		for _, name := range names {
+			if len(remaining[name]) > 0 && !running[name] {
+				ready = append(ready, name)
+			}
+		}
+		if len(ready) == 0 {
+			if len(running) == 0 {
+				return
+			}
+			select {
+			case name := <-finished:
+				delete(running, name)
+			case <-time.After(randomStuckTimeout):
+				log.Debug("STUCK, cancelling run", "blocked", len(running))
+				cancel()
+				for len(running) > 0 {
+					delete(running, <-finished)
+				}
+				return
+			}
+			continue
+		}
+
+		name := ready[rng.IntN(len(ready))]
+		txn, op := sched.txns[name], remaining[name][0]
+		remaining[name] = remaining[name][1:]
+		running[name] = true
+		go func() {
+			txn.runDatabaseOp(ctx, op, e.barriers, log)
+			finished <- name
+		}()
+		e.awaitStep(txn, op, finished, running)
+	}
+}
+
+// awaitStep waits until txn's running operation op finishes or waits for a lock, noting any other
+// transaction that finishes meanwhile
+func (e *TxnsExecutor) awaitStep(txn *Txn, op operation, finished <-chan string, running map[string]bool) {
+	inspector, inspects := txn.db.(LockWaitInspector)
+	inspects = inspects && op.name != OpBegin && op.name != OpSnapshot // which set txnId, and never wait for locks
+	ticker := time.NewTicker(randomPollInterval)
+	defer ticker.Stop()
+	for running[txn.name] {
+		select {
+		case name := <-finished:
+			delete(running, name)
+		case <-ticker.C:
+			if inspects {
+				if _, waiting := inspector.LockWaiters()[txn.txnId]; waiting {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package anomalytest
+
+import (
+	"context"
+	"fmt"
+)
+
+// Step names one scheduled operation of a transaction. OpIndex counts the transaction's operations from 0 in
+// the order they were scheduled, barriers and waits included.
+type Step struct {
+	TxnName string
+	OpIndex int
+}
+
+// ExecuteSchedule runs the database operations of the transactions named in steps one at a time, in the
+// order steps lists them, on the calling goroutine. The interleaving is fixed by steps alone, so the run is
+// reproducible: barriers, waits, sleeps and the commit order are not needed and are ignored, and a step
+// naming one does nothing. A step whose operation blocks, e.g. on a row lock another transaction holds, holds
+// up the whole run until it finishes, so a transaction that may block should have a timeout; see
+// Txn.SetTimeout.
+// It panics if steps are invalid; see ValidateSteps.
+func (e *TxnsExecutor) ExecuteSchedule(steps []Step, debug bool) *Results {
+	sched, err := e.stepSchedule(steps)
+	if err != nil {
+		panic(err)
+	}
+	log := e.runLogger(debug)
+	e.startRun(sched)
+	e.commits.reset(len(sched.txns))
+	for _, txn := range sched.txns {
+		txn.log = log
+	}
+
+	ctx := context.Background()
+	for _, step := range steps {
+		txn := sched.txns[step.TxnName]
+		op := txn.operations[step.OpIndex]
+		if op.kind != opDatabase {
+			log.Debug("SKIPPED, stepped schedule", "txn", txn.name, "op", op.opIndex)
+			continue
+		}
+		txn.runDatabaseOp(ctx, op, e.barriers, log)
+	}
+
+	e.finishRun()
+	return e.resultStore
+}
+
+// ValidateSteps checks that steps can be run by ExecuteSchedule: every step names a known transaction and
+// one of its operations, each transaction's steps come in the order its operations were scheduled, each
+// operation is named at most once, and every database operation of a transaction named in steps is named.
+// Parallel groups cannot be stepped. Transactions steps do not name are not run.
+func (e *TxnsExecutor) ValidateSteps(steps []Step) error {
+	_, err := e.stepSchedule(steps)
+	return err
+}
+
+// stepSchedule returns the transactions steps name, or an error if steps are invalid
+func (e *TxnsExecutor) stepSchedule(steps []Step) (schedule, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	sched := schedule{txns: make(map[string]*Txn), all: e.txns}
+	last := make(map[string]int) // txn name -> op index of its latest step
+	for i, step := range steps {
+		txn, ok := e.txns[step.TxnName]
+		if !ok {
+			return schedule{}, fmt.Errorf("step %d: unknown txn %s", i, step.TxnName)
+		}
+		if step.OpIndex < 0 || step.OpIndex >= len(txn.operations) {
+			return schedule{}, fmt.Errorf("step %d: txn %s has no op %d", i, step.TxnName, step.OpIndex)
+		}
+		if prev, ok := last[step.TxnName]; ok && step.OpIndex <= prev {
+			return schedule{}, fmt.Errorf("step %d: txn %s op %d comes after its op %d", i, step.TxnName, step.OpIndex, prev)
+		}
+		if txn.db == nil {
+			return schedule{}, fmt.Errorf("step %d: txn %s targets unknown database %q", i, step.TxnName, txn.dbName)
+		}
+		if txn.operations[step.OpIndex].kind == opParallel {
+			return schedule{}, fmt.Errorf("step %d: txn %s op %d is a parallel group, which cannot be stepped", i, step.TxnName, step.OpIndex)
+		}
+		last[step.TxnName] = step.OpIndex
+		sched.txns[step.TxnName] = txn
+	}
+
+	named := make(map[Step]bool, len(steps))
+	for _, step := range steps {
+		named[step] = true
+	}
+	for name, txn := range sched.txns {
+		for _, op := range txn.operations {
+			if (op.kind == opDatabase || op.kind == opParallel) && !named[Step{name, op.opIndex}] {
+				return schedule{}, fmt.Errorf("txn %s op %d (%s) is not stepped", name, op.opIndex, op.description)
+			}
+		}
+	}
+	return sched, nil
+}
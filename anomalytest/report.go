@@ -0,0 +1,93 @@
+package anomalytest
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// opRecord is a database operation as it was executed, for Report
+type opRecord struct {
+	op   operation
+	err  error
+	note string // why the operation did not run, if it did not
+}
+
+// isWrite reports whether an operation changes data
+func isWrite(opName string) bool {
+	switch opName {
+	case OpSet, OpSetMany, OpDelete, OpIncrement, OpWriteLock:
+		return true
+	}
+	return false
+}
+
+// Report writes a human-readable summary of the run to w: for each transaction in name order, its outcome
+// and the database operations it ran, with the value of every read and the error of every failed operation,
+// followed by the final contents of each database that implements StateInspector.
+func (r *Results) Report(w io.Writer) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.ops))
+	for name := range r.ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ew := &errWriter{w: w}
+	for _, name := range names {
+		ew.printf("txn %s: %s\n", name, r.outcomes[name])
+		for _, record := range r.ops[name] {
+			op := record.op
+			switch {
+			case record.note != "":
+				ew.printf("  (%d)       %s  [%s]\n", op.opIndex, op.description, record.note)
+			case record.err != nil:
+				ew.printf("  (%d)       %s  ERROR: %v\n", op.opIndex, op.description, record.err)
+			case op.name == OpGet || op.name == OpSum:
+				ew.printf("  (%d) read  %s -> %d\n", op.opIndex, op.description, r.data[name][op.opIndex])
+			case op.name == OpGetByValue:
+				ew.printf("  (%d) read  %s -> %v\n", op.opIndex, op.description, r.keys[name][op.opIndex])
+			case op.name == OpScan:
+				ew.printf("  (%d) read  %s -> %v\n", op.opIndex, op.description, r.rows[name][op.opIndex])
+			case isWrite(op.name):
+				ew.printf("  (%d) write %s\n", op.opIndex, op.description)
+			default:
+				ew.printf("  (%d)       %s\n", op.opIndex, op.description)
+			}
+		}
+	}
+
+	dbNames := make([]string, 0, len(r.finalStates))
+	for name := range r.finalStates {
+		dbNames = append(dbNames, name)
+	}
+	sort.Strings(dbNames)
+	for _, dbName := range dbNames {
+		state := r.finalStates[dbName]
+		keys := make([]int, 0, len(state))
+		for key := range state {
+			keys = append(keys, key)
+		}
+		sort.Ints(keys)
+		ew.printf("final state of %s:\n", dbName)
+		for _, key := range keys {
+			ew.printf("  %d = %d\n", key, state[key])
+		}
+	}
+	return ew.err
+}
+
+// errWriter remembers the first write error so that Report can print unconditionally
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...any) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
@@ -0,0 +1,159 @@
+package anomalytest
+
+import "slices"
+
+// accessKind is what an access in Results.history did
+type accessKind int
+
+const (
+	accessRead accessKind = iota
+	accessWrite
+	accessCommit
+)
+
+// access is a successful read, write or commit, as recorded for SerializationOrder
+type access struct {
+	kind    accessKind
+	txnName string
+	dbName  string
+	key     int
+	value   int  // value read or written
+	known   bool // whether value is known; an Increment does not return the value it wrote
+}
+
+// recordAccess appends an access by t to the run's history
+func (t *Txn) recordAccess(kind accessKind, key, value int, known bool) {
+	t.executor.resultStore.recordAccess(access{kind: kind, txnName: t.name, dbName: t.dbName, key: key, value: value, known: known})
+}
+
+func (r *Results) recordAccess(a access) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.history = append(r.history, a)
+}
+
+// dataItem identifies a key in one of the executor's databases
+type dataItem struct {
+	dbName string
+	key    int
+}
+
+// SerializationOrder returns a serial order of the committed transactions that the run is equivalent to,
+// or nil if there is none. It builds the dependency graph of the committed transactions from the reads
+// and writes in the order they returned:
+//   - ww: a transaction that overwrote a key depends on the committed transaction that wrote it before
+//   - wr: a read depends on the write it saw, the latest earlier write of the same value to the key
+//   - rw: a transaction that overwrote the version a read saw depends on the reader
+//
+// and sorts it topologically, breaking ties by commit order, so the order only departs from commit order
+// where a dependency requires it. A cycle means the history is not serializable and yields nil.
+//
+// The order of the writes to a key is taken to be the order in which they returned, which holds for
+// databases that apply a write before returning from it.
+func (r *Results) SerializationOrder() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	commitPos := make(map[string]int)
+	for _, a := range r.history {
+		if a.kind == accessCommit {
+			commitPos[a.txnName] = len(commitPos)
+		}
+	}
+	committed := func(name string) bool {
+		_, ok := commitPos[name]
+		return ok
+	}
+
+	// Version order of each key: its committed writers, by the position of their last write to it
+	lastWrite := make(map[dataItem]map[string]int)
+	for i, a := range r.history {
+		if a.kind == accessWrite && committed(a.txnName) {
+			item := dataItem{a.dbName, a.key}
+			if lastWrite[item] == nil {
+				lastWrite[item] = make(map[string]int)
+			}
+			lastWrite[item][a.txnName] = i
+		}
+	}
+	versions := make(map[dataItem][]string, len(lastWrite))
+	for item, writers := range lastWrite {
+		for name := range writers {
+			versions[item] = append(versions[item], name)
+		}
+		slices.SortFunc(versions[item], func(a, b string) int { return writers[a] - writers[b] })
+	}
+
+	edges := make(map[string]map[string]bool)
+	addEdge := func(from, to string) {
+		if from == to {
+			return
+		}
+		if edges[from] == nil {
+			edges[from] = make(map[string]bool)
+		}
+		edges[from][to] = true
+	}
+	for _, order := range versions {
+		for i := 1; i < len(order); i++ {
+			addEdge(order[i-1], order[i])
+		}
+	}
+	for i, a := range r.history {
+		if a.kind != accessRead || !committed(a.txnName) {
+			continue
+		}
+		item := dataItem{a.dbName, a.key}
+		source := "" // the initial version
+		for j := i - 1; j >= 0; j-- {
+			w := r.history[j]
+			if w.kind == accessWrite && w.dbName == a.dbName && w.key == a.key && (!w.known || w.value == a.value) {
+				source = w.txnName
+				break
+			}
+		}
+		if source == a.txnName {
+			continue // read its own write
+		}
+		next := 0
+		if source != "" {
+			if !committed(source) {
+				continue // a dirty read of a write that never committed is not an edge between committed txns
+			}
+			addEdge(source, a.txnName)
+			next = slices.Index(versions[item], source) + 1
+		}
+		if next < len(versions[item]) {
+			addEdge(a.txnName, versions[item][next])
+		}
+	}
+
+	// Kahn's algorithm, taking the ready transaction that committed first
+	inDegree := make(map[string]int, len(commitPos))
+	for name := range commitPos {
+		inDegree[name] = 0
+	}
+	for _, targets := range edges {
+		for to := range targets {
+			inDegree[to]++
+		}
+	}
+	var order []string
+	for len(order) < len(commitPos) {
+		next := ""
+		for name, degree := range inDegree {
+			if degree == 0 && (next == "" || commitPos[name] < commitPos[next]) {
+				next = name
+			}
+		}
+		if next == "" {
+			return nil // every remaining transaction is on or behind a cycle
+		}
+		order = append(order, next)
+		delete(inDegree, next)
+		for to := range edges[next] {
+			inDegree[to]--
+		}
+	}
+	return order
+}
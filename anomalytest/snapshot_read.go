@@ -0,0 +1,79 @@
+package anomalytest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// snapshotWriters is the number of writers that commit while TestSnapshotReadConsistency's reader is open
+const snapshotWriters = 5
+
+// TestSnapshotReadConsistency tests that a read-only snapshot transaction, begun with BeginSnapshot,
+// sees one stable view of the data while writers commit around it, and never blocks them.
+//
+// Setup: key 1 = 10, key 2 = 20
+//
+//	reporter: begin snapshot; read keys 1 and 2
+//	writer i, for i = 1..5: set key 1 = 10+i, key 2 = 20+i; commit
+//	reporter: read keys 1 and 2 again after each writer commits -- still 10 and 20
+//	reporter: commit
+//
+// Each writer has a timeout, so a writer blocked by the reporter fails the test instead of hanging it.
+// Skipped for databases without CapMVCC.
+func TestSnapshotReadConsistency(t *testing.T, db Database) {
+	exec := NewTxnsExecutor(db)
+
+	setup := exec.NewTxn("setup")
+	setup.BeginTx()
+	setup.Set(1, 10)
+	setup.Set(2, 20)
+	setup.Commit()
+	setup.Barrier("setup_committed")
+
+	reporter := exec.NewTxn("reporter")
+	reporter.WaitFor("setup_committed")
+	reporter.BeginSnapshot()
+	selectAll(reporter)
+	reporter.Barrier("reporter_began")
+	for i := 1; i <= snapshotWriters; i++ {
+		writer := exec.NewTxn(fmt.Sprintf("writer%d", i))
+		writer.SetTimeout(hermitageBlockTimeout)
+		writer.WaitFor("reporter_began")
+		if i > 1 {
+			writer.WaitFor(fmt.Sprintf("writer%d_committed", i-1))
+		}
+		writer.BeginTx()
+		writer.Set(1, 10+i)
+		writer.Set(2, 20+i)
+		writer.Commit()
+		writer.Barrier(fmt.Sprintf("writer%d_committed", i))
+
+		reporter.WaitFor(fmt.Sprintf("writer%d_committed", i))
+		selectAll(reporter)
+	}
+	reporter.Commit()
+	reporter.Barrier("reporter_committed")
+
+	check := exec.NewTxn("check")
+	check.WaitFor("reporter_committed")
+	check.BeginTx()
+	selectAll(check)
+	check.Commit()
+
+	RequireScheduleCapabilities(t, exec)
+	results := exec.Execute(true)
+
+	for i, read := range exec.Reads("reporter") {
+		assert.Equal(t, []int{10, 20}[i%2], results.GetValue(read), "reporter read %d should come from its snapshot", i)
+	}
+	for i := 1; i <= snapshotWriters; i++ {
+		name := fmt.Sprintf("writer%d", i)
+		assert.Equal(t, OutcomeCommitted, results.Outcome(name), "%s should not be blocked or aborted by the reporter", name)
+	}
+	assert.Equal(t, OutcomeCommitted, results.Outcome("reporter"))
+	reads := exec.Reads("check")
+	assert.Equal(t, 10+snapshotWriters, results.GetValue(reads[0]))
+	assert.Equal(t, 20+snapshotWriters, results.GetValue(reads[1]))
+}
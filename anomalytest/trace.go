@@ -0,0 +1,129 @@
+package anomalytest
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Kinds of trace events for operations other than database operations, whose events have their Op* name
+const (
+	TraceBarrier       = "barrier"
+	TraceWaitFor       = "wait_for"
+	TraceWaitOrTimeout = "wait_for_with_timeout"
+	TraceCommitCount   = "wait_for_commit_count"
+	TraceParallel      = "parallel"
+	TraceSleep         = "sleep"
+	TraceLockWait      = "lock_wait"     // a row lock request started waiting; see LockObserver
+	TraceLockAcquired  = "lock_acquired" // a row lock request that waited was granted
+)
+
+// TraceEvent is one operation that ran during a traced execution
+type TraceEvent struct {
+	Time        time.Time // when the operation finished
+	TxnName     string
+	OpIndex     int
+	Kind        string // the Op* name of a database operation, or one of the Trace* kinds
+	Description string
+	Barrier     string // the barrier a Barrier signaled or a wait waited for, "" for other operations
+	TimedOut    bool   // for a WaitForWithTimeout, whether it gave up waiting
+	Key         int    // for a lock event, the key of the row lock
+	Err         error  // for a database operation, the error it returned
+}
+
+// tracer collects the trace events of a run, for Trace
+type tracer struct {
+	mu      sync.Mutex
+	enabled bool
+	events  []TraceEvent
+}
+
+// reset drops the events of the previous run
+func (tr *tracer) reset() {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.events = nil
+}
+
+// record appends event, stamped with the current time, if tracing is enabled
+func (tr *tracer) record(event TraceEvent) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if !tr.enabled {
+		return
+	}
+	event.Time = time.Now()
+	tr.events = append(tr.events, event)
+}
+
+// lockObserver records the lock waits a LockObservable database reports during a traced run, as events of
+// the operation each transaction is running
+type lockObserver struct {
+	e      *TxnsExecutor
+	dbName string
+	txns   map[string]*Txn
+}
+
+func (o lockObserver) OnLockWait(txId int64, key int) {
+	o.record(txId, key, TraceLockWait, "LOCK_WAIT")
+}
+
+func (o lockObserver) OnLockAcquired(txId int64, key int) {
+	o.record(txId, key, TraceLockAcquired, "LOCK_ACQUIRED")
+}
+
+func (o lockObserver) record(txId int64, key int, kind, label string) {
+	name, ok := o.e.resultStore.txnName(o.dbName, txId)
+	if !ok {
+		return // not a transaction of this run
+	}
+	event := TraceEvent{TxnName: name, Kind: kind, Key: key, Description: fmt.Sprintf("%s %d", label, key)}
+	if txn, ok := o.txns[name]; ok {
+		event.OpIndex = txn.progress.current().opIndex
+	}
+	o.e.tracer.record(event)
+}
+
+// observeLocks makes every LockObservable database report its lock waits to the trace during a run of
+// sched, if tracing is enabled
+func (e *TxnsExecutor) observeLocks(sched schedule) {
+	e.tracer.mu.Lock()
+	enabled := e.tracer.enabled
+	e.tracer.mu.Unlock()
+	if !enabled {
+		return
+	}
+	for name, db := range e.dbs {
+		if observable, ok := db.(LockObservable); ok {
+			observable.SetLockObserver(lockObserver{e: e, dbName: name, txns: sched.txns})
+		}
+	}
+}
+
+// stopObservingLocks detaches the observers observeLocks set
+func (e *TxnsExecutor) stopObservingLocks() {
+	for _, db := range e.dbs {
+		if observable, ok := db.(LockObservable); ok {
+			observable.SetLockObserver(nil)
+		}
+	}
+}
+
+// SetTracing turns on or off the recording of the operations each run executes, for Trace. It takes effect
+// from the next run.
+func (e *TxnsExecutor) SetTracing(enabled bool) {
+	e.tracer.mu.Lock()
+	defer e.tracer.mu.Unlock()
+	e.tracer.enabled = enabled
+}
+
+// Trace returns the operations the latest run executed, in the order they finished, if tracing was enabled
+// for it; see SetTracing. The lock waits of a LockObservable database are included as TraceLockWait and
+// TraceLockAcquired events of the operation that waited. Operations that were skipped, because their transaction had been aborted or their
+// database lacks a capability, and operations cut short by a cancelled run are left out.
+func (e *TxnsExecutor) Trace() []TraceEvent {
+	e.tracer.mu.Lock()
+	defer e.tracer.mu.Unlock()
+	return slices.Clone(e.tracer.events)
+}
@@ -1,7 +1,14 @@
 package anomalytest
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 )
@@ -14,6 +21,36 @@ const (
 	opBarrier                          // Barrier - signals a named synchronization point
 	opWaitFor                          // WaitFor - waits for a named barrier
 	opWaitForWithTimeout               // WaitFor with timeout - continues after timeout if barrier not signaled
+	opWaitForCommitCount               // WaitForCommitCount - waits until a number of transactions have committed
+	opParallel                         // Parallel - runs groups of database operations concurrently
+	opSleep                            // Sleep - pauses the transaction for a fixed time
+)
+
+// Names of database operations, used as keys for per-operation metrics
+const (
+	OpBegin      = "begin"
+	OpSnapshot   = "begin_snapshot"
+	OpSet        = "set"
+	OpSetMany    = "set_many"
+	OpIncrement  = "increment"
+	OpGet        = "get"
+	OpGetByValue = "get_by_value"
+	OpSum        = "sum"
+	OpScan       = "scan"
+	OpDelete     = "delete"
+	OpCommit     = "commit"
+	OpRollback   = "rollback"
+	OpSavepoint  = "savepoint"
+	OpRollbackTo = "rollback_to_savepoint"
+	OpAssert     = "assert"
+	OpAssertLock = "assert_holds_lock"
+	OpLock       = "acquire_lock"
+	OpWriteSet   = "declare_write_set"
+	OpWriteLock  = "write_locked"
+	OpCheckpoint = "checkpoint"
+	OpVersions   = "version_history"
+	OpPrintState = "print_db_state"
+	OpHistory    = "print_history"
 )
 
 // GetResult is a reference to a Get operation's result
@@ -22,12 +59,47 @@ type GetResult struct {
 	opIndex int
 }
 
+// KeysResult is a reference to a GetByValue operation's result
+type KeysResult struct {
+	txnName string
+	opIndex int
+}
+
+// ScanResult is a reference to a Scan operation's result
+type ScanResult struct {
+	txnName string
+	opIndex int
+}
+
+// LockResult is a reference to an operation that takes a row lock in a locking database: Set, Delete or AcquireLock
+type LockResult struct {
+	txnName string
+	opIndex int
+}
+
+// WaitResult is a reference to a WaitForOrTimeout operation's result
+type WaitResult struct {
+	txnName string
+	opIndex int
+}
+
+// VersionHistoryResult is a reference to a VersionHistory operation's result
+type VersionHistoryResult struct {
+	txnName string
+	opIndex int
+}
+
 // operation represents a single operation in a transaction
 type operation struct {
 	kind        opKind
+	name        string        // For database operations, one of the Op* names
 	fn          func() error  // For database operations
+	requires    Capability    // For database operations that only make sense on some databases
 	barrierName string        // For Barrier and WaitFor operations
-	timeout     time.Duration // For WaitForWithTimeout operations
+	timeout     time.Duration // For WaitForWithTimeout operations, and how long a Sleep lasts
+	count       int           // For WaitForCommitCount operations
+	branches    []*Txn        // For Parallel operations, one sub-transaction per concurrent group
+	onAbort     func()        // For CommitOrElse, run if the commit fails with ErrAborted
 	opIndex     int           // Index of this operation in the transaction
 	description string        // Human-readable description for debug output
 }
@@ -44,31 +116,62 @@ type Database interface {
 
 // TxnsExecutor coordinates the execution of multiple transactions with barrier-based synchronization
 type TxnsExecutor struct {
-	db          Database
+	dbs         map[string]Database // named databases, including the one passed to NewTxnsExecutor under DefaultDatabase
 	txns        map[string]*Txn
 	barriers    map[string]chan struct{}
+	countdowns  map[string]*barrierCountdown // BarrierN name -> signals it still needs in the current run
 	resultStore *Results
+	runTxns     map[string]*Txn // transactions of the current or latest run, for Stats
+	commitOrder []string        // names of transactions whose commits must happen in this order
+	commits     commitTracker
+	tracer      tracer
+	logger      Logger // nil means DefaultLogger, at Debug level when executing with debug
+	commitHooks []func(txnName string)
+	abortHooks  []func(txnName string)
+	hookMu      sync.Mutex // serializes hook calls
 	mu          sync.Mutex
 }
 
 // NewTxnsExecutor creates a new transaction executor
 func NewTxnsExecutor(db Database) *TxnsExecutor {
 	return &TxnsExecutor{
-		db:          db,
+		dbs:         map[string]Database{DefaultDatabase: db},
 		txns:        make(map[string]*Txn),
 		barriers:    make(map[string]chan struct{}),
 		resultStore: newResults(),
 	}
 }
 
-// NewTxn creates a new transaction handle
+// DefaultDatabase is the name under which the database passed to NewTxnsExecutor is registered
+const DefaultDatabase = "default"
+
+// AddDatabase registers another database under name, for transactions created with NewTxnOn.
+// Transactions on different databases are independent: nothing makes their commits atomic.
+func (e *TxnsExecutor) AddDatabase(name string, db Database) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.dbs[name] = db
+}
+
+// NewTxn creates a new transaction handle on the default database. It panics if name is already taken.
 func (e *TxnsExecutor) NewTxn(name string) *Txn {
+	return e.NewTxnOn(name, DefaultDatabase)
+}
+
+// NewTxnOn creates a new transaction handle whose operations all go to the database registered as dbName.
+// An unknown dbName is reported by Validate. It panics if a transaction called name already exists, since
+// results are looked up by transaction name.
+func (e *TxnsExecutor) NewTxnOn(name string, dbName string) *Txn {
 	e.mu.Lock()
 	defer e.mu.Unlock()
+	if _, exists := e.txns[name]; exists {
+		panic(fmt.Sprintf("NewTxn %q: a transaction with this name already exists", name))
+	}
 	txn := &Txn{
 		name:       name,
 		executor:   e,
-		db:         e.db,
+		db:         e.dbs[dbName],
+		dbName:     dbName,
 		operations: []operation{},
 		opCounter:  0,
 	}
@@ -76,91 +179,677 @@ func (e *TxnsExecutor) NewTxn(name string) *Txn {
 	return txn
 }
 
-// Execute runs all scheduled transactions concurrently with barrier-based coordination
+// Reads returns references to all Get operations scheduled on the named transaction, in schedule order.
+// This lets callers that did not build the schedule themselves (e.g. shared schedule builders) look up read results.
+func (e *TxnsExecutor) Reads(txnName string) []*GetResult {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	txn, ok := e.txns[txnName]
+	if !ok {
+		return nil
+	}
+	return append([]*GetResult(nil), txn.reads...)
+}
+
+// RequiredCapabilities returns the capabilities needed by all operations scheduled so far, for each
+// database name that has transactions
+func (e *TxnsExecutor) RequiredCapabilities() map[string]Capability {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	caps := make(map[string]Capability)
+	for _, txn := range e.txns {
+		for _, op := range txn.operations {
+			caps[txn.dbName] |= op.requires
+			for _, branch := range op.branches {
+				for _, branchOp := range branch.operations {
+					caps[txn.dbName] |= branchOp.requires
+				}
+			}
+		}
+	}
+	return caps
+}
+
+// SetLogger sets the logger used while executing. Per-operation tracing is logged at Debug level,
+// and only when Execute is called with debug set; failed operations are logged at Error level.
+func (e *TxnsExecutor) SetLogger(logger Logger) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.logger = logger
+}
+
+// OnCommit registers fn to be called with a transaction's name right after its commit succeeds. It is called
+// on the transaction's goroutine, before the transaction goes on, so a hook sees commits in the order they
+// happened. Calls to all hooks are serialized, so hooks need no locking of their own.
+func (e *TxnsExecutor) OnCommit(fn func(txnName string)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.commitHooks = append(e.commitHooks, fn)
+}
+
+// OnAbort registers fn to be called with a transaction's name right after it is rolled back: by its own
+// Rollback, or because the database or the executor aborted it, e.g. on a deadlock or a timeout. A
+// transaction that is retried after a failure calls it once for each failed attempt. Like OnCommit hooks,
+// abort hooks are called on the transaction's goroutine and never concurrently with another hook.
+func (e *TxnsExecutor) OnAbort(fn func(txnName string)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.abortHooks = append(e.abortHooks, fn)
+}
+
+// runHooks calls each commit hook, or each abort hook, in turn with txnName
+func (e *TxnsExecutor) runHooks(committed bool, txnName string) {
+	e.mu.Lock()
+	hooks := e.abortHooks
+	if committed {
+		hooks = e.commitHooks
+	}
+	hooks = slices.Clone(hooks)
+	e.mu.Unlock()
+	e.hookMu.Lock()
+	defer e.hookMu.Unlock()
+	for _, hook := range hooks {
+		hook(txnName)
+	}
+}
+
+// withoutDebug drops Debug records, so that a caller's logger only sees tracing when debug is requested
+type withoutDebug struct {
+	Logger
+}
+
+func (withoutDebug) Debug(msg string, args ...any) {}
+
+// SetCommitOrder makes the named transactions commit in the given order: each one's Commit waits until
+// the previous one's Commit has completed. Only the commits are ordered; the other operations still run
+// as the barriers allow. Each named transaction must schedule exactly one Commit.
+func (e *TxnsExecutor) SetCommitOrder(names ...string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.commitOrder = append([]string(nil), names...)
+}
+
+// commitOrderBarrier is the internal barrier signaled once the named transaction's commit has completed
+func commitOrderBarrier(txnName string) string {
+	return "commit_order:" + txnName
+}
+
+// ExecuteN builds and executes a schedule n times, each time against a fresh database from factory,
+// and returns the results of every run in order. Since each run builds the same schedule, a GetResult
+// taken from any run refers to the same read in all of them.
+func ExecuteN(factory func() Database, build ScheduleBuilder, n int, debug bool) []*Results {
+	results := make([]*Results, n)
+	for i := range results {
+		results[i] = build(factory()).Execute(debug)
+	}
+	return results
+}
+
+// schedule is the set of transactions an execution runs, with the commit order among them
+type schedule struct {
+	txns        map[string]*Txn
+	commitOrder []string
+	all         map[string]*Txn // every transaction on the executor, including ones left out of txns
+}
+
+// fullSchedule returns every transaction created on the executor
+func (e *TxnsExecutor) fullSchedule() schedule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return schedule{txns: e.txns, commitOrder: e.commitOrder, all: e.txns}
+}
+
+// subsetSchedule returns only the named transactions. The commit order is kept for the transactions
+// that are included.
+func (e *TxnsExecutor) subsetSchedule(names []string) (schedule, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	sched := schedule{txns: make(map[string]*Txn, len(names)), all: e.txns}
+	for _, name := range names {
+		txn, ok := e.txns[name]
+		if !ok {
+			return schedule{}, fmt.Errorf("unknown txn %s", name)
+		}
+		sched.txns[name] = txn
+	}
+	for _, name := range e.commitOrder {
+		if _, ok := sched.txns[name]; ok {
+			sched.commitOrder = append(sched.commitOrder, name)
+		}
+	}
+	return sched, nil
+}
+
+// Execute runs all scheduled transactions concurrently with barrier-based coordination.
+// It panics if the schedule is invalid; see Validate.
 func (e *TxnsExecutor) Execute(debug bool) *Results {
-	// Phase 1: Register all barriers
-	e.registerBarriers()
+	sched := e.fullSchedule()
+	if err := sched.validate(); err != nil {
+		panic(err)
+	}
+	return e.execute(context.Background(), sched, debug)
+}
+
+// ExecuteContext runs all scheduled transactions like Execute, but stops early if ctx is cancelled.
+// On cancellation every transaction that has begun but not yet committed or rolled back is rolled back,
+// releasing its locks, and its outcome is recorded as OutcomeAborted before ExecuteContext returns.
+// Operations that had not started when ctx was cancelled are not run.
+func (e *TxnsExecutor) ExecuteContext(ctx context.Context, debug bool) *Results {
+	sched := e.fullSchedule()
+	if err := sched.validate(); err != nil {
+		panic(err)
+	}
+	return e.execute(ctx, sched, debug)
+}
+
+// ExecuteWithTimeout runs all scheduled transactions like Execute, but gives up after d. On timeout the run
+// is cancelled as by ExecuteContext, and the error lists every transaction that had not finished, with the
+// operation it was running and the barrier it was waiting for, if any. An invalid schedule is returned as
+// an error instead of a panic; see Validate.
+func (e *TxnsExecutor) ExecuteWithTimeout(d time.Duration, debug bool) (*Results, error) {
+	sched := e.fullSchedule()
+	if err := sched.validate(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stuck := make(chan []string, 1)
+	timer := time.AfterFunc(d, func() {
+		stuck <- sched.unfinished() // before cancelling, which unblocks everything
+		cancel()
+	})
+	results := e.execute(ctx, sched, debug)
+	if timer.Stop() {
+		return results, nil
+	}
+	if unfinished := <-stuck; len(unfinished) > 0 {
+		return results, fmt.Errorf("execution timed out after %v: %s", d, strings.Join(unfinished, "; "))
+	}
+	return results, nil // the timer fired just as the run finished
+}
+
+// ExecuteSubset runs only the named transactions, ignoring the rest of the schedule, which helps
+// bisect which transactions cause a hang or an anomaly. It panics if the subset is invalid; see ValidateSubset.
+func (e *TxnsExecutor) ExecuteSubset(names []string, debug bool) *Results {
+	sched, err := e.subsetSchedule(names)
+	if err == nil {
+		err = sched.validate()
+	}
+	if err != nil {
+		panic(fmt.Errorf("subset %v: %w", names, err))
+	}
+	return e.execute(context.Background(), sched, debug)
+}
+
+// runLogger returns the logger a run writes to
+func (e *TxnsExecutor) runLogger(debug bool) Logger {
+	log := e.logger
+	switch {
+	case log == nil && debug:
+		log = NewSlogLogger(os.Stdout, slog.LevelDebug)
+	case log == nil:
+		log = DefaultLogger()
+	case !debug:
+		log = withoutDebug{log}
+	}
+	return log
+}
+
+// startRun gives the run fresh results and forgets what the transactions were assigned in an earlier run
+func (e *TxnsExecutor) startRun(sched schedule) {
+	e.mu.Lock()
+	e.resultStore = newResults()
+	e.runTxns = sched.txns
+	e.mu.Unlock()
+	e.tracer.reset()
+	for _, txn := range sched.txns {
+		txn.txnId, txn.begun, txn.aborted = 0, false, false
+		txn.progress.reset()
+		txn.commitAfter, txn.commitSignal = "", "" // rewired by wireCommitOrder, in case the commit order changed
+	}
+	e.observeLocks(sched)
+}
+
+// finishRun stores what the databases report at the end of a run
+func (e *TxnsExecutor) finishRun() {
+	e.stopObservingLocks()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for name, db := range e.dbs {
+		if inspector, ok := db.(StateInspector); ok {
+			e.resultStore.storeFinalState(name, inspector.State())
+		}
+		if inspector, ok := db.(UnblockInspector); ok {
+			e.resultStore.storeUnblocked(name, inspector)
+		}
+	}
+}
+
+// execute runs a validated schedule until it completes or ctx is cancelled
+func (e *TxnsExecutor) execute(ctx context.Context, sched schedule, debug bool) *Results {
+	log := e.runLogger(debug)
+
+	// Phase 1: Start from fresh results and register all barriers
+	e.startRun(sched)
+	e.registerBarriers(sched.txns)
+	e.wireCommitOrder(sched)
+	e.commits.reset(len(sched.txns))
 
 	// Phase 2: Start transaction goroutines
 	var wg sync.WaitGroup
-	for _, txn := range e.txns {
+	for _, txn := range sched.txns {
 		wg.Add(1)
 		go func(t *Txn) {
 			defer wg.Done()
-			t.run(e.barriers, debug)
+			defer e.commits.finish()
+			t.run(ctx, e.barriers, log)
 		}(txn)
 	}
 
 	// Phase 3: Wait for all transactions to complete
 	wg.Wait()
 
+	e.finishRun()
 	return e.resultStore
 }
 
-// registerBarriers scans all transactions and creates channels for all barrier names
-func (e *TxnsExecutor) registerBarriers() {
-	for _, txn := range e.txns {
+// Reset prepares the executor's databases for running the schedule again: every database that implements
+// Resetter is emptied and restarts its transaction ids, so ids from an earlier run cannot be mistaken for
+// transactions of the next one. Each run already starts with fresh Results and forgets the ids its
+// transactions were assigned before. Reset must not be called while a run is in progress.
+func (e *TxnsExecutor) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, db := range e.dbs {
+		if resetter, ok := db.(Resetter); ok {
+			resetter.Reset()
+		}
+	}
+}
+
+// registerBarriers scans the given transactions and creates channels for all barrier names, and
+// countdowns for those signaled with BarrierN
+func (e *TxnsExecutor) registerBarriers(txns map[string]*Txn) {
+	e.countdowns = make(map[string]*barrierCountdown)
+	for _, txn := range txns {
 		for _, op := range txn.operations {
 			if op.kind == opBarrier {
 				e.barriers[op.barrierName] = make(chan struct{})
+				if op.count > 0 {
+					e.countdowns[op.barrierName] = &barrierCountdown{remaining: op.count}
+				}
 			}
 		}
 	}
 }
 
+// barrierCountdown counts the signals a BarrierN barrier still needs before it is released
+type barrierCountdown struct {
+	mu        sync.Mutex
+	remaining int
+}
+
+// signal records one signal and reports whether it was the last one needed. Signals beyond that are ignored.
+func (c *barrierCountdown) signal() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remaining--
+	return c.remaining == 0
+}
+
+// wireCommitOrder makes each transaction in the commit order wait for its predecessor's commit
+func (e *TxnsExecutor) wireCommitOrder(sched schedule) {
+	for i, name := range sched.commitOrder {
+		txn := sched.txns[name]
+		txn.commitSignal = commitOrderBarrier(name)
+		e.barriers[txn.commitSignal] = make(chan struct{})
+		if i > 0 {
+			txn.commitAfter = commitOrderBarrier(sched.commitOrder[i-1])
+		}
+	}
+}
+
 // Txn represents a transaction handle with direct operation methods
 type Txn struct {
 	name       string
 	executor   *TxnsExecutor
 	db         Database
+	dbName     string
 	txnId      int64
 	operations []operation
 	opCounter  int
-	mu         sync.Mutex
+	reads      []*GetResult // references to this transaction's Get results, in schedule order
+
+	// Set by SetCommitOrder
+	commitAfter  string // barrier to wait for before committing
+	commitSignal string // barrier to signal after committing
+
+	timeout    time.Duration // bound on each database operation, 0 for none
+	maxRetries int           // times a retryable failure reruns the transaction, set by WithRetry
+	retries    int           // times it has been rerun in the current run
+	lastErr    error         // error of the latest database operation
+	begun      bool          // set once BeginTx has succeeded
+	aborted    bool          // set once the executor has rolled the transaction back
+	signaled   map[int]bool  // op index -> Barrier already signaled in the current run, by an attempt that was retried
+
+	log      Logger      // set when the transaction starts running
+	progress txnProgress // what it is doing, for ExecuteWithTimeout
+
+	mu sync.Mutex
 }
 
-// run executes all operations for this transaction sequentially
-func (t *Txn) run(barriers map[string]chan struct{}, debug bool) {
-	for _, op := range t.operations {
+// run executes all operations for this transaction sequentially, stopping early if ctx is cancelled
+func (t *Txn) run(ctx context.Context, barriers map[string]chan struct{}, log Logger) {
+	t.log = log
+	t.retries = 0
+	t.signaled = make(map[int]bool)
+	defer t.progress.finish()
+	for i := 0; i < len(t.operations); i++ {
+		op := t.operations[i]
+		if ctx.Err() != nil {
+			t.shutdown(op, log)
+			return
+		}
+		switch {
+		case op.kind == opWaitFor || op.kind == opWaitForWithTimeout:
+			t.progress.start(op, op.barrierName)
+		case op.name == OpCommit && t.commitAfter != "":
+			t.progress.start(op, t.commitAfter)
+		default:
+			t.progress.start(op, "")
+		}
 		switch op.kind {
 		case opDatabase:
-			if debug {
-				fmt.Printf("[%s] (%d) %s\n", t.name, op.opIndex, op.description)
+			if !t.runDatabaseOp(ctx, op, barriers, log) {
+				return
 			}
-			if err := op.fn(); err != nil {
-				fmt.Printf("Error in transaction %s at op %d: %v\n", t.name, op.opIndex, err)
+			if t.aborted && t.retries < t.maxRetries && IsRetryable(t.lastErr) {
+				i = t.restart(op, log) - 1
 			}
 		case opBarrier:
-			if debug {
-				fmt.Printf("[%s] (%d) BARRIER %s\n", t.name, op.opIndex, op.barrierName)
+			log.Debug("BARRIER", "txn", t.name, "op", op.opIndex, "barrier", op.barrierName)
+			if !t.signaled[op.opIndex] {
+				t.signaled[op.opIndex] = true
+				if op.count == 0 || t.executor.countdowns[op.barrierName].signal() {
+					close(barriers[op.barrierName])
+				}
 			}
-			close(barriers[op.barrierName])
+			t.trace(op, TraceBarrier, func(event *TraceEvent) { event.Barrier = op.barrierName })
 		case opWaitFor:
-			if debug {
-				fmt.Printf("[%s] (%d) WAIT_FOR %s\n", t.name, op.opIndex, op.barrierName)
-			}
-			<-barriers[op.barrierName]
-			if debug {
-				fmt.Printf("[%s] (%d) UNBLOCKED from %s\n", t.name, op.opIndex, op.barrierName)
+			log.Debug("WAIT_FOR", "txn", t.name, "op", op.opIndex, "barrier", op.barrierName)
+			start := time.Now()
+			select {
+			case <-barriers[op.barrierName]:
+			case <-ctx.Done():
+				t.shutdown(op, log)
+				return
 			}
+			t.progress.unblock()
+			t.executor.resultStore.recordBarrierWait(op.barrierName, time.Since(start))
+			t.trace(op, TraceWaitFor, func(event *TraceEvent) { event.Barrier = op.barrierName })
+			log.Debug("UNBLOCKED", "txn", t.name, "op", op.opIndex, "barrier", op.barrierName)
 		case opWaitForWithTimeout:
-			if debug {
-				fmt.Printf("[%s] (%d) WAIT_FOR_WITH_TIMEOUT %s (%v)\n", t.name, op.opIndex, op.barrierName, op.timeout)
-			}
+			log.Debug("WAIT_FOR_WITH_TIMEOUT", "txn", t.name, "op", op.opIndex, "barrier", op.barrierName, "timeout", op.timeout)
+			start := time.Now()
+			timedOut := false
 			select {
 			case <-barriers[op.barrierName]:
-				if debug {
-					fmt.Printf("[%s] (%d) UNBLOCKED from %s (barrier signaled)\n", t.name, op.opIndex, op.barrierName)
-				}
+				log.Debug("UNBLOCKED", "txn", t.name, "op", op.opIndex, "barrier", op.barrierName)
 			case <-time.After(op.timeout):
-				if debug {
-					fmt.Printf("[%s] (%d) TIMEOUT waiting for %s (continuing)\n", t.name, op.opIndex, op.barrierName)
-				}
+				log.Debug("TIMEOUT, continuing", "txn", t.name, "op", op.opIndex, "barrier", op.barrierName)
+				timedOut = true
+			case <-ctx.Done():
+				t.shutdown(op, log)
+				return
+			}
+			t.progress.unblock()
+			t.executor.resultStore.recordWaitOutcome(t.name, op.opIndex, timedOut)
+			t.executor.resultStore.recordBarrierWait(op.barrierName, time.Since(start))
+			t.trace(op, TraceWaitOrTimeout, func(event *TraceEvent) {
+				event.Barrier, event.TimedOut = op.barrierName, timedOut
+			})
+		case opParallel:
+			log.Debug("PARALLEL", "txn", t.name, "op", op.opIndex, "branches", len(op.branches))
+			var wg sync.WaitGroup
+			for _, branch := range op.branches {
+				branch.txnId, branch.begun, branch.aborted, branch.timeout = t.txnId, t.begun, t.aborted, t.timeout
+				wg.Add(1)
+				go func(b *Txn) {
+					defer wg.Done()
+					b.run(ctx, barriers, log)
+				}(branch)
+			}
+			wg.Wait()
+			for _, branch := range op.branches {
+				t.aborted = t.aborted || branch.aborted
+			}
+			if ctx.Err() != nil {
+				t.shutdown(op, log)
+				return
+			}
+			t.trace(op, TraceParallel, nil)
+		case opWaitForCommitCount:
+			log.Debug(op.description, "txn", t.name, "op", op.opIndex)
+			err := t.executor.commits.wait(ctx, op.count, t.timeout)
+			if ctx.Err() != nil {
+				t.shutdown(op, log)
+				return
+			}
+			t.trace(op, TraceCommitCount, nil)
+			if err != nil {
+				log.Error("operation failed", "txn", t.name, "op", op.opIndex, "err", err)
+				t.executor.resultStore.recordError(OpError{
+					TxnName:     t.name,
+					OpIndex:     op.opIndex,
+					Description: op.description,
+					Err:         err,
+				})
+				t.abort(op, log)
+			}
+		case opSleep:
+			log.Debug(op.description, "txn", t.name, "op", op.opIndex)
+			select {
+			case <-time.After(op.timeout):
+			case <-ctx.Done():
+				t.shutdown(op, log)
+				return
 			}
+			t.trace(op, TraceSleep, nil)
 		}
 	}
 }
 
+// runDatabaseOp runs one database operation of the transaction and records its result. It returns false if
+// ctx was cancelled, in which case the transaction has been shut down and must not run anything more.
+func (t *Txn) runDatabaseOp(ctx context.Context, op operation, barriers map[string]chan struct{}, log Logger) bool {
+	if t.aborted {
+		log.Debug("SKIPPED, txn aborted", "txn", t.name, "op", op.opIndex, "desc", op.description)
+		t.executor.resultStore.recordOp(t.name, opRecord{op: op, note: "not run, txn aborted"})
+		if op.name == OpCommit && t.commitSignal != "" {
+			close(barriers[t.commitSignal]) // let the next txn in the commit order proceed
+		}
+		return true
+	}
+	log.Debug(op.description, "txn", t.name, "op", op.opIndex)
+	if missing := op.requires &^ CapabilitiesOf(t.db); missing != 0 {
+		t.executor.resultStore.recordSkip(SkippedOp{
+			TxnName:     t.name,
+			OpIndex:     op.opIndex,
+			Description: op.description,
+			Missing:     missing,
+		})
+		log.Debug("SKIPPED", "txn", t.name, "op", op.opIndex, "missing", missing)
+		t.executor.resultStore.recordOp(t.name, opRecord{op: op, note: "skipped, database lacks " + missing.String()})
+		return true
+	}
+	if op.name == OpCommit && t.commitAfter != "" {
+		log.Debug("WAIT_FOR", "txn", t.name, "op", op.opIndex, "barrier", t.commitAfter)
+		start := time.Now()
+		select {
+		case <-barriers[t.commitAfter]:
+		case <-ctx.Done():
+			t.shutdown(op, log)
+			return false
+		}
+		t.progress.unblock()
+		t.executor.resultStore.recordBarrierWait(t.commitAfter, time.Since(start))
+	}
+	counter, countsWaits := t.db.(LockWaitCounter)
+	var waitsBefore int
+	if countsWaits {
+		waitsBefore = counter.LockWaitCount(t.txnId)
+	}
+	timer, timesLocks := t.db.(LockTimer)
+	start := time.Now()
+	err := t.runOp(ctx, op)
+	t.lastErr = err
+	if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+		t.shutdown(op, log)
+		return false
+	}
+	t.executor.resultStore.recordLatency(op.name, time.Since(start))
+	if countsWaits && counter.LockWaitCount(t.txnId) > waitsBefore {
+		t.executor.resultStore.recordBlocked(t.name, op.opIndex)
+	}
+	if timesLocks && err == nil {
+		if timing, ok := timer.LastLockTiming(t.txnId); ok && !timing.Requested.Before(start) {
+			t.executor.resultStore.recordLockTiming(t.name, op.opIndex, timing)
+		}
+	}
+	t.executor.resultStore.recordOp(t.name, opRecord{op: op, err: err})
+	t.trace(op, op.name, func(event *TraceEvent) { event.Err = err })
+	var deadlock *DeadlockError
+	switch {
+	case errors.Is(err, ErrTimeout):
+		t.abort(op, log)
+	case err == nil && (op.name == OpBegin || op.name == OpSnapshot):
+		t.begun = true
+	case errors.As(err, &deadlock):
+		t.executor.resultStore.recordVictim(t.dbName, deadlock.Victim)
+		t.aborted = true
+		if deadlock.Victim == t.txnId {
+			t.executor.runHooks(false, t.name)
+		}
+	case errors.Is(err, ErrAborted):
+		t.end(OutcomeAborted)
+		t.aborted = true
+	case err == nil && op.name == OpCommit:
+		t.end(OutcomeCommitted)
+		t.recordAccess(accessCommit, 0, 0, false)
+		t.executor.commits.recordCommit()
+	case err == nil && op.name == OpRollback:
+		t.end(OutcomeRolledBack)
+	}
+	if err != nil {
+		log.Error("operation failed", "txn", t.name, "op", op.opIndex, "err", err)
+		t.executor.resultStore.recordError(OpError{
+			TxnName:     t.name,
+			OpIndex:     op.opIndex,
+			Description: op.description,
+			Err:         err,
+		})
+	}
+	if op.onAbort != nil && errors.Is(err, ErrAborted) {
+		op.onAbort()
+	}
+	if op.name == OpCommit && t.commitSignal != "" {
+		close(barriers[t.commitSignal])
+	}
+	return true
+}
+
+// trace records op in the executor's trace as an event of kind, after fill adds any details
+func (t *Txn) trace(op operation, kind string, fill func(event *TraceEvent)) {
+	event := TraceEvent{TxnName: t.name, OpIndex: op.opIndex, Kind: kind, Description: op.description}
+	if fill != nil {
+		fill(&event)
+	}
+	t.executor.tracer.record(event)
+}
+
+// restart prepares the transaction to run again after op failed with a retryable error, which the database
+// has already rolled it back for. The results of the failed attempt are discarded, except for its errors
+// and the operations the report lists. It returns the index of the operation to rerun from: the
+// transaction's first begin, or its first operation if it has none.
+func (t *Txn) restart(op operation, log Logger) int {
+	t.retries++
+	log.Debug("RETRY", "txn", t.name, "op", op.opIndex, "attempt", t.retries+1, "err", t.lastErr)
+	t.aborted, t.begun = false, false
+	t.executor.resultStore.discardAttempt(t.name)
+	t.executor.resultStore.recordRetry(t.name)
+	for i, op := range t.operations {
+		if op.kind == opDatabase && (op.name == OpBegin || op.name == OpSnapshot) {
+			return i
+		}
+	}
+	return 0
+}
+
+// runOp runs a database operation, bounded by the transaction's timeout if it has one and by ctx.
+// An operation that times out or is cancelled keeps running in the background; its eventual result is discarded.
+func (t *Txn) runOp(ctx context.Context, op operation) error {
+	if t.timeout <= 0 && ctx.Done() == nil {
+		return op.fn()
+	}
+	opCtx, cancel := ctx, context.CancelFunc(func() {})
+	if t.timeout > 0 {
+		opCtx, cancel = context.WithTimeout(ctx, t.timeout)
+	}
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- op.fn()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-opCtx.Done():
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s: %w", op.description, ctx.Err())
+		}
+		return fmt.Errorf("%s after %v: %w", op.description, t.timeout, ErrTimeout)
+	}
+}
+
+// abort rolls the transaction back after op timed out, releasing its locks so that other transactions
+// can proceed. The transaction's remaining database operations are skipped, but its barriers are still
+// signaled so that transactions waiting for them do not hang.
+func (t *Txn) abort(op operation, log Logger) {
+	t.aborted = true
+	t.executor.resultStore.recordOutcome(t.name, OutcomeTimedOut)
+	defer t.executor.runHooks(false, t.name)
+	if !t.begun {
+		return // nothing to roll back, and the txn id may not be set yet
+	}
+	if err := t.db.Rollback(t.txnId); err != nil {
+		log.Error("rollback after timeout failed", "txn", t.name, "op", op.opIndex, "err", err)
+	}
+}
+
+// shutdown stops the transaction at op because the run was cancelled. A transaction that has begun and not
+// yet ended is rolled back so that it leaves no locks or uncommitted writes behind.
+func (t *Txn) shutdown(op operation, log Logger) {
+	log.Debug("CANCELLED", "txn", t.name, "op", op.opIndex)
+	if op.kind == opDatabase {
+		t.executor.resultStore.recordOp(t.name, opRecord{op: op, note: "not run, execution cancelled"})
+	}
+	if !t.begun || t.aborted || t.executor.resultStore.Outcome(t.name) != OutcomeUnfinished {
+		return
+	}
+	t.aborted = true
+	t.executor.resultStore.recordOutcome(t.name, OutcomeAborted)
+	if err := t.db.Rollback(t.txnId); err != nil {
+		log.Error("rollback after cancellation failed", "txn", t.name, "op", op.opIndex, "err", err)
+	}
+	t.executor.runHooks(false, t.name)
+}
+
+// end records how the transaction ended and calls the hooks registered for it
+func (t *Txn) end(outcome TxnOutcome) {
+	t.executor.resultStore.recordOutcome(t.name, outcome)
+	t.executor.runHooks(outcome == OutcomeCommitted, t.name)
+}
+
 // addOp adds an operation to the transaction's operation list
 func (t *Txn) addOp(op operation) {
 	t.mu.Lock()
@@ -170,85 +859,378 @@ func (t *Txn) addOp(op operation) {
 	t.operations = append(t.operations, op)
 }
 
-// BeginTx schedules a BeginTx operation
+// SetTimeout bounds each of this transaction's database operations by d. If an operation takes longer, the
+// operation fails with ErrTimeout, the transaction is rolled back and its outcome is OutcomeTimedOut, while
+// the other transactions continue. A d of 0 removes the bound.
+func (t *Txn) SetTimeout(d time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timeout = d
+}
+
+// WithRetry makes Execute run the transaction again, from its first BeginTx, when a database operation fails
+// with a retryable error such as a deadlock or a serialization failure; see IsRetryable. It is run again at
+// most max times; after that the failure stands. Results keep only the reads of the last attempt, and
+// Results.Retries tells how many times it was rerun. Barriers the transaction signaled before the failure
+// stay signaled. ExecuteSchedule and ExecuteRandom do not retry.
+func (t *Txn) WithRetry(max int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.maxRetries = max
+}
+
+// BeginTx schedules a BeginTx operation at READ_UNCOMMITTED
 func (t *Txn) BeginTx() {
+	t.beginTx(ReadUncommitted, "BEGIN_TX")
+}
+
+// BeginTxWithIsolation schedules a BeginTx operation at level. Databases that implement a single level
+// ignore it; one that chooses the level per transaction fails the operation for a level it does not support.
+func (t *Txn) BeginTxWithIsolation(level IsolationLevel) {
+	t.beginTx(level, "BEGIN_TX "+string(level))
+}
+
+func (t *Txn) beginTx(level IsolationLevel, description string) {
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpBegin,
+		description: description,
+		fn: func() error {
+			txnId, err := t.db.BeginTx(string(level))
+			if err != nil {
+				return err
+			}
+			t.txnId = txnId
+			t.executor.resultStore.recordTxnId(t.dbName, txnId, t.name)
+			t.recordReadTimestamp()
+			return nil
+		},
+	})
+}
+
+// BeginSnapshot schedules the start of a read-only transaction pinned to the latest committed snapshot, in place
+// of BeginTx; see SnapshotReader. On databases without CapMVCC it is skipped and recorded in Results.SkippedOps.
+func (t *Txn) BeginSnapshot() {
 	t.addOp(operation{
 		kind:        opDatabase,
-		description: "BEGIN_TX",
+		name:        OpSnapshot,
+		description: "BEGIN_SNAPSHOT",
+		requires:    CapMVCC,
 		fn: func() error {
-			txnId, err := t.db.BeginTx("READ_UNCOMMITTED")
+			reader, ok := t.db.(SnapshotReader)
+			if !ok {
+				return fmt.Errorf("begin snapshot: database reports %s but does not implement SnapshotReader", CapMVCC)
+			}
+			txnId, err := reader.BeginSnapshot()
 			if err != nil {
 				return err
 			}
 			t.txnId = txnId
+			t.executor.resultStore.recordTxnId(t.dbName, txnId, t.name)
+			t.recordReadTimestamp()
 			return nil
 		},
 	})
 }
 
+// recordReadTimestamp saves the snapshot timestamp the database assigned the transaction when it began, if any
+func (t *Txn) recordReadTimestamp() {
+	if stamper, ok := t.db.(ReadTimestamper); ok {
+		if ts, ok := stamper.ReadTimestamp(t.txnId); ok {
+			t.executor.resultStore.recordReadTimestamp(t.name, ts)
+		}
+	}
+}
+
 // Set schedules a Set operation
-func (t *Txn) Set(key, value int) {
+func (t *Txn) Set(key, value int) *LockResult {
+	result := &LockResult{txnName: t.name, opIndex: t.opCounter}
 	t.addOp(operation{
 		kind:        opDatabase,
+		name:        OpSet,
 		description: fmt.Sprintf("SET %d = %d", key, value),
 		fn: func() error {
-			return t.db.Set(t.txnId, key, value)
+			if err := t.db.Set(t.txnId, key, value); err != nil {
+				return err
+			}
+			t.recordAccess(accessWrite, key, value, true)
+			return nil
 		},
 	})
+	return result
 }
 
 // SetComputed schedules a Set operation with a value computed at execution time
-func (t *Txn) SetComputed(key int, valueFn func() int) {
+func (t *Txn) SetComputed(key int, valueFn func() int) *LockResult {
+	result := &LockResult{txnName: t.name, opIndex: t.opCounter}
 	t.addOp(operation{
 		kind:        opDatabase,
+		name:        OpSet,
 		description: fmt.Sprintf("SET_COMPUTED %d = <computed>", key),
 		fn: func() error {
 			value := valueFn()
-			return t.db.Set(t.txnId, key, value)
+			if err := t.db.Set(t.txnId, key, value); err != nil {
+				return err
+			}
+			t.recordAccess(accessWrite, key, value, true)
+			return nil
 		},
 	})
+	return result
 }
 
-// Get schedules a Get operation and captures the result, returning a reference to retrieve it later
-func (t *Txn) Get(key int) *GetResult {
+// SetIf schedules a Set operation with a value computed at execution time that only runs if condFn, also
+// evaluated at execution time, returns true. condFn usually compares earlier reads, e.g. to write only if a
+// key still holds the value read before, as a compare-and-swap does. When condFn returns false nothing is
+// written and the operation does not fail.
+func (t *Txn) SetIf(key int, valueFn func() int, condFn func() bool) *LockResult {
 	currentOpIndex := t.opCounter
-	result := &GetResult{
-		txnName: t.name,
-		opIndex: currentOpIndex,
-	}
-
+	result := &LockResult{txnName: t.name, opIndex: currentOpIndex}
 	t.addOp(operation{
 		kind:        opDatabase,
-		description: fmt.Sprintf("GET %d", key),
+		name:        OpSet,
+		description: fmt.Sprintf("SET_IF %d = <computed>", key),
 		fn: func() error {
-			value, err := t.db.Get(t.txnId, key)
-			if err != nil {
+			if !condFn() {
+				t.log.Debug("SKIPPED, condition false", "txn", t.name, "op", currentOpIndex)
+				return nil
+			}
+			value := valueFn()
+			if err := t.db.Set(t.txnId, key, value); err != nil {
 				return err
 			}
-			// Store the result indexed by operation index
-			t.executor.resultStore.store(t.name, currentOpIndex, value)
+			t.recordAccess(accessWrite, key, value, true)
 			return nil
 		},
 	})
-
 	return result
 }
 
-// Delete schedules a Delete operation
-func (t *Txn) Delete(key int) {
+// SetMany schedules writing every key-value pair in kv as a single operation, so that no other
+// transaction's operation can run between the writes. On databases without CapBatch it is skipped and
+// recorded in Results.SkippedOps.
+func (t *Txn) SetMany(kv map[int]int) {
 	t.addOp(operation{
 		kind:        opDatabase,
-		description: fmt.Sprintf("DELETE %d", key),
+		name:        OpSetMany,
+		description: fmt.Sprintf("SET_MANY %v", kv),
+		requires:    CapBatch,
 		fn: func() error {
-			return t.db.Delete(t.txnId, key)
+			batchDb, ok := t.db.(BatchDatabase)
+			if !ok {
+				return fmt.Errorf("set many: database reports %s but does not implement BatchDatabase", CapBatch)
+			}
+			if err := batchDb.SetMany(t.txnId, kv); err != nil {
+				return err
+			}
+			for _, key := range slices.Sorted(maps.Keys(kv)) {
+				t.recordAccess(accessWrite, key, kv[key], true)
+			}
+			return nil
+		},
+	})
+}
+
+// Increment schedules an Increment operation, which adds delta to key as a single operation.
+// On databases without CapIncrement it is skipped and recorded in Results.SkippedOps.
+func (t *Txn) Increment(key, delta int) {
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpIncrement,
+		description: fmt.Sprintf("INCREMENT %d BY %d", key, delta),
+		requires:    CapIncrement,
+		fn: func() error {
+			incrementDb, ok := t.db.(IncrementDatabase)
+			if !ok {
+				return fmt.Errorf("increment: database reports %s but does not implement IncrementDatabase", CapIncrement)
+			}
+			if err := incrementDb.Increment(t.txnId, key, delta); err != nil {
+				return err
+			}
+			t.recordAccess(accessWrite, key, 0, false) // the value written is not returned
+			return nil
+		},
+	})
+}
+
+// Get schedules a Get operation and captures the result, returning a reference to retrieve it later
+func (t *Txn) Get(key int) *GetResult {
+	currentOpIndex := t.opCounter
+	result := &GetResult{
+		txnName: t.name,
+		opIndex: currentOpIndex,
+	}
+
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpGet,
+		description: fmt.Sprintf("GET %d", key),
+		fn: func() error {
+			value, err := t.db.Get(t.txnId, key)
+			if err != nil {
+				return err
+			}
+			// Store the result indexed by operation index
+			t.executor.resultStore.store(t.name, currentOpIndex, value)
+			t.recordAccess(accessRead, key, value, true)
+			return nil
+		},
+	})
+	t.reads = append(t.reads, result)
+
+	return result
+}
+
+// GetComputed schedules a Get operation on a key computed at execution time, e.g. from an earlier read
+// that holds the key, as when following a pointer
+func (t *Txn) GetComputed(keyFn func() int) *GetResult {
+	currentOpIndex := t.opCounter
+	result := &GetResult{
+		txnName: t.name,
+		opIndex: currentOpIndex,
+	}
+
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpGet,
+		description: "GET_COMPUTED <computed>",
+		fn: func() error {
+			key := keyFn()
+			value, err := t.db.Get(t.txnId, key)
+			if err != nil {
+				return err
+			}
+			t.executor.resultStore.store(t.name, currentOpIndex, value)
+			t.recordAccess(accessRead, key, value, true)
+			return nil
+		},
+	})
+	t.reads = append(t.reads, result)
+
+	return result
+}
+
+// GetByValue schedules a lookup of the keys whose value is value through the database's secondary index,
+// returning a reference to retrieve them with Results.Keys. On databases without CapIndex it is skipped
+// and recorded in Results.SkippedOps.
+func (t *Txn) GetByValue(value int) *KeysResult {
+	currentOpIndex := t.opCounter
+	result := &KeysResult{
+		txnName: t.name,
+		opIndex: currentOpIndex,
+	}
+
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpGetByValue,
+		description: fmt.Sprintf("GET_BY_VALUE %d", value),
+		requires:    CapIndex,
+		fn: func() error {
+			indexedDb, ok := t.db.(IndexedDatabase)
+			if !ok {
+				return fmt.Errorf("get by value: database reports %s but does not implement IndexedDatabase", CapIndex)
+			}
+			keys, err := indexedDb.GetByValue(t.txnId, value)
+			if err != nil {
+				return err
+			}
+			t.executor.resultStore.storeKeys(t.name, currentOpIndex, keys)
+			return nil
+		},
+	})
+
+	return result
+}
+
+// Scan schedules a read of every key from lo to hi inclusive and returns a reference to retrieve the
+// key-value pairs found with Results.Rows. On databases without CapScan it is skipped and recorded in
+// Results.SkippedOps.
+func (t *Txn) Scan(lo, hi int) *ScanResult {
+	currentOpIndex := t.opCounter
+	result := &ScanResult{
+		txnName: t.name,
+		opIndex: currentOpIndex,
+	}
+
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpScan,
+		description: fmt.Sprintf("SCAN %d..%d", lo, hi),
+		requires:    CapScan,
+		fn: func() error {
+			scanDb, ok := t.db.(ScanDatabase)
+			if !ok {
+				return fmt.Errorf("scan: database reports %s but does not implement ScanDatabase", CapScan)
+			}
+			rows, err := scanDb.Scan(t.txnId, lo, hi)
+			if err != nil {
+				return err
+			}
+			t.executor.resultStore.storeRows(t.name, currentOpIndex, rows)
+			return nil
+		},
+	})
+
+	return result
+}
+
+// Sum schedules a read of the total of keys, computed by the database as a single read, and returns a
+// reference to retrieve it with Results.GetValue. Unlike adding up separate Gets it cannot mix values from
+// before and after another transaction's write. On databases without CapAggregate it is skipped and
+// recorded in Results.SkippedOps.
+func (t *Txn) Sum(keys ...int) *GetResult {
+	currentOpIndex := t.opCounter
+	result := &GetResult{
+		txnName: t.name,
+		opIndex: currentOpIndex,
+	}
+
+	keys = slices.Clone(keys)
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpSum,
+		description: fmt.Sprintf("SUM %v", keys),
+		requires:    CapAggregate,
+		fn: func() error {
+			sumDb, ok := t.db.(SumDatabase)
+			if !ok {
+				return fmt.Errorf("sum: database reports %s but does not implement SumDatabase", CapAggregate)
+			}
+			total, err := sumDb.Sum(t.txnId, keys)
+			if err != nil {
+				return err
+			}
+			t.executor.resultStore.store(t.name, currentOpIndex, total)
+			return nil
+		},
+	})
+
+	return result
+}
+
+// Delete schedules a Delete operation
+func (t *Txn) Delete(key int) *LockResult {
+	result := &LockResult{txnName: t.name, opIndex: t.opCounter}
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpDelete,
+		description: fmt.Sprintf("DELETE %d", key),
+		fn: func() error {
+			if err := t.db.Delete(t.txnId, key); err != nil {
+				return err
+			}
+			t.recordAccess(accessWrite, key, 0, true) // reads of a missing key return 0
+			return nil
 		},
 	})
+	return result
 }
 
 // Commit schedules a Commit operation
 func (t *Txn) Commit() {
 	t.addOp(operation{
 		kind:        opDatabase,
+		name:        OpCommit,
 		description: "COMMIT",
 		fn: func() error {
 			return t.db.Commit(t.txnId)
@@ -256,10 +1238,26 @@ func (t *Txn) Commit() {
 	})
 }
 
+// CommitOrElse schedules a Commit that runs onAbort if the database aborts the transaction instead, i.e. the
+// commit fails with an error wrapping ErrAborted such as ErrSerializationFailure. It lets a schedule record
+// which path it took. onAbort runs on the transaction's goroutine, once for every attempt whose commit aborts.
+func (t *Txn) CommitOrElse(onAbort func()) {
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpCommit,
+		description: "COMMIT_OR_ELSE",
+		onAbort:     onAbort,
+		fn: func() error {
+			return t.db.Commit(t.txnId)
+		},
+	})
+}
+
 // Rollback schedules a Rollback operation
 func (t *Txn) Rollback() {
 	t.addOp(operation{
 		kind:        opDatabase,
+		name:        OpRollback,
 		description: "ROLLBACK",
 		fn: func() error {
 			return t.db.Rollback(t.txnId)
@@ -267,6 +1265,42 @@ func (t *Txn) Rollback() {
 	})
 }
 
+// Savepoint schedules setting a savepoint called name that RollbackTo can later roll the transaction back
+// to. On databases without CapSavepoint it is skipped and recorded in Results.SkippedOps.
+func (t *Txn) Savepoint(name string) {
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpSavepoint,
+		description: fmt.Sprintf("SAVEPOINT %s", name),
+		requires:    CapSavepoint,
+		fn: func() error {
+			spDb, ok := t.db.(SavepointDatabase)
+			if !ok {
+				return fmt.Errorf("savepoint: database reports %s but does not implement SavepointDatabase", CapSavepoint)
+			}
+			return spDb.Savepoint(t.txnId, name)
+		},
+	})
+}
+
+// RollbackTo schedules undoing the transaction's writes since the savepoint called name, leaving the
+// transaction active. On databases without CapSavepoint it is skipped and recorded in Results.SkippedOps.
+func (t *Txn) RollbackTo(name string) {
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpRollbackTo,
+		description: fmt.Sprintf("ROLLBACK TO SAVEPOINT %s", name),
+		requires:    CapSavepoint,
+		fn: func() error {
+			spDb, ok := t.db.(SavepointDatabase)
+			if !ok {
+				return fmt.Errorf("rollback to savepoint: database reports %s but does not implement SavepointDatabase", CapSavepoint)
+			}
+			return spDb.RollbackTo(t.txnId, name)
+		},
+	})
+}
+
 // Barrier creates a named synchronization point that other transactions can wait for
 func (t *Txn) Barrier(name string) {
 	t.addOp(operation{
@@ -275,6 +1309,20 @@ func (t *Txn) Barrier(name string) {
 	})
 }
 
+// BarrierN signals a named synchronization point that is shared by several transactions: waits for it
+// proceed once count BarrierN operations, in any transactions, have signaled it. Every BarrierN for
+// a name must use the same count, and a name cannot also be signaled with Barrier.
+func (t *Txn) BarrierN(name string, count int) {
+	if count < 1 {
+		panic(fmt.Sprintf("BarrierN %q: count must be at least 1, got %d", name, count))
+	}
+	t.addOp(operation{
+		kind:        opBarrier,
+		barrierName: name,
+		count:       count,
+	})
+}
+
 // WaitFor waits for a named barrier to be signaled
 func (t *Txn) WaitFor(barrierName string) {
 	t.addOp(operation{
@@ -287,36 +1335,391 @@ func (t *Txn) WaitFor(barrierName string) {
 // This is useful for testing blocking behavior - if the other transaction is blocked (e.g., on a row lock),
 // the barrier won't be signaled, and this transaction continues after the timeout.
 func (t *Txn) WaitForWithTimeout(barrierName string, timeout time.Duration) {
+	t.WaitForOrTimeout(barrierName, timeout)
+}
+
+// WaitForOrTimeout is WaitForWithTimeout for schedules that need to know how the wait ended: the result
+// reports whether the transaction proceeded because the barrier was signaled or because the timeout expired.
+// A signal that arrives after the timeout has no effect on the waiting transaction.
+func (t *Txn) WaitForOrTimeout(barrierName string, timeout time.Duration) *WaitResult {
+	result := &WaitResult{txnName: t.name, opIndex: t.opCounter}
 	t.addOp(operation{
 		kind:        opWaitForWithTimeout,
 		barrierName: barrierName,
 		timeout:     timeout,
 	})
+	return result
+}
+
+// Parallel schedules groups of database operations that run concurrently on the transaction's txnId, to model
+// a transaction that issues several statements at once. Each function schedules one group on the Txn it is
+// given; operations within a group still run in order, and the transaction continues once every group has
+// finished. Groups may only schedule reads and writes: it panics if one schedules BeginTx, Commit, Rollback,
+// a barrier or a wait, since those would race with the other groups.
+func (t *Txn) Parallel(groups ...func(*Txn)) {
+	t.mu.Lock()
+	opIndex := t.opCounter
+	t.opCounter++
+	t.mu.Unlock()
+
+	branches := make([]*Txn, len(groups))
+	for i, group := range groups {
+		branch := &Txn{name: t.name, executor: t.executor, db: t.db, dbName: t.dbName, opCounter: t.opCounter}
+		group(branch)
+		for _, op := range branch.operations {
+			if op.kind != opDatabase || op.name == OpBegin || op.name == OpSnapshot || op.name == OpCommit || op.name == OpRollback {
+				panic(fmt.Sprintf("txn %s: Parallel group %d schedules %s, which cannot run concurrently", t.name, i, branch.describe(op.opIndex)))
+			}
+		}
+		t.opCounter = branch.opCounter
+		t.reads = append(t.reads, branch.reads...)
+		branches[i] = branch
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.operations = append(t.operations, operation{
+		kind:        opParallel,
+		branches:    branches,
+		opIndex:     opIndex,
+		description: fmt.Sprintf("PARALLEL %d groups", len(groups)),
+	})
+}
+
+// Sleep pauses the transaction for d before its next operation, widening the window in which other
+// transactions can interleave with it. Nothing is locked while it sleeps, so it delays no other transaction
+// except through the transaction's own row locks. A cancelled run cuts the sleep short.
+func (t *Txn) Sleep(d time.Duration) {
+	t.addOp(operation{
+		kind:        opSleep,
+		timeout:     d,
+		description: fmt.Sprintf("SLEEP %s", d),
+	})
+}
+
+// WaitForCommitCount waits until n transactions have committed successfully during the run, counting
+// commits by every transaction on every database; aborts and rollbacks do not count. It lets a checker
+// run after a known number of writers finish without naming each one. The wait fails with ErrTimeout,
+// aborting the transaction, once the transaction's timeout expires or as soon as every other transaction
+// has finished or is itself waiting for commits, since no more commits can happen.
+func (t *Txn) WaitForCommitCount(n int) {
+	t.addOp(operation{
+		kind:        opWaitForCommitCount,
+		count:       n,
+		description: fmt.Sprintf("WAIT_FOR_COMMIT_COUNT %d", n),
+	})
+}
+
+// AcquireLock schedules taking the row lock on key without writing, the first half of a Set.
+// Schedule WriteLocked afterwards for the second half; barriers in between let other transactions
+// be observed trying the same key. On databases without CapLocking it is skipped and recorded in Results.SkippedOps.
+func (t *Txn) AcquireLock(key int) *LockResult {
+	result := &LockResult{txnName: t.name, opIndex: t.opCounter}
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpLock,
+		description: fmt.Sprintf("ACQUIRE_LOCK %d", key),
+		requires:    CapLocking,
+		fn: func() error {
+			lockingDb, ok := t.db.(LockingDatabase)
+			if !ok {
+				return fmt.Errorf("acquire lock: database reports %s but does not implement LockingDatabase", CapLocking)
+			}
+			return lockingDb.AcquireLock(t.txnId, key)
+		},
+	})
+	return result
+}
+
+// DeclareWriteSet schedules taking the write locks on keys up front, in ascending key order, so that the
+// transaction's later writes to them never wait; see WriteSetDeclarer. On databases without CapWriteSet it
+// is skipped and recorded in Results.SkippedOps.
+func (t *Txn) DeclareWriteSet(keys ...int) *LockResult {
+	result := &LockResult{txnName: t.name, opIndex: t.opCounter}
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpWriteSet,
+		description: fmt.Sprintf("DECLARE_WRITE_SET %v", keys),
+		requires:    CapWriteSet,
+		fn: func() error {
+			declarer, ok := t.db.(WriteSetDeclarer)
+			if !ok {
+				return fmt.Errorf("declare write set: database reports %s but does not implement WriteSetDeclarer", CapWriteSet)
+			}
+			return declarer.DeclareWriteSet(t.txnId, keys)
+		},
+	})
+	return result
+}
+
+// WriteLocked schedules a write to key under a lock taken earlier with AcquireLock, the second half of a Set.
+// It fails with ErrLockNotHeld if the transaction does not hold the lock when it runs.
+// On databases without CapLocking it is skipped and recorded in Results.SkippedOps.
+func (t *Txn) WriteLocked(key, value int) {
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpWriteLock,
+		description: fmt.Sprintf("WRITE_LOCKED %d = %d", key, value),
+		requires:    CapLocking,
+		fn: func() error {
+			lockingDb, ok := t.db.(LockingDatabase)
+			if !ok {
+				return fmt.Errorf("write locked: database reports %s but does not implement LockingDatabase", CapLocking)
+			}
+			if err := lockingDb.WriteLocked(t.txnId, key, value); err != nil {
+				return err
+			}
+			t.recordAccess(accessWrite, key, value, true)
+			return nil
+		},
+	})
+}
+
+// Assert schedules a check of an invariant at this point in the schedule, e.g. that an earlier read in the
+// transaction returned an expected value. If fn returns false, the check is recorded in
+// Results.AssertionFailures with desc as its description; the transaction carries on either way.
+func (t *Txn) Assert(desc string, fn func() bool) {
+	currentOpIndex := t.opCounter
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpAssert,
+		description: fmt.Sprintf("ASSERT %s", desc),
+		fn: func() error {
+			if !fn() {
+				t.executor.resultStore.recordFailure(AssertionFailure{
+					TxnName:     t.name,
+					OpIndex:     currentOpIndex,
+					Description: desc,
+				})
+			}
+			return nil
+		},
+	})
+}
+
+// AssertHoldsLock schedules a check that this transaction holds the row lock on key at this point in the schedule.
+// A failed check is recorded in Results.AssertionFailures. On databases without CapLocking the check is skipped
+// and recorded in Results.SkippedOps.
+func (t *Txn) AssertHoldsLock(key int) {
+	currentOpIndex := t.opCounter
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpAssertLock,
+		description: fmt.Sprintf("ASSERT_HOLDS_LOCK %d", key),
+		requires:    CapLocking,
+		fn: func() error {
+			lockingDb, ok := t.db.(LockingDatabase)
+			if !ok {
+				return fmt.Errorf("assert holds lock: database reports %s but does not implement LockingDatabase", CapLocking)
+			}
+			if !lockingDb.HoldsLock(t.txnId, key) {
+				t.executor.resultStore.recordFailure(AssertionFailure{
+					TxnName:     t.name,
+					OpIndex:     currentOpIndex,
+					Description: fmt.Sprintf("expected txn %s to hold the lock on key %d", t.name, key),
+				})
+			}
+			return nil
+		},
+	})
+}
+
+// Checkpoint schedules a snapshot of the full database state as visible to this transaction at this point
+// in the schedule, retrievable afterwards with Results.Checkpoint(label). Labels must be unique within a run.
+// On databases without CapSnapshot the checkpoint is skipped and recorded in Results.SkippedOps.
+func (t *Txn) Checkpoint(label string) {
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpCheckpoint,
+		description: fmt.Sprintf("CHECKPOINT %s", label),
+		requires:    CapSnapshot,
+		fn: func() error {
+			snapshotter, ok := t.db.(Snapshotter)
+			if !ok {
+				return fmt.Errorf("checkpoint %q: database reports %s but does not implement Snapshotter", label, CapSnapshot)
+			}
+			state, err := snapshotter.Snapshot(t.txnId)
+			if err != nil {
+				return err
+			}
+			return t.executor.resultStore.storeCheckpoint(label, state)
+		},
+	})
+}
+
+// VersionHistory schedules a read of every stored version of key, including aborted ones, and returns
+// a reference to retrieve it with Results.Versions. On databases without CapMVCC it is skipped and
+// recorded in Results.SkippedOps.
+func (t *Txn) VersionHistory(key int) *VersionHistoryResult {
+	currentOpIndex := t.opCounter
+	result := &VersionHistoryResult{
+		txnName: t.name,
+		opIndex: currentOpIndex,
+	}
+
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpVersions,
+		description: fmt.Sprintf("VERSION_HISTORY %d", key),
+		requires:    CapMVCC,
+		fn: func() error {
+			inspector, ok := t.db.(VersionInspector)
+			if !ok {
+				return fmt.Errorf("version history: database reports %s but does not implement VersionInspector", CapMVCC)
+			}
+			t.executor.resultStore.storeVersions(t.name, currentOpIndex, inspector.VersionHistory(key))
+			return nil
+		},
+	})
+
+	return result
 }
 
 // PrintDbState schedules a database state print operation for debugging
 func (t *Txn) PrintDbState() {
 	t.addOp(operation{
 		kind:        opDatabase,
+		name:        OpPrintState,
 		description: "PRINT_DB_STATE",
 		fn: func() error {
-			fmt.Printf("(%s) ", t.name)
+			t.log.Info("database state", "txn", t.name)
 			t.db.PrintState()
 			return nil
 		},
 	})
 }
 
+// PrintHistory schedules a print of every value committed to key, for debugging. On databases that do not
+// implement Historian it prints that there is no history to show.
+func (t *Txn) PrintHistory(key int) {
+	t.addOp(operation{
+		kind:        opDatabase,
+		name:        OpHistory,
+		description: fmt.Sprintf("PRINT_HISTORY %d", key),
+		fn: func() error {
+			historian, ok := t.db.(Historian)
+			if !ok {
+				t.log.Info("database keeps no history", "txn", t.name, "key", key)
+				return nil
+			}
+			t.log.Info("key history", "txn", t.name, "key", key, "values", historian.History(key))
+			return nil
+		},
+	})
+}
+
+// AssertionFailure describes a check scheduled in a transaction that did not hold at execution time
+type AssertionFailure struct {
+	TxnName     string
+	OpIndex     int
+	Description string
+}
+
+func (f AssertionFailure) String() string {
+	return fmt.Sprintf("[%s] (%d) %s", f.TxnName, f.OpIndex, f.Description)
+}
+
+// TxnOutcome is how a transaction ended
+type TxnOutcome int
+
+const (
+	OutcomeUnfinished TxnOutcome = iota // no commit or rollback succeeded
+	OutcomeCommitted
+	OutcomeRolledBack
+	OutcomeTimedOut // rolled back by the executor after an operation exceeded the txn's timeout
+	OutcomeAborted  // aborted by the database, e.g. as a deadlock victim, or rolled back when the run was cancelled
+)
+
+func (o TxnOutcome) String() string {
+	switch o {
+	case OutcomeCommitted:
+		return "committed"
+	case OutcomeRolledBack:
+		return "rolled back"
+	case OutcomeTimedOut:
+		return "aborted by timeout"
+	case OutcomeAborted:
+		return "aborted"
+	default:
+		return "unfinished"
+	}
+}
+
+// OpError describes a scheduled database operation that returned an error
+type OpError struct {
+	TxnName     string
+	OpIndex     int
+	Description string
+	Err         error
+}
+
+func (e OpError) Error() string {
+	return fmt.Sprintf("[%s] (%d) %s: %v", e.TxnName, e.OpIndex, e.Description, e.Err)
+}
+
+func (e OpError) Unwrap() error {
+	return e.Err
+}
+
+// SkippedOp describes a scheduled operation that was not run because the database lacks a capability it needs
+type SkippedOp struct {
+	TxnName     string
+	OpIndex     int
+	Description string
+	Missing     Capability
+}
+
+func (s SkippedOp) String() string {
+	return fmt.Sprintf("[%s] (%d) %s skipped: database lacks %s", s.TxnName, s.OpIndex, s.Description, s.Missing)
+}
+
 // Results stores the results of Get operations indexed by transaction name and operation index
 type Results struct {
-	data map[string]map[int]int
-	mu   sync.RWMutex
+	data           map[string]map[int]int
+	failures       []AssertionFailure
+	errs           []OpError
+	outcomes       map[string]TxnOutcome
+	victims        []string                    // names of transactions aborted to break a deadlock
+	txnNames       map[string]map[int64]string // database name -> txId -> txn name
+	ops            map[string][]opRecord       // txn name -> database operations in the order they ran
+	finalStates    map[string]map[int]int      // database name -> contents after the run
+	skipped        []SkippedOp
+	checkpoints    map[string]map[int]int
+	versions       map[string]map[int][]VersionInfo
+	keys           map[string]map[int][]int       // results of GetByValue operations
+	rows           map[string]map[int]map[int]int // results of Scan operations
+	blocked        map[string]map[int]bool        // txn name -> indexes of operations that waited for a lock
+	lockTimings    map[string]map[int]LockTiming
+	waitOutcomes   map[string]map[int]bool    // txn name -> op index -> whether a WaitForWithTimeout timed out
+	history        []access                   // reads, writes and commits in the order they returned, for SerializationOrder
+	readTimestamps map[string]int64           // txn name -> snapshot timestamp assigned when it began
+	unblocked      map[string][]string        // txn name -> txns granted a lock they waited for when it released its locks
+	latencies      map[string][]time.Duration // op name -> durations of database operations
+	waits          map[string][]time.Duration // barrier name -> time spent waiting for it
+	retries        map[string]int             // txn name -> times it was rerun after a retryable failure
+	mu             sync.RWMutex
 }
 
 // newResults creates a new Results storage
 func newResults() *Results {
 	return &Results{
-		data: make(map[string]map[int]int),
+		data:           make(map[string]map[int]int),
+		checkpoints:    make(map[string]map[int]int),
+		outcomes:       make(map[string]TxnOutcome),
+		txnNames:       make(map[string]map[int64]string),
+		ops:            make(map[string][]opRecord),
+		finalStates:    make(map[string]map[int]int),
+		versions:       make(map[string]map[int][]VersionInfo),
+		keys:           make(map[string]map[int][]int),
+		rows:           make(map[string]map[int]map[int]int),
+		blocked:        make(map[string]map[int]bool),
+		lockTimings:    make(map[string]map[int]LockTiming),
+		waitOutcomes:   make(map[string]map[int]bool),
+		readTimestamps: make(map[string]int64),
+		unblocked:      make(map[string][]string),
+		latencies:      make(map[string][]time.Duration),
+		waits:          make(map[string][]time.Duration),
+		retries:        make(map[string]int),
 	}
 }
 
@@ -331,7 +1734,8 @@ func (r *Results) store(txnName string, opIndex int, value int) {
 	r.data[txnName][opIndex] = value
 }
 
-// Get retrieves the result of a Get operation for a specific transaction and operation index
+// Get retrieves the result of a Get operation for a specific transaction and operation index. It returns 0
+// for a read that failed or did not run; use Lookup to tell that apart from a real 0.
 func (r *Results) Get(txnName string, opIndex int) int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -342,7 +1746,415 @@ func (r *Results) Get(txnName string, opIndex int) int {
 	return 0
 }
 
-// GetValue retrieves the value using a GetResult reference
+// recordError saves a failed database operation
+func (r *Results) recordError(opErr OpError) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs = append(r.errs, opErr)
+}
+
+// Errors returns the database operations that returned an error, in the order they failed
+func (r *Results) Errors() []OpError {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]OpError(nil), r.errs...)
+}
+
+// Failed reports whether any database operation of the named transaction returned an error
+func (r *Results) Failed(txnName string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, opErr := range r.errs {
+		if opErr.TxnName == txnName {
+			return true
+		}
+	}
+	return false
+}
+
+// recordOp saves a database operation as it was executed
+func (r *Results) recordOp(txnName string, record opRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops[txnName] = append(r.ops[txnName], record)
+}
+
+// storeFinalState saves a database's contents after the run
+func (r *Results) storeFinalState(dbName string, state map[int]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finalStates[dbName] = state
+}
+
+// recordOutcome saves how a transaction ended
+func (r *Results) recordOutcome(txnName string, outcome TxnOutcome) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outcomes[txnName] = outcome
+}
+
+// recordTxnId saves which transaction a database assigned txId to
+func (r *Results) recordTxnId(dbName string, txId int64, txnName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.txnNames[dbName] == nil {
+		r.txnNames[dbName] = make(map[int64]string)
+	}
+	r.txnNames[dbName][txId] = txnName
+}
+
+// txnName returns the transaction the named database assigned txId to
+func (r *Results) txnName(dbName string, txId int64) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	name, ok := r.txnNames[dbName][txId]
+	return name, ok
+}
+
+// TxnId returns the id the database assigned to the named transaction during the run, or 0 if it never began
+func (r *Results) TxnId(txnName string) int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, names := range r.txnNames {
+		for txId, name := range names {
+			if name == txnName {
+				return txId
+			}
+		}
+	}
+	return 0
+}
+
+// recordReadTimestamp saves the snapshot timestamp a transaction was assigned
+func (r *Results) recordReadTimestamp(txnName string, ts int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.readTimestamps[txnName] = ts
+}
+
+// ReadTimestamp returns the snapshot timestamp the database assigned the named transaction when it began,
+// to compare with the commit timestamps of the writes it did or did not see. ok is false if the transaction
+// never began or the database does not implement ReadTimestamper.
+func (r *Results) ReadTimestamp(txnName string) (ts int64, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ts, ok = r.readTimestamps[txnName]
+	return ts, ok
+}
+
+// storeUnblocked saves, for every transaction that ran on the named database, the transactions its release
+// of locks unblocked
+func (r *Results) storeUnblocked(dbName string, inspector UnblockInspector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for txId, name := range r.txnNames[dbName] {
+		for _, waiter := range inspector.UnblockedBy(txId) {
+			if waiterName, ok := r.txnNames[dbName][waiter]; ok {
+				r.unblocked[name] = append(r.unblocked[name], waiterName)
+			}
+		}
+	}
+}
+
+// UnblockedBy returns the transactions that were waiting for a lock the named transaction held and were
+// granted it when the transaction committed or rolled back, in the order they were granted it. It is empty
+// unless the database implements UnblockInspector.
+func (r *Results) UnblockedBy(txnName string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.unblocked[txnName])
+}
+
+// recordVictim saves the transaction a database aborted to break a deadlock, identified by its txId
+func (r *Results) recordVictim(dbName string, txId int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	txnName, ok := r.txnNames[dbName][txId]
+	if !ok {
+		txnName = fmt.Sprintf("unknown txn %d", txId)
+	}
+	r.victims = append(r.victims, txnName)
+	r.outcomes[txnName] = OutcomeAborted
+}
+
+// HadDeadlock reports whether the database reported a deadlock during the run
+func (r *Results) HadDeadlock() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.victims) > 0
+}
+
+// DeadlockVictims returns the transactions the database aborted to break deadlocks, in the order
+// the deadlocks were reported
+func (r *Results) DeadlockVictims() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.victims...)
+}
+
+// Outcome returns how the named transaction ended
+func (r *Results) Outcome(txnName string) TxnOutcome {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.outcomes[txnName]
+}
+
+// discardAttempt forgets what txnName read, wrote and how it ended in an attempt that is about to be retried
+func (r *Results) discardAttempt(txnName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.data, txnName)
+	delete(r.keys, txnName)
+	delete(r.rows, txnName)
+	delete(r.blocked, txnName)
+	delete(r.lockTimings, txnName)
+	delete(r.readTimestamps, txnName)
+	delete(r.outcomes, txnName)
+	r.history = slices.DeleteFunc(r.history, func(a access) bool { return a.txnName == txnName })
+}
+
+func (r *Results) recordRetry(txnName string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.retries[txnName]++
+}
+
+// Retries returns how many times txnName was rerun after a retryable failure; see Txn.WithRetry
+func (r *Results) Retries(txnName string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.retries[txnName]
+}
+
+// recordFailure saves a failed in-schedule assertion
+func (r *Results) recordFailure(failure AssertionFailure) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures = append(r.failures, failure)
+}
+
+// AssertionFailures returns the in-schedule assertions that failed, in the order they failed
+func (r *Results) AssertionFailures() []AssertionFailure {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]AssertionFailure(nil), r.failures...)
+}
+
+// recordSkip saves an operation that was skipped for lack of a capability
+func (r *Results) recordSkip(skip SkippedOp) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.skipped = append(r.skipped, skip)
+}
+
+// SkippedOps returns the operations that were not run because the database lacks a capability they need
+func (r *Results) SkippedOps() []SkippedOp {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]SkippedOp(nil), r.skipped...)
+}
+
+// storeCheckpoint saves a snapshot under label, failing if the label was already used
+func (r *Results) storeCheckpoint(label string, state map[int]int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.checkpoints[label]; ok {
+		return fmt.Errorf("checkpoint %q already recorded", label)
+	}
+	r.checkpoints[label] = state
+	return nil
+}
+
+// Checkpoint returns the state captured by the checkpoint with the given label, or nil if there is none
+func (r *Results) Checkpoint(label string) map[int]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	state, ok := r.checkpoints[label]
+	if !ok {
+		return nil
+	}
+	copied := make(map[int]int, len(state))
+	for key, value := range state {
+		copied[key] = value
+	}
+	return copied
+}
+
+// storeKeys saves the result of a GetByValue operation
+func (r *Results) storeKeys(txnName string, opIndex int, keys []int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keys[txnName] == nil {
+		r.keys[txnName] = make(map[int][]int)
+	}
+	r.keys[txnName][opIndex] = keys
+}
+
+// Keys returns the keys found by a GetByValue operation, or nil if the operation did not run
+func (r *Results) Keys(ref *KeysResult) []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]int(nil), r.keys[ref.txnName][ref.opIndex]...)
+}
+
+// storeRows saves the result of a Scan operation
+func (r *Results) storeRows(txnName string, opIndex int, rows map[int]int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rows[txnName] == nil {
+		r.rows[txnName] = make(map[int]map[int]int)
+	}
+	r.rows[txnName][opIndex] = maps.Clone(rows)
+}
+
+// Rows returns the key-value pairs read by a Scan operation, or nil if the operation did not run
+func (r *Results) Rows(ref *ScanResult) map[int]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return maps.Clone(r.rows[ref.txnName][ref.opIndex])
+}
+
+// recordBlocked notes that an operation had to wait for a lock held by another transaction
+func (r *Results) recordBlocked(txnName string, opIndex int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.blocked[txnName] == nil {
+		r.blocked[txnName] = make(map[int]bool)
+	}
+	r.blocked[txnName][opIndex] = true
+}
+
+// DidBlock reports whether a Get operation had to wait for a lock held by another transaction before it returned.
+// It is always false on databases that do not implement LockWaitCounter, and for reads that never take locks,
+// such as MVCC reads served from a snapshot.
+func (r *Results) DidBlock(ref *GetResult) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.blocked[ref.txnName][ref.opIndex]
+}
+
+// recordWaitOutcome saves whether a WaitForWithTimeout operation ended by timing out or by its barrier being signaled
+func (r *Results) recordWaitOutcome(txnName string, opIndex int, timedOut bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.waitOutcomes[txnName] == nil {
+		r.waitOutcomes[txnName] = make(map[int]bool)
+	}
+	r.waitOutcomes[txnName][opIndex] = timedOut
+}
+
+// WaitTimedOut reports whether a WaitForOrTimeout operation gave up on its barrier because the timeout
+// expired, rather than being signaled. ok is false if the wait did not finish, e.g. because the run was cancelled.
+func (r *Results) WaitTimedOut(ref *WaitResult) (timedOut bool, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	timedOut, ok = r.waitOutcomes[ref.txnName][ref.opIndex]
+	return timedOut, ok
+}
+
+// recordLockTiming saves when the lock an operation took was requested and granted
+func (r *Results) recordLockTiming(txnName string, opIndex int, timing LockTiming) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lockTimings[txnName] == nil {
+		r.lockTimings[txnName] = make(map[int]LockTiming)
+	}
+	r.lockTimings[txnName][opIndex] = timing
+}
+
+// LockTiming returns when the row lock taken by a Set, Delete or AcquireLock operation was requested and
+// granted. It reports false if the database does not implement LockTimer, if the operation failed or did
+// not run, or if it needed no new lock because the transaction already held it.
+func (r *Results) LockTiming(ref *LockResult) (LockTiming, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	timing, ok := r.lockTimings[ref.txnName][ref.opIndex]
+	return timing, ok
+}
+
+// storeVersions saves the result of a VersionHistory operation
+func (r *Results) storeVersions(txnName string, opIndex int, versions []VersionInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.versions[txnName] == nil {
+		r.versions[txnName] = make(map[int][]VersionInfo)
+	}
+	r.versions[txnName][opIndex] = versions
+}
+
+// Versions returns the versions recorded by a VersionHistory operation, oldest first,
+// or nil if the operation did not run
+func (r *Results) Versions(ref *VersionHistoryResult) []VersionInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]VersionInfo(nil), r.versions[ref.txnName][ref.opIndex]...)
+}
+
+// recordLatency saves how long a database operation took
+func (r *Results) recordLatency(opName string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies[opName] = append(r.latencies[opName], d)
+}
+
+// recordBarrierWait saves how long a transaction waited for a barrier
+func (r *Results) recordBarrierWait(barrierName string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.waits[barrierName] = append(r.waits[barrierName], d)
+}
+
+// LatencyHistogram returns the durations of all executed database operations keyed by operation name
+// (OpGet, OpSet, OpCommit, ...). Time spent waiting for barriers is not included; see BarrierWaitTimes.
+func (r *Results) LatencyHistogram() map[string][]time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return copyDurations(r.latencies)
+}
+
+// BarrierWaitTimes returns the time transactions spent waiting for each barrier, keyed by barrier name
+func (r *Results) BarrierWaitTimes() map[string][]time.Duration {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return copyDurations(r.waits)
+}
+
+func copyDurations(m map[string][]time.Duration) map[string][]time.Duration {
+	copied := make(map[string][]time.Duration, len(m))
+	for key, durations := range m {
+		copied[key] = append([]time.Duration(nil), durations...)
+	}
+	return copied
+}
+
+// GetValue retrieves the value using a GetResult reference, or 0 if the read failed or did not run
 func (r *Results) GetValue(ref *GetResult) int {
 	return r.Get(ref.txnName, ref.opIndex)
 }
+
+// Lookup returns the value read by a Get, GetComputed or Sum operation. ok is false if the operation
+// failed, was skipped, or did not run, so a real 0 can be told apart from a missing read.
+func (r *Results) Lookup(ref *GetResult) (value int, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	value, ok = r.data[ref.txnName][ref.opIndex]
+	return value, ok
+}
+
+// MustGetValue is GetValue for reads that must have happened: it panics if the operation failed, was
+// skipped, or did not run
+func (r *Results) MustGetValue(ref *GetResult) int {
+	value, ok := r.Lookup(ref)
+	if !ok {
+		panic(fmt.Sprintf("txn %s op %d has no result: the read failed, was skipped or did not run", ref.txnName, ref.opIndex))
+	}
+	return value
+}
+
+// AllFor returns every value txnName's Get, GetComputed and Sum operations read, by operation index.
+// Reads that failed, were skipped, or did not run are absent.
+func (r *Results) AllFor(txnName string) map[int]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return maps.Clone(r.data[txnName])
+}
@@ -0,0 +1,1640 @@
+package anomalytest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// callsOf filters recorded calls down to a single method
+func callsOf(calls []MockCall, method string) []MockCall {
+	var filtered []MockCall
+	for _, call := range calls {
+		if call.Method == method {
+			filtered = append(filtered, call)
+		}
+	}
+	return filtered
+}
+
+// methodsOf returns the method of each recorded call, in order
+func methodsOf(calls []MockCall) []string {
+	methods := make([]string, len(calls))
+	for i, call := range calls {
+		methods[i] = call.Method
+	}
+	return methods
+}
+
+// txnIdForKey returns the transaction that called Set on key
+func txnIdForKey(calls []MockCall, key int) int64 {
+	for _, call := range callsOf(calls, MethodSet) {
+		if call.Key == key {
+			return call.TxId
+		}
+	}
+	return 0
+}
+
+func TestExecuteCommitsOncePerCommittingTxn(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.BeginTx()
+	txn2.Set(2, 200)
+	txn2.Commit()
+
+	txn3 := exec.NewTxn("txn3")
+	txn3.BeginTx()
+	txn3.Set(3, 300)
+	txn3.Rollback()
+
+	exec.Execute(true)
+
+	calls := db.Calls()
+	var committed []int64
+	for _, call := range callsOf(calls, MethodCommit) {
+		committed = append(committed, call.TxId)
+	}
+	assert.ElementsMatch(t, []int64{txnIdForKey(calls, 1), txnIdForKey(calls, 2)}, committed)
+
+	rollbacks := callsOf(calls, MethodRollback)
+	assert.Len(t, rollbacks, 1)
+	assert.Equal(t, txnIdForKey(calls, 3), rollbacks[0].TxId)
+}
+
+func TestExecuteRespectsBarrierOrder(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.WaitFor("txn2_wrote")
+	txn1.Set(1, 100)
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.BeginTx()
+	txn2.Set(2, 200)
+	txn2.Barrier("txn2_wrote")
+	txn2.Commit()
+
+	exec.Execute(true)
+
+	var setKeys []int
+	for _, call := range callsOf(db.Calls(), MethodSet) {
+		setKeys = append(setKeys, call.Key)
+	}
+	assert.Equal(t, []int{2, 1}, setKeys, "txn1 must not write before txn2's barrier")
+}
+
+func TestLookupTellsMissingReadsFromZero(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	zero := txn1.Get(1)
+	skipped := txn1.Sum(1, 2) // MockDatabase has no CapAggregate
+	txn1.Commit()
+
+	results := exec.Execute(true)
+
+	value, ok := results.Lookup(zero)
+	assert.True(t, ok)
+	assert.Equal(t, 0, value)
+	assert.Equal(t, 0, results.MustGetValue(zero))
+	_, ok = results.Lookup(skipped)
+	assert.False(t, ok)
+	assert.Equal(t, 0, results.GetValue(skipped))
+	assert.Panics(t, func() { results.MustGetValue(skipped) })
+	assert.Equal(t, map[int]int{1: 0}, results.AllFor("txn1"))
+	assert.Empty(t, results.AllFor("txn2"))
+}
+
+func TestBarrierNReleasesWaitersOnceEverySignalArrives(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+
+	for i := 1; i <= 3; i++ {
+		writer := exec.NewTxn(fmt.Sprintf("writer%d", i))
+		writer.BeginTx()
+		writer.Set(i, i)
+		writer.BarrierN("ready", 3)
+		writer.Commit()
+	}
+	for i := 1; i <= 2; i++ {
+		reader := exec.NewTxn(fmt.Sprintf("reader%d", i))
+		reader.BeginTx()
+		reader.WaitFor("ready")
+		reader.Set(10+i, i)
+		reader.Commit()
+	}
+
+	exec.Execute(true)
+
+	var setKeys []int
+	for _, call := range callsOf(db.Calls(), MethodSet) {
+		setKeys = append(setKeys, call.Key)
+	}
+	assert.ElementsMatch(t, []int{1, 2, 3, 11, 12}, setKeys)
+	firstRead := slices.IndexFunc(setKeys, func(key int) bool { return key > 10 })
+	assert.Equal(t, 3, firstRead, "readers must not write before all three writers signal: %v", setKeys)
+}
+
+func TestExecuteStoresGetResults(t *testing.T) {
+	db := NewMockDatabase()
+	db.SetGetValue(1, 42)
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	read1 := txn1.Get(1)
+	read2 := txn1.Get(2)
+	txn1.Commit()
+
+	results := exec.Execute(true)
+
+	assert.Equal(t, 42, results.GetValue(read1))
+	assert.Equal(t, 0, results.GetValue(read2))
+	assert.Equal(t, []*GetResult{read1, read2}, exec.Reads("txn1"))
+}
+
+func TestExecuteContinuesAfterOperationError(t *testing.T) {
+	db := NewMockDatabase()
+	db.SetError(MethodSet, errors.New("set failed"))
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Set(2, 200)
+	txn1.Commit()
+
+	exec.Execute(true)
+
+	calls := db.Calls()
+	methods := make([]string, len(calls))
+	for i, call := range calls {
+		methods[i] = call.Method
+		assert.Equal(t, i+1, call.Seq)
+	}
+	assert.Equal(t, []string{MethodBeginTx, MethodSet, MethodSet, MethodCommit}, methods)
+}
+
+func TestExecuteCallsEachMethodOncePerTxn(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+
+	const txns = 20
+	for i := 0; i < txns; i++ {
+		txn := exec.NewTxn(fmt.Sprintf("txn%d", i))
+		txn.BeginTx()
+		txn.Set(i, i)
+		txn.Get(i)
+		txn.Commit()
+	}
+
+	exec.Execute(false)
+
+	assert.Equal(t, txns, db.CallCount(MethodBeginTx))
+	assert.Equal(t, txns, db.CallCount(MethodSet))
+	assert.Equal(t, txns, db.CallCount(MethodGet))
+	assert.Equal(t, txns, db.CallCount(MethodCommit))
+	assert.Equal(t, 0, db.CallCount(MethodRollback))
+
+	commitsByTxn := db.CallCountsByTxn(MethodCommit)
+	assert.Len(t, commitsByTxn, txns)
+	for txId, count := range commitsByTxn {
+		assert.Equal(t, 1, count, "txn %d should commit exactly once", txId)
+	}
+}
+
+func TestLatencyHistogramExcludesBarrierWaits(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Get(1)
+	txn1.WaitFor("txn2_slept")
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitForWithTimeout("never_signaled", 50*time.Millisecond)
+	txn2.Barrier("txn2_slept")
+	txn2.Barrier("never_signaled")
+
+	results := exec.Execute(true)
+
+	histogram := results.LatencyHistogram()
+	assert.Len(t, histogram[OpBegin], 1)
+	assert.Len(t, histogram[OpSet], 1)
+	assert.Len(t, histogram[OpGet], 1)
+	assert.Len(t, histogram[OpCommit], 1)
+	for name, durations := range histogram {
+		for _, d := range durations {
+			assert.Less(t, d, 50*time.Millisecond, "%s latency should not include barrier waits", name)
+		}
+	}
+
+	waits := results.BarrierWaitTimes()
+	assert.Len(t, waits["txn2_slept"], 1)
+	assert.GreaterOrEqual(t, waits["txn2_slept"][0], 50*time.Millisecond)
+	assert.GreaterOrEqual(t, waits["never_signaled"][0], 50*time.Millisecond)
+}
+
+func TestCapabilitiesOfInfersFromInterfaces(t *testing.T) {
+	assert.Equal(t, Capability(0), CapabilitiesOf(NewMockDatabase()))
+	assert.Equal(t, "none", CapabilitiesOf(NewMockDatabase()).String())
+	assert.Equal(t, "locking|snapshot", (CapLocking | CapSnapshot).String())
+	assert.True(t, (CapLocking | CapMVCC).Has(CapLocking))
+	assert.False(t, CapLocking.Has(CapLocking|CapMVCC))
+}
+
+func TestExecuteSkipsOpsWithMissingCapabilities(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.AssertHoldsLock(1)
+	txn1.Checkpoint("after_set")
+	txn1.Commit()
+
+	results := exec.Execute(true)
+
+	assert.Empty(t, results.AssertionFailures())
+	assert.Nil(t, results.Checkpoint("after_set"))
+	skipped := results.SkippedOps()
+	assert.Len(t, skipped, 2)
+	assert.Equal(t, CapLocking, skipped[0].Missing)
+	assert.Equal(t, CapSnapshot, skipped[1].Missing)
+	assert.Equal(t, []string{MethodBeginTx, MethodSet, MethodCommit}, methodsOf(db.Calls()))
+}
+
+func TestAssertRecordsFailedInvariants(t *testing.T) {
+	db := NewMockDatabase()
+	db.SetGetValue(1, 10)
+	exec := NewTxnsExecutor(db)
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 10)
+	read := txn1.Get(1)
+	txn1.Assert("reads its own write", func() bool { return exec.resultStore.GetValue(read) == 10 })
+	txn1.Assert("reads a value it never wrote", func() bool { return exec.resultStore.GetValue(read) == 11 })
+	txn1.Commit()
+
+	results := exec.Execute(false)
+
+	assert.Equal(t, []AssertionFailure{{TxnName: "txn1", OpIndex: 4, Description: "reads a value it never wrote"}},
+		results.AssertionFailures())
+	assert.Equal(t, OutcomeCommitted, results.Outcome("txn1"), "a failed assertion does not stop the transaction")
+}
+
+func TestNewTxnPanicsOnDuplicateName(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	exec.AddDatabase("other", NewMockDatabase())
+	exec.NewTxn("txn1")
+
+	assert.Panics(t, func() { exec.NewTxn("txn1") })
+	assert.Panics(t, func() { exec.NewTxnOn("txn1", "other") }, "names are shared across databases")
+}
+
+// versionedMockDatabase is a MockDatabase that reports a fixed version history for every key
+type versionedMockDatabase struct {
+	*MockDatabase
+	versions []VersionInfo
+}
+
+func (m *versionedMockDatabase) Capabilities() Capability {
+	return CapMVCC
+}
+
+func (m *versionedMockDatabase) VersionHistory(key int) []VersionInfo {
+	return m.versions
+}
+
+// historianMockDatabase is a MockDatabase that reports a fixed history for every key
+type historianMockDatabase struct {
+	*MockDatabase
+	history []int
+}
+
+func (m *historianMockDatabase) History(key int) []int {
+	return m.history
+}
+
+func TestPrintHistoryLogsCommittedValues(t *testing.T) {
+	exec := NewTxnsExecutor(&historianMockDatabase{MockDatabase: NewMockDatabase(), history: []int{10, 11}})
+	var buf bytes.Buffer
+	exec.SetLogger(NewSlogLogger(&buf, slog.LevelInfo))
+	exec.NewTxn("txn1").PrintHistory(1)
+	exec.Execute(false)
+	assert.Contains(t, buf.String(), `msg="key history" txn=txn1 key=1 values="[10 11]"`)
+
+	exec = NewTxnsExecutor(NewMockDatabase())
+	buf.Reset()
+	exec.SetLogger(NewSlogLogger(&buf, slog.LevelInfo))
+	exec.NewTxn("txn1").PrintHistory(1)
+	results := exec.Execute(false)
+	assert.Contains(t, buf.String(), `msg="database keeps no history" txn=txn1 key=1`)
+	assert.Empty(t, results.Errors())
+}
+
+func TestVersionHistoryRecordsAllVersions(t *testing.T) {
+	versions := []VersionInfo{
+		{TxId: 1, Value: 10, BeginTs: 1, EndTs: 3, Status: VersionCommitted},
+		{TxId: 2, Value: 11, BeginTs: 2, Status: VersionAborted},
+		{TxId: 3, Value: 12, BeginTs: 3, Status: VersionCommitted},
+	}
+	db := &versionedMockDatabase{MockDatabase: NewMockDatabase(), versions: versions}
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	history := txn1.VersionHistory(1)
+	txn1.Commit()
+
+	results := exec.Execute(true)
+
+	assert.Equal(t, versions, results.Versions(history))
+	assert.Equal(t, "aborted", results.Versions(history)[1].Status.String())
+	assert.Empty(t, results.SkippedOps())
+}
+
+func TestVersionHistoryIsSkippedWithoutMVCC(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	history := txn1.VersionHistory(1)
+	txn1.Commit()
+
+	results := exec.Execute(true)
+
+	assert.Nil(t, results.Versions(history))
+	assert.Len(t, results.SkippedOps(), 1)
+	assert.Equal(t, CapMVCC, results.SkippedOps()[0].Missing)
+}
+
+func TestSetCommitOrderOrdersOnlyCommits(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Barrier("txn1_wrote")
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.BeginTx()
+	txn2.WaitFor("txn1_wrote")
+	txn2.Set(2, 200)
+	txn2.Commit()
+
+	exec.SetCommitOrder("txn2", "txn1")
+	exec.Execute(true)
+
+	calls := db.Calls()
+	commits := callsOf(calls, MethodCommit)
+	assert.Equal(t, []int64{txnIdForKey(calls, 2), txnIdForKey(calls, 1)}, []int64{commits[0].TxId, commits[1].TxId})
+	sets := callsOf(calls, MethodSet)
+	assert.Equal(t, []int{1, 2}, []int{sets[0].Key, sets[1].Key}, "writes should still follow the barriers")
+}
+
+func TestValidateRejectsImpossibleCommitOrder(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Commit()
+	txn1.Barrier("txn1_committed")
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.BeginTx()
+	txn2.WaitFor("txn1_committed")
+	txn2.Commit()
+
+	exec.SetCommitOrder("txn2", "txn1")
+	err := exec.Validate()
+	assert.ErrorContains(t, err, "txn1 op 1 (COMMIT)")
+	assert.Panics(t, func() { exec.Execute(false) })
+
+	exec.SetCommitOrder("txn1", "txn2")
+	assert.NoError(t, exec.Validate())
+}
+
+func TestValidateRejectsBrokenBarriers(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	txn1 := exec.NewTxn("txn1")
+	txn1.WaitFor("never_signaled")
+	assert.ErrorContains(t, exec.Validate(), `barrier "never_signaled", which no transaction signals`)
+
+	exec = NewTxnsExecutor(NewMockDatabase())
+	exec.NewTxn("txn1").Barrier("twice")
+	exec.NewTxn("txn2").Barrier("twice")
+	assert.ErrorContains(t, exec.Validate(), `barrier "twice" is signaled by both`)
+
+	exec = NewTxnsExecutor(NewMockDatabase())
+	txn1 = exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Rollback()
+	exec.SetCommitOrder("txn1")
+	assert.ErrorContains(t, exec.Validate(), "schedules 0 commits instead of 1")
+}
+
+func TestValidateRejectsBrokenCountedBarriers(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	exec.NewTxn("txn1").BarrierN("ready", 2)
+	exec.NewTxn("txn2").BarrierN("ready", 2)
+	exec.NewTxn("txn3").WaitFor("ready")
+	assert.NoError(t, exec.Validate())
+
+	exec = NewTxnsExecutor(NewMockDatabase())
+	exec.NewTxn("txn1").BarrierN("ready", 2)
+	exec.NewTxn("txn2").BarrierN("ready", 3)
+	assert.ErrorContains(t, exec.Validate(), `barrier "ready" needs 2 signals at txn txn1 op 0 but 3 at txn txn2 op 0`)
+
+	exec = NewTxnsExecutor(NewMockDatabase())
+	exec.NewTxn("txn1").BarrierN("ready", 2)
+	exec.NewTxn("txn2").Barrier("ready")
+	assert.ErrorContains(t, exec.Validate(), `barrier "ready" is signaled by both`)
+
+	exec = NewTxnsExecutor(NewMockDatabase())
+	exec.NewTxn("txn1").BarrierN("ready", 3)
+	exec.NewTxn("txn2").BarrierN("ready", 3)
+	exec.NewTxn("txn3").WaitFor("ready")
+	assert.ErrorContains(t, exec.Validate(), "needs 3 signals, but only 2 operations signal it")
+
+	exec = NewTxnsExecutor(NewMockDatabase())
+	txn1 := exec.NewTxn("txn1")
+	txn1.WaitFor("ready")
+	txn1.BarrierN("ready", 2)
+	exec.NewTxn("txn2").BarrierN("ready", 2)
+	assert.ErrorContains(t, exec.Validate(), "schedule can never complete")
+}
+
+func TestExecuteLogsFailedOperationsAtErrorLevel(t *testing.T) {
+	db := NewMockDatabase()
+	db.SetError(MethodSet, errors.New("set failed"))
+	exec := NewTxnsExecutor(db)
+	var buf bytes.Buffer
+	exec.SetLogger(NewSlogLogger(&buf, slog.LevelDebug))
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Commit()
+
+	exec.Execute(false)
+
+	assert.Contains(t, buf.String(), `level=ERROR msg="operation failed" txn=txn1 op=1 err="set failed"`)
+	assert.NotContains(t, buf.String(), "level=DEBUG", "debug tracing should only be logged when executing with debug")
+}
+
+func TestExecuteSubsetRunsOnlyNamedTxns(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Barrier("txn1_wrote")
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.BeginTx()
+	txn2.WaitFor("txn1_wrote")
+	txn2.Set(2, 200)
+	txn2.Commit()
+
+	txn3 := exec.NewTxn("txn3")
+	txn3.BeginTx()
+	txn3.Set(3, 300)
+	txn3.Commit()
+
+	assert.ErrorContains(t, exec.ValidateSubset([]string{"txn2", "txn3"}),
+		`waits for barrier "txn1_wrote", which is only signaled by excluded txn txn1`)
+	assert.Panics(t, func() { exec.ExecuteSubset([]string{"txn2"}, false) })
+	assert.ErrorContains(t, exec.ValidateSubset([]string{"txn4"}), "unknown txn txn4")
+
+	exec.ExecuteSubset([]string{"txn1", "txn3"}, true)
+
+	var setKeys []int
+	for _, call := range callsOf(db.Calls(), MethodSet) {
+		setKeys = append(setKeys, call.Key)
+	}
+	assert.ElementsMatch(t, []int{1, 3}, setKeys)
+	assert.Equal(t, 2, db.CallCount(MethodCommit))
+}
+
+// serialDatabase runs one transaction at a time: BeginTx blocks until the previous transaction has
+// committed or rolled back, so it can never lose an update
+type serialDatabase struct {
+	txnMu     sync.Mutex // held from BeginTx until Commit or Rollback
+	data      map[int]int
+	nextTxnId int64
+}
+
+func newSerialDatabase() *serialDatabase {
+	return &serialDatabase{data: make(map[int]int), nextTxnId: 1}
+}
+
+func (d *serialDatabase) BeginTx(isolationLevel string) (int64, error) {
+	d.txnMu.Lock()
+	txId := d.nextTxnId
+	d.nextTxnId++
+	return txId, nil
+}
+
+func (d *serialDatabase) Set(txId int64, key int, value int) error {
+	d.data[key] = value
+	return nil
+}
+
+func (d *serialDatabase) Get(txId int64, key int) (int, error) {
+	return d.data[key], nil
+}
+
+func (d *serialDatabase) Delete(txId int64, key int) error {
+	delete(d.data, key)
+	return nil
+}
+
+func (d *serialDatabase) Commit(txId int64) error {
+	d.txnMu.Unlock()
+	return nil
+}
+
+func (d *serialDatabase) Rollback(txId int64) error {
+	d.txnMu.Unlock()
+	return nil
+}
+
+func (d *serialDatabase) PrintState() {}
+
+func TestDetectLostUpdate(t *testing.T) {
+	// The mock's Set has no effect, so every increment is lost
+	assert.True(t, DetectLostUpdate(func() Database { return NewMockDatabase() }, 1))
+	assert.False(t, DetectLostUpdate(func() Database { return newSerialDatabase() }, 20))
+}
+
+func TestResultsRecordOperationErrors(t *testing.T) {
+	setErr := errors.New("set failed")
+	db := NewMockDatabase()
+	db.SetError(MethodSet, setErr)
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.BeginTx()
+	txn2.Commit()
+
+	results := exec.Execute(false)
+
+	assert.True(t, results.Failed("txn1"))
+	assert.False(t, results.Failed("txn2"))
+	opErrs := results.Errors()
+	assert.Len(t, opErrs, 1)
+	assert.Equal(t, 1, opErrs[0].OpIndex)
+	assert.ErrorIs(t, opErrs[0], setErr)
+}
+
+func TestNewTxnOnRoutesToNamedDatabase(t *testing.T) {
+	orders := NewMockDatabase()
+	payments := NewMockDatabase()
+	payments.SetGetValue(1, 50)
+	exec := NewTxnsExecutor(orders)
+	exec.AddDatabase("payments", payments)
+
+	// One business transaction spanning two services, as two independent database transactions
+	order := exec.NewTxn("order")
+	order.BeginTx()
+	order.Set(1, 100)
+	order.Commit()
+	order.Barrier("order_committed")
+
+	payment := exec.NewTxnOn("payment", "payments")
+	payment.WaitFor("order_committed")
+	payment.BeginTx()
+	balance := payment.Get(1)
+	payment.Set(1, 0)
+	payment.Commit()
+
+	results := exec.Execute(true)
+
+	assert.Equal(t, 50, results.GetValue(balance))
+	assert.Equal(t, []string{MethodBeginTx, MethodSet, MethodCommit}, methodsOf(orders.Calls()))
+	assert.Equal(t, []string{MethodBeginTx, MethodGet, MethodSet, MethodCommit}, methodsOf(payments.Calls()))
+
+	exec.NewTxnOn("inventory", "inventory").BeginTx()
+	assert.ErrorContains(t, exec.Validate(), `txn inventory targets unknown database "inventory"`)
+}
+
+// deadlockingMockDatabase is a MockDatabase that reports a deadlock, with the caller as the victim,
+// whenever a transaction writes deadlockKey
+type deadlockingMockDatabase struct {
+	*MockDatabase
+}
+
+const deadlockKey = 99
+
+func (m *deadlockingMockDatabase) Set(txId int64, key int, value int) error {
+	if err := m.MockDatabase.Set(txId, key, value); err != nil {
+		return err
+	}
+	if key == deadlockKey {
+		return &DeadlockError{Victim: txId, Cycle: []int64{txId, txId - 1}}
+	}
+	return nil
+}
+
+func TestDeadlockVictimsComeFromDeadlockError(t *testing.T) {
+	db := &deadlockingMockDatabase{MockDatabase: NewMockDatabase()}
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Barrier("T1_began")
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("T2")
+	txn2.WaitFor("T1_began")
+	txn2.BeginTx()
+	txn2.Set(deadlockKey, 200)
+	txn2.Set(2, 200) // not run: the database already aborted T2
+	txn2.Commit()
+
+	results := exec.Execute(true)
+
+	assert.True(t, results.HadDeadlock())
+	assert.Equal(t, []string{"T2"}, results.DeadlockVictims())
+	assert.Equal(t, OutcomeAborted, results.Outcome("T2"))
+	assert.Equal(t, OutcomeCommitted, results.Outcome("T1"))
+	assert.ErrorIs(t, results.Errors()[0], ErrDeadlock)
+	assert.ErrorIs(t, results.Errors()[0], ErrAborted)
+	assert.Equal(t, 1, db.CallCount(MethodCommit))
+}
+
+func TestCleanRunHasNoDeadlock(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Commit()
+
+	results := exec.Execute(false)
+
+	assert.False(t, results.HadDeadlock())
+	assert.Empty(t, results.DeadlockVictims())
+}
+
+// lockWaitingMockDatabase is a MockDatabase that counts every Get of lockedKey as a wait for a lock
+type lockWaitingMockDatabase struct {
+	*MockDatabase
+	mu    sync.Mutex
+	waits map[int64]int
+}
+
+const lockedKey = 7
+
+func (m *lockWaitingMockDatabase) Get(txId int64, key int) (int, error) {
+	if key == lockedKey {
+		m.mu.Lock()
+		m.waits[txId]++
+		m.mu.Unlock()
+	}
+	return m.MockDatabase.Get(txId, key)
+}
+
+func (m *lockWaitingMockDatabase) LockWaitCount(txId int64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.waits[txId]
+}
+
+func TestDidBlockFollowsLockWaitCount(t *testing.T) {
+	db := &lockWaitingMockDatabase{MockDatabase: NewMockDatabase(), waits: make(map[int64]int)}
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	free := txn1.Get(1)
+	locked := txn1.Get(lockedKey)
+	txn1.Commit()
+
+	results := exec.Execute(false)
+
+	assert.False(t, results.DidBlock(free))
+	assert.True(t, results.DidBlock(locked))
+}
+
+func TestDidBlockIsFalseWithoutLockWaitCounter(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	read := txn1.Get(lockedKey)
+	txn1.Commit()
+
+	results := exec.Execute(false)
+
+	assert.False(t, results.DidBlock(read))
+}
+
+func TestExecuteContextCancelledBeforeStartRunsNothing(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Commit()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := exec.ExecuteContext(ctx, false)
+
+	assert.Equal(t, 0, db.CallCount(MethodBeginTx))
+	assert.Equal(t, 0, db.CallCount(MethodRollback))
+	assert.Equal(t, OutcomeUnfinished, results.Outcome("T1"))
+}
+
+func TestWaitForCommitCountCountsOnlyCommits(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+
+	for i, name := range []string{"W1", "W2"} {
+		writer := exec.NewTxn(name)
+		writer.BeginTx()
+		writer.Set(i+1, 100)
+		writer.Commit()
+	}
+	aborter := exec.NewTxn("R")
+	aborter.BeginTx()
+	aborter.Set(3, 100)
+	aborter.Rollback()
+
+	checker := exec.NewTxn("check")
+	checker.WaitForCommitCount(2)
+	checker.BeginTx()
+	checker.Set(4, 100)
+	checker.Commit()
+
+	results := exec.Execute(false)
+
+	assert.Empty(t, results.Errors())
+	assert.Equal(t, OutcomeCommitted, results.Outcome("check"))
+	calls := db.Calls()
+	checkerId := txnIdForKey(calls, 4)
+	for i, call := range calls {
+		if call.TxId == checkerId {
+			assert.Len(t, callsOf(calls[:i], MethodCommit), 2, "check should begin only after both writers commit")
+			break
+		}
+	}
+}
+
+func TestWaitForCommitCountFailsWhenCommitsCannotHappen(t *testing.T) {
+	db := NewMockDatabase()
+	db.SetError(MethodCommit, errors.New("commit refused"))
+	exec := NewTxnsExecutor(db)
+
+	writer := exec.NewTxn("W")
+	writer.BeginTx()
+	writer.Set(1, 100)
+	writer.Commit()
+
+	checker := exec.NewTxn("check")
+	checker.WaitForCommitCount(1)
+	checker.BeginTx()
+	checker.Commit()
+
+	results := exec.Execute(false)
+
+	assert.Equal(t, OutcomeTimedOut, results.Outcome("check"))
+	opErrs := results.Errors()
+	assert.Len(t, opErrs, 2)
+	for _, opErr := range opErrs {
+		if opErr.TxnName == "check" {
+			assert.ErrorIs(t, opErr, ErrTimeout)
+		}
+	}
+}
+
+func TestValidateRejectsUnreachableCommitCount(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	writer := exec.NewTxn("W")
+	writer.BeginTx()
+	writer.Commit()
+	checker := exec.NewTxn("check")
+	checker.WaitForCommitCount(2)
+
+	assert.ErrorContains(t, exec.Validate(), "txn check op 0 waits for 2 commits, but at most 1 can happen before it")
+}
+
+func TestMatrixCoversEveryLevelAndAnomaly(t *testing.T) {
+	m := Matrix()
+	assert.Len(t, m, len(IsolationLevels))
+	for _, level := range IsolationLevels {
+		assert.Len(t, m[level], len(Anomalies), "level %s", level)
+		for _, anomaly := range Anomalies {
+			assert.Equal(t, m[level][anomaly], Expected(level, anomaly))
+		}
+	}
+	assert.Equal(t, Allowed, Expected(ReadCommitted, AnomalyLostUpdate))
+	assert.Equal(t, Prevented, Expected(Serializable, AnomalyG1c))
+	assert.Panics(t, func() { Expected("CHAOS", AnomalyG0) })
+}
+
+func TestWriteMatrix(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteMatrix(&buf))
+	want := "" +
+		"                    G0         G1a        G1b        G1c        P4\n" +
+		"READ_UNCOMMITTED    prevented  allowed    allowed    allowed    allowed\n" +
+		"READ_COMMITTED      prevented  prevented  prevented  prevented  allowed\n" +
+		"REPEATABLE_READ     prevented  prevented  prevented  prevented  prevented\n" +
+		"SNAPSHOT_ISOLATION  prevented  prevented  prevented  prevented  prevented\n" +
+		"SERIALIZABLE        prevented  prevented  prevented  prevented  prevented\n"
+	assert.Equal(t, want, buf.String())
+}
+
+// snapshotMockDatabase is a MockDatabase that begins snapshot transactions like any other
+type snapshotMockDatabase struct {
+	*MockDatabase
+}
+
+func (m *snapshotMockDatabase) Capabilities() Capability {
+	return CapMVCC
+}
+
+func (m *snapshotMockDatabase) BeginSnapshot() (int64, error) {
+	return m.MockDatabase.BeginTx("SNAPSHOT")
+}
+
+func TestBeginSnapshotStartsTxn(t *testing.T) {
+	db := &snapshotMockDatabase{MockDatabase: NewMockDatabase()}
+	exec := NewTxnsExecutor(db)
+
+	reporter := exec.NewTxn("reporter")
+	reporter.BeginSnapshot()
+	reporter.Get(1)
+	reporter.Commit()
+
+	results := exec.Execute(false)
+
+	calls := db.Calls()
+	assert.Equal(t, []string{MethodBeginTx, MethodGet, MethodCommit}, methodsOf(calls))
+	assert.Equal(t, "SNAPSHOT", calls[0].IsolationLevel)
+	assert.Equal(t, calls[0].TxId, calls[1].TxId)
+	assert.Equal(t, calls[0].TxId, results.TxnId("reporter"))
+	assert.Equal(t, OutcomeCommitted, results.Outcome("reporter"))
+}
+
+func TestBeginSnapshotIsSkippedWithoutMVCC(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	reporter := exec.NewTxn("reporter")
+	reporter.BeginSnapshot()
+
+	results := exec.Execute(false)
+
+	assert.Len(t, results.SkippedOps(), 1)
+	assert.Equal(t, CapMVCC, results.SkippedOps()[0].Missing)
+}
+
+func TestCertifySerializable(t *testing.T) {
+	CertifySerializable(t, func() Database { return newSerialDatabase() })
+}
+
+func TestCertifyRunReportsNonSerializableHistory(t *testing.T) {
+	// The mock's Set has no effect, so reads never see the values that were written
+	failure := certifyRun(NewMockDatabase(), 0)
+	assert.Contains(t, failure, "history with seed 0 is not serializable")
+	assert.Contains(t, failure, "T1", "the failure should include the history")
+}
+
+func TestParallelRunsGroupsOnTheSameTxn(t *testing.T) {
+	db := NewMockDatabase()
+	db.SetGetValue(3, 30)
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	var read *GetResult
+	txn1.Parallel(
+		func(g *Txn) {
+			g.Set(1, 100)
+			g.Set(2, 200)
+		},
+		func(g *Txn) {
+			read = g.Get(3)
+		},
+	)
+	after := txn1.Get(3)
+	txn1.Commit()
+
+	assert.NoError(t, exec.Validate())
+	results := exec.Execute(false)
+
+	calls := db.Calls()
+	assert.Len(t, calls, 6)
+	for _, call := range calls {
+		assert.Equal(t, calls[0].TxId, call.TxId, "every group should use the transaction's id")
+	}
+	assert.Equal(t, MethodCommit, calls[len(calls)-1].Method)
+	assert.Equal(t, 30, results.GetValue(read))
+	assert.Equal(t, []*GetResult{read, after}, exec.Reads("T1"))
+	assert.Equal(t, OutcomeCommitted, results.Outcome("T1"))
+}
+
+func TestParallelRejectsTxnBoundaries(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	assert.PanicsWithValue(t, "txn T1: Parallel group 1 schedules COMMIT, which cannot run concurrently", func() {
+		txn1.Parallel(
+			func(g *Txn) { g.Set(1, 100) },
+			func(g *Txn) { g.Commit() },
+		)
+	})
+}
+
+func TestWaitForOrTimeoutRecordsHowTheWaitEnded(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+
+	late := exec.NewTxn("late")
+	late.WaitForWithTimeout("early_done", time.Second) // signaled once early gives up on it
+	late.Barrier("late_signal")
+
+	prompt := exec.NewTxn("prompt")
+	prompt.Barrier("prompt_signal")
+
+	early := exec.NewTxn("early")
+	timedOut := early.WaitForOrTimeout("late_signal", 20*time.Millisecond)
+	signaled := early.WaitForOrTimeout("prompt_signal", time.Second)
+	early.Barrier("early_done")
+	early.BeginTx()
+	early.Set(1, 100)
+	early.Commit()
+
+	results := exec.Execute(false)
+
+	assert.Empty(t, results.Errors())
+	assert.Equal(t, OutcomeCommitted, results.Outcome("early"))
+	wasTimedOut, ok := results.WaitTimedOut(timedOut)
+	assert.True(t, ok)
+	assert.True(t, wasTimedOut, "late_signal is only signaled after early stops waiting")
+	wasTimedOut, ok = results.WaitTimedOut(signaled)
+	assert.True(t, ok)
+	assert.False(t, wasTimedOut)
+}
+
+func TestSerializationOrderOfSerialRunIsCommitOrder(t *testing.T) {
+	exec := NewTxnsExecutor(newSerialDatabase())
+
+	first := exec.NewTxn("first")
+	first.BeginTx()
+	first.Set(1, 10)
+	first.Get(2)
+	first.Commit()
+	first.Barrier("first_done")
+
+	second := exec.NewTxn("second")
+	second.WaitFor("first_done")
+	second.BeginTx()
+	second.Get(1)
+	second.Set(2, 20)
+	second.Commit()
+	second.Barrier("second_done")
+
+	rolledBack := exec.NewTxn("rolled_back")
+	rolledBack.WaitFor("second_done")
+	rolledBack.BeginTx()
+	rolledBack.Set(1, 30)
+	rolledBack.Rollback()
+
+	results := exec.Execute(false)
+
+	assert.Equal(t, []string{"first", "second"}, results.SerializationOrder(), "only committed txns are ordered")
+}
+
+// timestampMockDatabase is a MockDatabase that assigns each transaction the read timestamp txId*10
+type timestampMockDatabase struct {
+	*MockDatabase
+}
+
+func (m *timestampMockDatabase) ReadTimestamp(txId int64) (int64, bool) {
+	return txId * 10, true
+}
+
+func TestResultsReadTimestamp(t *testing.T) {
+	exec := NewTxnsExecutor(&timestampMockDatabase{MockDatabase: NewMockDatabase()})
+
+	for _, name := range []string{"T1", "T2"} {
+		txn := exec.NewTxn(name)
+		txn.BeginTx()
+		txn.Get(1)
+		txn.Commit()
+	}
+	exec.NewTxn("idle").Barrier("never_began")
+
+	results := exec.Execute(false)
+
+	for _, name := range []string{"T1", "T2"} {
+		ts, ok := results.ReadTimestamp(name)
+		assert.True(t, ok)
+		assert.Equal(t, results.TxnId(name)*10, ts)
+	}
+	_, ok := results.ReadTimestamp("idle")
+	assert.False(t, ok)
+}
+
+// buildTwoWriters builds a two-transaction schedule whose barriers are named with prefix
+func buildTwoWriters(prefix string, value int, waitForCommit bool) *TxnsExecutor {
+	exec := NewTxnsExecutor(NewMockDatabase())
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, value)
+	txn1.Barrier(prefix + "wrote")
+	txn1.Commit()
+	txn1.Barrier(prefix + "committed")
+
+	txn2 := exec.NewTxn("txn2")
+	if waitForCommit {
+		txn2.WaitFor(prefix + "committed")
+	} else {
+		txn2.WaitFor(prefix + "wrote")
+	}
+	txn2.BeginTx()
+	txn2.Parallel(func(g *Txn) { g.Get(1) }, func(g *Txn) { g.Get(2) })
+	txn2.Commit()
+	return exec
+}
+
+func TestSchedulesEquivalent(t *testing.T) {
+	base := buildTwoWriters("a_", 100, true)
+
+	assert.True(t, SchedulesEquivalent(base, base))
+	assert.True(t, SchedulesEquivalent(base, buildTwoWriters("b_", 100, true)), "barrier names are incidental")
+	assert.False(t, SchedulesEquivalent(base, buildTwoWriters("a_", 101, true)), "a different value written")
+	assert.False(t, SchedulesEquivalent(base, buildTwoWriters("a_", 100, false)), "txn2 waits for a different point in txn1")
+
+	extra := buildTwoWriters("a_", 100, true)
+	extra.NewTxn("txn3").BeginTx()
+	assert.False(t, SchedulesEquivalent(base, extra))
+
+	ordered := buildTwoWriters("a_", 100, true)
+	ordered.SetCommitOrder("txn1", "txn2")
+	assert.False(t, SchedulesEquivalent(base, ordered))
+}
+
+func TestBeginTxWithIsolationPassesLevel(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTxWithIsolation(Serializable)
+	txn1.Barrier("T1_began")
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("T2")
+	txn2.WaitFor("T1_began")
+	txn2.BeginTx()
+	txn2.Commit()
+
+	exec.Execute(false)
+
+	var levels []string
+	for _, call := range db.Calls() {
+		if call.Method == MethodBeginTx {
+			levels = append(levels, call.IsolationLevel)
+		}
+	}
+	assert.Equal(t, []string{"SERIALIZABLE", "READ_UNCOMMITTED"}, levels)
+}
+
+// buildLostUpdate schedules two read-then-write transactions on key 1, with no barriers
+func buildLostUpdate(exec *TxnsExecutor) {
+	for _, name := range []string{"T1", "T2"} {
+		txn := exec.NewTxn(name)
+		txn.BeginTx()                   // op 0
+		read := txn.Get(1)              // op 1
+		txn.SetComputed(1, func() int { // op 2
+			return exec.resultStore.GetValue(read) + 1
+		})
+		txn.Commit() // op 3
+	}
+}
+
+func TestExecuteScheduleRunsStepsInOrder(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+	buildLostUpdate(exec)
+
+	steps := []Step{{"T1", 0}, {"T2", 0}, {"T1", 1}, {"T2", 1}, {"T1", 2}, {"T1", 3}, {"T2", 2}, {"T2", 3}}
+	results := exec.ExecuteSchedule(steps, false)
+
+	calls := db.Calls()
+	assert.Equal(t, []string{MethodBeginTx, MethodBeginTx, MethodGet, MethodGet, MethodSet, MethodCommit, MethodSet, MethodCommit}, methodsOf(calls))
+	assert.Equal(t, results.TxnId("T1"), calls[4].TxId)
+	assert.Equal(t, results.TxnId("T2"), calls[6].TxId)
+	assert.Equal(t, 1, calls[6].Value, "T2 writes the increment of the 0 it read before T1 committed")
+	assert.Equal(t, OutcomeCommitted, results.Outcome("T1"))
+	assert.Equal(t, OutcomeCommitted, results.Outcome("T2"))
+}
+
+func TestValidateSteps(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	buildLostUpdate(exec)
+
+	assert.NoError(t, exec.ValidateSteps([]Step{{"T1", 0}, {"T1", 1}, {"T1", 2}, {"T1", 3}}))
+	assert.ErrorContains(t, exec.ValidateSteps([]Step{{"T3", 0}}), "unknown txn T3")
+	assert.ErrorContains(t, exec.ValidateSteps([]Step{{"T1", 4}}), "has no op 4")
+	assert.ErrorContains(t, exec.ValidateSteps([]Step{{"T1", 1}, {"T1", 0}}), "comes after")
+	assert.ErrorContains(t, exec.ValidateSteps([]Step{{"T1", 0}, {"T1", 1}, {"T1", 3}}), "op 2 (SET_COMPUTED")
+	assert.Panics(t, func() { exec.ExecuteSchedule([]Step{{"T1", 0}, {"T1", 0}}, false) })
+}
+
+// scanMockDatabase is a MockDatabase whose Scan returns the keys in range of a fixed table
+type scanMockDatabase struct {
+	*MockDatabase
+	table map[int]int
+}
+
+func (m *scanMockDatabase) Scan(txId int64, lo, hi int) (map[int]int, error) {
+	rows := make(map[int]int)
+	for key, value := range m.table {
+		if lo <= key && key <= hi {
+			rows[key] = value
+		}
+	}
+	return rows, nil
+}
+
+func TestScanStoresRows(t *testing.T) {
+	exec := NewTxnsExecutor(&scanMockDatabase{MockDatabase: NewMockDatabase(), table: map[int]int{1: 10, 5: 50, 9: 90}})
+	txn := exec.NewTxn("T1")
+	txn.BeginTx()
+	scan := txn.Scan(2, 9)
+	txn.Commit()
+
+	results := exec.Execute(false)
+
+	assert.Equal(t, map[int]int{5: 50, 9: 90}, results.Rows(scan))
+	assert.Empty(t, results.SkippedOps())
+}
+
+func TestScanIsSkippedWithoutCapScan(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	txn := exec.NewTxn("T1")
+	txn.BeginTx()
+	scan := txn.Scan(1, 10)
+	txn.Commit()
+
+	results := exec.Execute(false)
+
+	assert.Nil(t, results.Rows(scan))
+	assert.Len(t, results.SkippedOps(), 1)
+}
+
+func TestSavepointIsSkippedWithoutCapSavepoint(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	txn := exec.NewTxn("T1")
+	txn.BeginTx()
+	txn.Savepoint("sp")
+	txn.Set(1, 10)
+	txn.RollbackTo("sp")
+	txn.Commit()
+
+	results := exec.Execute(false)
+
+	skipped := results.SkippedOps()
+	assert.Len(t, skipped, 2)
+	for _, skip := range skipped {
+		assert.Equal(t, CapSavepoint, skip.Missing)
+	}
+	assert.Empty(t, results.Errors())
+}
+
+func TestSetIfSkipsWriteWhenConditionIsFalse(t *testing.T) {
+	db := NewMockDatabase()
+	db.SetGetValue(1, 5)
+	exec := NewTxnsExecutor(db)
+	txn := exec.NewTxn("T1")
+	txn.BeginTx()
+	read := txn.Get(1)
+	txn.SetIf(1, func() int { return 6 }, func() bool { return exec.resultStore.GetValue(read) == 5 })
+	txn.SetIf(2, func() int { return 7 }, func() bool { return exec.resultStore.GetValue(read) != 5 })
+	txn.Commit()
+
+	results := exec.Execute(false)
+
+	sets := callsOf(db.Calls(), MethodSet)
+	if assert.Len(t, sets, 1) {
+		assert.Equal(t, 1, sets[0].Key)
+		assert.Equal(t, 6, sets[0].Value)
+	}
+	assert.Empty(t, results.Errors())
+}
+
+// flakyMockDatabase is a MockDatabase whose first failures calls of Set fail with a DeadlockError
+type flakyMockDatabase struct {
+	*MockDatabase
+	failures int
+}
+
+func (m *flakyMockDatabase) Set(txId int64, key int, value int) error {
+	if err := m.MockDatabase.Set(txId, key, value); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failures > 0 {
+		m.failures--
+		return &DeadlockError{Victim: txId, Cycle: []int64{txId}}
+	}
+	return nil
+}
+
+func TestWithRetryRerunsFromBegin(t *testing.T) {
+	db := &flakyMockDatabase{MockDatabase: NewMockDatabase(), failures: 2}
+	exec := NewTxnsExecutor(db)
+	txn := exec.NewTxn("T1")
+	txn.WithRetry(2)
+	txn.WaitFor("ready")
+	txn.BeginTx()
+	txn.Get(1)
+	txn.Barrier("read") // signaled by every attempt
+	txn.Set(1, 10)
+	txn.Commit()
+	other := exec.NewTxn("T2")
+	other.Barrier("ready")
+
+	results := exec.Execute(false)
+
+	assert.Equal(t, 3, db.CallCount(MethodBeginTx))
+	assert.Equal(t, 3, db.CallCount(MethodSet))
+	assert.Equal(t, 1, db.CallCount(MethodCommit))
+	assert.Equal(t, 2, results.Retries("T1"))
+	assert.Equal(t, OutcomeCommitted, results.Outcome("T1"))
+	assert.Len(t, results.Errors(), 2, "the errors of the failed attempts are kept")
+}
+
+func TestWithRetryGivesUpAfterMax(t *testing.T) {
+	db := &flakyMockDatabase{MockDatabase: NewMockDatabase(), failures: 2}
+	exec := NewTxnsExecutor(db)
+	txn := exec.NewTxn("T1")
+	txn.WithRetry(1)
+	txn.BeginTx()
+	txn.Set(1, 10)
+	txn.Commit()
+
+	results := exec.Execute(false)
+
+	assert.Equal(t, 2, db.CallCount(MethodBeginTx))
+	assert.Equal(t, 0, db.CallCount(MethodCommit))
+	assert.Equal(t, 1, results.Retries("T1"))
+	assert.True(t, results.Failed("T1"))
+}
+
+func TestCommitAndAbortHooks(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+	var committed, aborted []string
+	exec.OnCommit(func(txnName string) { committed = append(committed, txnName) })
+	exec.OnAbort(func(txnName string) { aborted = append(aborted, txnName) })
+
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	txn1.Set(1, 10)
+	txn1.Commit()
+	txn1.Barrier("t1_committed")
+
+	txn2 := exec.NewTxn("T2")
+	txn2.WaitFor("t1_committed")
+	txn2.BeginTx()
+	txn2.Set(1, 20)
+	txn2.Commit()
+
+	txn3 := exec.NewTxn("T3")
+	txn3.BeginTx()
+	txn3.Set(2, 30)
+	txn3.Rollback()
+
+	exec.Execute(false)
+
+	assert.Equal(t, []string{"T1", "T2"}, committed)
+	assert.Equal(t, []string{"T3"}, aborted)
+}
+
+func TestAbortHookRunsForTimedOutTxn(t *testing.T) {
+	db := NewMockDatabase()
+	exec := NewTxnsExecutor(db)
+	var aborted []string
+	exec.OnAbort(func(txnName string) { aborted = append(aborted, txnName) })
+
+	txn := exec.NewTxn("T1")
+	txn.SetTimeout(10 * time.Millisecond)
+	txn.BeginTx()
+	txn.SetComputed(1, func() int {
+		time.Sleep(50 * time.Millisecond)
+		return 1
+	})
+	txn.Commit()
+
+	results := exec.Execute(false)
+
+	assert.Equal(t, OutcomeTimedOut, results.Outcome("T1"))
+	assert.Equal(t, []string{"T1"}, aborted)
+}
+
+func TestCommitOrElseRunsOnlyWhenTheCommitAborts(t *testing.T) {
+	for _, tc := range []struct {
+		commitErr error
+		aborted   bool
+	}{
+		{commitErr: nil},
+		{commitErr: ErrSerializationFailure, aborted: true},
+		{commitErr: errors.New("disk full")},
+	} {
+		db := NewMockDatabase()
+		db.SetError(MethodCommit, tc.commitErr)
+		exec := NewTxnsExecutor(db)
+		ranElse := false
+		txn := exec.NewTxn("txn1")
+		txn.BeginTx()
+		txn.Set(1, 10)
+		txn.CommitOrElse(func() { ranElse = true })
+
+		exec.Execute(false)
+
+		assert.Equal(t, tc.aborted, ranElse, "commit error %v", tc.commitErr)
+	}
+}
+
+func TestSleepDelaysOnlyItsOwnTxn(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	exec.SetTracing(true)
+	var t2Done time.Time
+	exec.OnCommit(func(txnName string) {
+		if txnName == "T2" {
+			t2Done = time.Now()
+		}
+	})
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	txn1.Sleep(50 * time.Millisecond)
+	txn1.Commit()
+	txn2 := exec.NewTxn("T2")
+	txn2.BeginTx()
+	txn2.Commit()
+
+	start := time.Now()
+	results := exec.Execute(false)
+
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	assert.Less(t, t2Done.Sub(start), 50*time.Millisecond, "T2 ran while T1 slept")
+	assert.Equal(t, OutcomeCommitted, results.Outcome("T1"))
+	kinds := make([]string, 0, 3)
+	for _, event := range exec.Trace() {
+		if event.TxnName == "T1" {
+			kinds = append(kinds, event.Kind)
+		}
+	}
+	assert.Equal(t, []string{OpBegin, TraceSleep, OpCommit}, kinds)
+}
+
+func TestTraceRecordsExecutedOperationsInOrder(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	exec.SetTracing(true)
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	txn1.Set(1, 10)
+	txn1.Barrier("t1_wrote")
+	txn1.Commit()
+	txn2 := exec.NewTxn("T2")
+	txn2.WaitFor("t1_wrote")
+	txn2.BeginTx()
+	txn2.Get(1)
+	txn2.Commit()
+
+	exec.Execute(false)
+	trace := exec.Trace()
+
+	var t1, t2 []string
+	for i, event := range trace {
+		if i > 0 {
+			assert.False(t, event.Time.Before(trace[i-1].Time), "events are in the order they finished")
+		}
+		if event.TxnName == "T1" {
+			t1 = append(t1, event.Kind)
+		} else {
+			t2 = append(t2, event.Kind)
+		}
+	}
+	assert.Equal(t, []string{OpBegin, OpSet, TraceBarrier, OpCommit}, t1)
+	assert.Equal(t, []string{TraceWaitFor, OpBegin, OpGet, OpCommit}, t2)
+	barrier := slices.IndexFunc(trace, func(event TraceEvent) bool { return event.Kind == TraceBarrier })
+	wait := slices.IndexFunc(trace, func(event TraceEvent) bool { return event.Kind == TraceWaitFor })
+	assert.Less(t, barrier, wait, "the wait ends after the barrier is signaled")
+	assert.Equal(t, "t1_wrote", trace[wait].Barrier)
+
+	exec.SetTracing(false)
+	exec.Execute(false)
+	assert.Empty(t, exec.Trace())
+}
+
+// lockReportingMockDatabase is a MockDatabase whose writes report waiting for and then acquiring a row lock
+type lockReportingMockDatabase struct {
+	*MockDatabase
+	observer LockObserver
+}
+
+func (m *lockReportingMockDatabase) SetLockObserver(observer LockObserver) {
+	m.observer = observer
+}
+
+func (m *lockReportingMockDatabase) Set(txId int64, key int, value int) error {
+	if m.observer != nil {
+		m.observer.OnLockWait(txId, key)
+		m.observer.OnLockAcquired(txId, key)
+	}
+	return m.MockDatabase.Set(txId, key, value)
+}
+
+func TestTraceRecordsLockWaits(t *testing.T) {
+	db := &lockReportingMockDatabase{MockDatabase: NewMockDatabase()}
+	exec := NewTxnsExecutor(db)
+	exec.SetTracing(true)
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	txn1.Set(7, 10)
+	txn1.Commit()
+
+	exec.Execute(false)
+
+	var kinds []string
+	for _, event := range exec.Trace() {
+		kinds = append(kinds, event.Kind)
+	}
+	assert.Equal(t, []string{OpBegin, TraceLockWait, TraceLockAcquired, OpSet, OpCommit}, kinds)
+	wait := exec.Trace()[1]
+	assert.Equal(t, 7, wait.Key)
+	assert.Equal(t, 1, wait.OpIndex, "the event belongs to the Set that waited")
+	assert.Equal(t, "LOCK_WAIT 7", wait.Description)
+	assert.Nil(t, db.observer, "the observer is detached after the run")
+
+	exec.SetTracing(false)
+	exec.Execute(false)
+	assert.Empty(t, exec.Trace())
+}
+
+func TestToMermaid(t *testing.T) {
+	trace := []TraceEvent{
+		{TxnName: "T1", OpIndex: 0, Kind: OpBegin, Description: "BEGIN_TX"},
+		{TxnName: "T1", OpIndex: 1, Kind: OpSet, Description: "SET 1 = 10"},
+		{TxnName: "T1", OpIndex: 2, Kind: TraceBarrier, Barrier: "t1_wrote"},
+		{TxnName: "txn 2", OpIndex: 0, Kind: TraceWaitFor, Barrier: "t1_wrote"},
+		{TxnName: "txn 2", OpIndex: 1, Kind: OpGet, Description: "GET 1", Err: errors.New("no; way")},
+		{TxnName: "T1", OpIndex: 3, Kind: OpCommit, Description: "COMMIT"},
+	}
+
+	want := `sequenceDiagram
+    participant p0 as T1
+    participant p1 as txn 2
+    participant DB
+    p0->>DB: BEGIN_TX
+    p0->>DB: SET 1 = 10
+    Note over p0: BARRIER t1_wrote
+    Note over p1: WAIT_FOR t1_wrote
+    p1-xDB: GET 1 failed: no#59; way
+    p0->>DB: COMMIT
+`
+	assert.Equal(t, want, ToMermaid(trace))
+}
+
+func TestGetComputedReadsKeyFromEarlierRead(t *testing.T) {
+	db := NewMockDatabase()
+	db.SetGetValue(1, 5) // key 1 points to key 5
+	db.SetGetValue(5, 50)
+	exec := NewTxnsExecutor(db)
+	txn := exec.NewTxn("T1")
+	txn.BeginTx()
+	pointer := txn.Get(1)
+	target := txn.GetComputed(func() int { return exec.resultStore.GetValue(pointer) })
+	txn.Commit()
+
+	results := exec.Execute(false)
+
+	assert.Equal(t, 50, results.GetValue(target))
+	gets := callsOf(db.Calls(), MethodGet)
+	if assert.Len(t, gets, 2) {
+		assert.Equal(t, 5, gets[1].Key)
+	}
+}
+
+func TestExecuteWithTimeoutReportsStuckTxns(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	release := make(chan struct{})
+	defer close(release)
+
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	txn1.SetComputed(1, func() int { // a write that never returns, as on a lock nobody releases
+		<-release
+		return 1
+	})
+	txn1.Barrier("t1_wrote")
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("T2")
+	txn2.WaitFor("t1_wrote")
+	txn2.BeginTx()
+	txn2.Commit()
+
+	start := time.Now()
+	results, err := exec.ExecuteWithTimeout(50*time.Millisecond, false)
+
+	assert.Less(t, time.Since(start), time.Second)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "txn T1 op 1 (SET_COMPUTED 1 = <computed>) running")
+		assert.Contains(t, err.Error(), "txn T2 op 0 waiting for barrier t1_wrote")
+	}
+	assert.Equal(t, OutcomeAborted, results.Outcome("T1"))
+}
+
+func TestExecuteWithTimeoutFinishesInTime(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	txn := exec.NewTxn("T1")
+	txn.BeginTx()
+	txn.Commit()
+
+	results, err := exec.ExecuteWithTimeout(time.Second, false)
+
+	assert.NoError(t, err)
+	assert.Equal(t, OutcomeCommitted, results.Outcome("T1"))
+
+	other := exec.NewTxn("T2")
+	other.WaitFor("typo")
+	_, err = exec.ExecuteWithTimeout(time.Second, false)
+	assert.Error(t, err, "an invalid schedule is an error, not a panic")
+}
+
+func TestStatsReportsBlockedTxnsDuringRun(t *testing.T) {
+	exec := NewTxnsExecutor(NewMockDatabase())
+	txn1 := exec.NewTxn("T1")
+	txn1.BeginTx()
+	txn1.WaitFor("go")
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("T2")
+	txn2.BeginTx()
+	txn2.Commit()
+
+	var during Stats
+	txn3 := exec.NewTxn("T3")
+	txn3.BeginTx()
+	txn3.SetComputed(1, func() int {
+		assert.Eventually(t, func() bool {
+			during = exec.Stats()
+			return during.Blocked == 1 && during.Finished == 1
+		}, time.Second, time.Millisecond)
+		return 1
+	})
+	txn3.Barrier("go")
+	txn3.Commit()
+
+	exec.Execute(false)
+
+	assert.Equal(t, Stats{
+		Running:    1,
+		Blocked:    1,
+		Finished:   1,
+		Committed:  1,
+		WaitingFor: map[string]string{"T1": "go"},
+	}, during)
+	assert.Equal(t, Stats{Finished: 3, Committed: 3, WaitingFor: map[string]string{}}, exec.Stats())
+}
@@ -0,0 +1,247 @@
+package anomalytest
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// scheduleNode identifies one operation in a schedule
+type scheduleNode struct {
+	txnName string
+	opIndex int
+}
+
+// Validate checks that the schedule can run to completion. It reports transactions on unknown databases,
+// barriers that are signaled twice, BarrierN barriers with mismatched counts or too few signals, waits for
+// barriers that nothing signals, waits for more commits than the schedule contains, an unusable commit
+// order, and any cycle in the happens-before order implied by program order, barriers and the commit
+// order, since such a schedule would hang.
+// Waits with a timeout are not treated as ordering constraints because they always finish.
+func (e *TxnsExecutor) Validate() error {
+	return e.fullSchedule().validate()
+}
+
+// ValidateSubset checks that the named transactions can run to completion on their own, as ExecuteSubset
+// would run them. Besides the checks made by Validate, it reports unknown names and waits for barriers that
+// only an excluded transaction signals.
+func (e *TxnsExecutor) ValidateSubset(names []string) error {
+	sched, err := e.subsetSchedule(names)
+	if err != nil {
+		return err
+	}
+	return sched.validate()
+}
+
+func (s schedule) validate() error {
+	names := make([]string, 0, len(s.txns))
+	for name := range s.txns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if txn := s.txns[name]; txn.db == nil {
+			return fmt.Errorf("txn %s targets unknown database %q", name, txn.dbName)
+		}
+	}
+
+	signals := make(map[string][]scheduleNode) // barrier name -> ops that signal it
+	counts := make(map[string]int)             // barrier name -> signals it needs, 0 for a plain Barrier
+	for _, name := range names {
+		for _, op := range s.txns[name].operations {
+			if op.kind != opBarrier {
+				continue
+			}
+			if prevs, ok := signals[op.barrierName]; ok {
+				prev := prevs[0]
+				if op.count == 0 || counts[op.barrierName] == 0 {
+					return fmt.Errorf("barrier %q is signaled by both txn %s op %d and txn %s op %d",
+						op.barrierName, prev.txnName, prev.opIndex, name, op.opIndex)
+				}
+				if op.count != counts[op.barrierName] {
+					return fmt.Errorf("barrier %q needs %d signals at txn %s op %d but %d at txn %s op %d",
+						op.barrierName, counts[op.barrierName], prev.txnName, prev.opIndex, op.count, name, op.opIndex)
+				}
+			}
+			signals[op.barrierName] = append(signals[op.barrierName], scheduleNode{name, op.opIndex})
+			counts[op.barrierName] = op.count
+		}
+	}
+	for _, barrierName := range slices.Sorted(maps.Keys(signals)) {
+		if needed, have := counts[barrierName], len(signals[barrierName]); have < needed {
+			first := signals[barrierName][0]
+			return fmt.Errorf("barrier %q signaled by txn %s op %d needs %d signals, but only %d operations signal it",
+				barrierName, first.txnName, first.opIndex, needed, have)
+		}
+	}
+
+	commits := make(map[string]int) // txn name -> number of commits it schedules
+	totalCommits := 0
+	for _, name := range names {
+		for _, op := range s.txns[name].operations {
+			if op.kind == opDatabase && op.name == OpCommit {
+				commits[name]++
+				totalCommits++
+			}
+		}
+	}
+	for _, name := range names {
+		ownCommits := 0 // commits the txn itself makes before the wait
+		for _, op := range s.txns[name].operations {
+			if op.kind == opDatabase && op.name == OpCommit {
+				ownCommits++
+			}
+			if op.kind == opWaitForCommitCount {
+				if possible := totalCommits - commits[name] + ownCommits; possible < op.count {
+					return fmt.Errorf("txn %s op %d waits for %d commits, but at most %d can happen before it",
+						name, op.opIndex, op.count, possible)
+				}
+			}
+		}
+	}
+
+	edges := make(map[scheduleNode][]scheduleNode)
+	for _, name := range names {
+		ops := s.txns[name].operations
+		for i, op := range ops {
+			node := scheduleNode{name, op.opIndex}
+			if i+1 < len(ops) {
+				edges[node] = append(edges[node], scheduleNode{name, ops[i+1].opIndex})
+			}
+			if op.kind == opWaitFor {
+				signalers, ok := signals[op.barrierName]
+				if !ok {
+					if excluded := s.excludedSignaler(op.barrierName); excluded != "" {
+						return fmt.Errorf("txn %s op %d waits for barrier %q, which is only signaled by excluded txn %s",
+							name, op.opIndex, op.barrierName, excluded)
+					}
+					return fmt.Errorf("txn %s op %d waits for barrier %q, which no transaction signals", name, op.opIndex, op.barrierName)
+				}
+				if len(signalers) == max(counts[op.barrierName], 1) {
+					// every signal is needed; with spare signalers no single one is, so none orders the wait
+					for _, signal := range signalers {
+						edges[signal] = append(edges[signal], node)
+					}
+				}
+			}
+		}
+	}
+
+	var prevCommit *scheduleNode
+	seen := make(map[string]bool)
+	for _, name := range s.commitOrder {
+		txn, ok := s.txns[name]
+		if !ok {
+			return fmt.Errorf("commit order names unknown txn %s", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("commit order names txn %s more than once", name)
+		}
+		seen[name] = true
+		var commits []scheduleNode
+		for _, op := range txn.operations {
+			if op.kind == opDatabase && op.name == OpCommit {
+				commits = append(commits, scheduleNode{name, op.opIndex})
+			}
+		}
+		if len(commits) != 1 {
+			return fmt.Errorf("commit order names txn %s, which schedules %d commits instead of 1", name, len(commits))
+		}
+		if prevCommit != nil {
+			edges[*prevCommit] = append(edges[*prevCommit], commits[0])
+		}
+		prevCommit = &commits[0]
+	}
+
+	if cycle := findCycle(names, s.txns, edges); cycle != nil {
+		steps := make([]string, len(cycle))
+		for i, node := range cycle {
+			steps[i] = fmt.Sprintf("%s op %d (%s)", node.txnName, node.opIndex, s.txns[node.txnName].describe(node.opIndex))
+		}
+		return fmt.Errorf("schedule can never complete, these operations wait on each other: %s", strings.Join(steps, " -> "))
+	}
+	return nil
+}
+
+// excludedSignaler returns the name of a transaction left out of the schedule that signals barrierName,
+// or "" if there is none
+func (s schedule) excludedSignaler(barrierName string) string {
+	for name, txn := range s.all {
+		if _, included := s.txns[name]; included {
+			continue
+		}
+		for _, op := range txn.operations {
+			if op.kind == opBarrier && op.barrierName == barrierName {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+// findCycle returns the operations along a cycle in edges, or nil if there is none
+func findCycle(names []string, txns map[string]*Txn, edges map[scheduleNode][]scheduleNode) []scheduleNode {
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+	state := make(map[scheduleNode]int)
+	var path []scheduleNode
+	var visit func(node scheduleNode) []scheduleNode
+	visit = func(node scheduleNode) []scheduleNode {
+		state[node] = inProgress
+		path = append(path, node)
+		for _, next := range edges[node] {
+			switch state[next] {
+			case inProgress:
+				for i, n := range path {
+					if n == next {
+						return append(append([]scheduleNode(nil), path[i:]...), next)
+					}
+				}
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[node] = done
+		return nil
+	}
+
+	for _, name := range names {
+		for _, op := range txns[name].operations {
+			node := scheduleNode{name, op.opIndex}
+			if state[node] == unvisited {
+				if cycle := visit(node); cycle != nil {
+					return cycle
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// describe returns a human-readable description of the operation at opIndex
+func (t *Txn) describe(opIndex int) string {
+	i := slices.IndexFunc(t.operations, func(op operation) bool { return op.opIndex == opIndex })
+	if i < 0 {
+		return fmt.Sprintf("op %d", opIndex) // inside a Parallel group
+	}
+	op := t.operations[i]
+	switch op.kind {
+	case opBarrier:
+		return "BARRIER " + op.barrierName
+	case opWaitFor:
+		return "WAIT_FOR " + op.barrierName
+	case opWaitForWithTimeout:
+		return "WAIT_FOR_WITH_TIMEOUT " + op.barrierName
+	default:
+		return op.description
+	}
+}
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+)
+
+// benchmarkDatabases are the databases the benchmarks compare, each created afresh for every benchmark
+var benchmarkDatabases = []struct {
+	name string
+	new  func() anomalytest.Database
+}{
+	{"ReadUncommitted", func() anomalytest.Database { return NewSimpleDBReadUncommitted() }},
+	{"WriteLock", func() anomalytest.Database { return NewSimpleDBReadUncommittedWriteLock() }},
+	{"2PL", func() anomalytest.Database { return NewDatabase2PL() }},
+	{"SnapshotIsolation", func() anomalytest.Database { return NewDatabaseSnapshotIsolation() }},
+	{"RepeatableRead", func() anomalytest.Database { return NewDatabaseRepeatableRead() }},
+}
+
+// benchmarkKeys is how many keys BenchmarkSetGet spreads its writes over
+const benchmarkKeys = 100
+
+func BenchmarkSetGet(b *testing.B) {
+	for _, tc := range benchmarkDatabases {
+		b.Run(tc.name, func(b *testing.B) {
+			benchmarkSetGet(b, tc.new())
+		})
+	}
+}
+
+// benchmarkSetGet runs one transaction per iteration that writes a key, reads it back and commits, with no
+// other transaction running
+func benchmarkSetGet(b *testing.B, db anomalytest.Database) {
+	for i := 0; i < b.N; i++ {
+		txId, err := db.BeginTx("")
+		if err != nil {
+			b.Fatal(err)
+		}
+		key := i % benchmarkKeys
+		if err := db.Set(txId, key, i); err != nil {
+			b.Fatal(err)
+		}
+		if _, err := db.Get(txId, key); err != nil {
+			b.Fatal(err)
+		}
+		if err := db.Commit(txId); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkConcurrentIncrement(b *testing.B) {
+	for _, tc := range benchmarkDatabases {
+		b.Run(tc.name, func(b *testing.B) {
+			benchmarkConcurrentIncrement(b, tc.new())
+		})
+	}
+}
+
+// benchmarkConcurrentIncrement runs read-increment-write transactions on one key from parallel goroutines, one
+// transaction per iteration. A transaction the database aborts is rolled back and not retried. Besides the time
+// per transaction it reports commits/s, the share of transactions aborted, and the share of committed
+// increments that the final value does not show, i.e. lost updates.
+func benchmarkConcurrentIncrement(b *testing.B, db anomalytest.Database) {
+	const key = 1
+	var committed, aborted atomic.Int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if increment(db, key) == nil {
+				committed.Add(1)
+			} else {
+				aborted.Add(1)
+			}
+		}
+	})
+	b.StopTimer()
+
+	txId, err := db.BeginTx("")
+	if err != nil {
+		b.Fatal(err)
+	}
+	final, err := db.Get(txId, key)
+	if err != nil {
+		b.Fatal(err)
+	}
+	db.Commit(txId)
+
+	commits := committed.Load()
+	b.ReportMetric(float64(commits)/b.Elapsed().Seconds(), "commits/s")
+	b.ReportMetric(float64(aborted.Load())/float64(b.N), "aborts/op")
+	if commits > 0 {
+		b.ReportMetric(float64(commits-int64(final))/float64(commits), "lost/commit")
+	}
+}
+
+// increment reads key and writes it back one higher in a transaction of its own, rolling the transaction back
+// if any step fails
+func increment(db anomalytest.Database, key int) error {
+	txId, err := db.BeginTx("")
+	if err != nil {
+		return err
+	}
+	value, err := db.Get(txId, key)
+	if err == nil {
+		err = db.Set(txId, key, value+1)
+	}
+	if err == nil {
+		err = db.Commit(txId)
+	}
+	if err != nil {
+		db.Rollback(txId)
+	}
+	return err
+}
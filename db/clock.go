@@ -0,0 +1,38 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Clock hands out the timestamps the MVCC databases give snapshots and commits. It must never go backwards.
+type Clock interface {
+	Now() int64
+}
+
+// ManualClock is a Clock that only moves when a test moves it, so that the test decides the exact timestamps
+// transactions begin and commit at
+type ManualClock struct {
+	mu  sync.Mutex
+	now int64
+}
+
+func NewManualClock(start int64) *ManualClock {
+	return &ManualClock{now: start}
+}
+
+func (c *ManualClock) Now() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d. It panics if d is negative, since a Clock must never go backwards.
+func (c *ManualClock) Advance(d int64) {
+	if d < 0 {
+		panic(fmt.Sprintf("ManualClock cannot go backwards, advanced by %d", d))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now += d
+}
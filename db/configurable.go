@@ -0,0 +1,53 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+)
+
+// isolationPolicies maps each isolation level ConfigurableDB implements to the read policy that gives it.
+// Every level takes exclusive row locks for writes and holds them until commit, which prevents G0.
+var isolationPolicies = map[anomalytest.IsolationLevel]ReadPolicy{
+	anomalytest.ReadUncommitted: ReadDirty,           // reads see uncommitted writes
+	anomalytest.ReadCommitted:   ReadLatestCommitted, // reads see the latest committed value, without locking
+	anomalytest.RepeatableRead:  ReadBlocking,        // reads take shared locks held until commit
+	anomalytest.Serializable:    ReadBlocking,        // as REPEATABLE_READ, and Scan locks its whole range; see ConfigurableDB.Scan
+}
+
+// ConfigurableDB is the write-lock database with the isolation level chosen per transaction by BeginTx.
+// Transactions at different levels can run side by side: each reads under its own level's rules, and they
+// all share the row locks. SetReadPolicy has no effect on it.
+type ConfigurableDB struct {
+	*SimpleDBReadUncommittedWriteLock
+}
+
+func NewConfigurableDB() *ConfigurableDB {
+	return &ConfigurableDB{SimpleDBReadUncommittedWriteLock: NewSimpleDBReadUncommittedWriteLock()}
+}
+
+// BeginTx begins a transaction at isolationLevel, one of READ_UNCOMMITTED, READ_COMMITTED, REPEATABLE_READ
+// and SERIALIZABLE. Any other level fails with ErrUnsupportedIsolationLevel.
+func (d *ConfigurableDB) BeginTx(isolationLevel string) (int64, error) {
+	policy, ok := isolationPolicies[anomalytest.IsolationLevel(isolationLevel)]
+	if !ok {
+		return 0, fmt.Errorf("begin %q: %w", isolationLevel, anomalytest.ErrUnsupportedIsolationLevel)
+	}
+	txId := d.beginWithPolicy(policy)
+	if anomalytest.IsolationLevel(isolationLevel) == anomalytest.Serializable {
+		d.lockScanRanges(txId)
+	}
+	return txId, nil
+}
+
+// Scan reads keys lo to hi under the transaction's isolation level. At SERIALIZABLE it first takes a range
+// lock on them, as Database2PL.Scan does, so that no other transaction can insert into the range until the
+// scanner ends and there are no phantoms. At REPEATABLE_READ only the keys found are locked.
+func (d *ConfigurableDB) Scan(txId int64, lo, hi int) (map[int]int, error) {
+	if d.locksScanRanges(txId) {
+		if err := d.lockRange(txId, lo, hi); err != nil {
+			return nil, err
+		}
+	}
+	return d.SimpleDBReadUncommittedWriteLock.Scan(txId, lo, hi)
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigurableDBRejectsUnknownLevel(t *testing.T) {
+	db := NewConfigurableDB()
+	_, err := db.BeginTx("CHAOS")
+	assert.ErrorIs(t, err, anomalytest.ErrUnsupportedIsolationLevel)
+	_, err = db.BeginTx(string(anomalytest.SnapshotIsolation))
+	assert.ErrorIs(t, err, anomalytest.ErrUnsupportedIsolationLevel)
+}
+
+func TestConfigurableDBLevelsPerTransaction(t *testing.T) {
+	db := NewConfigurableDB()
+	setup, _ := db.BeginTx(string(anomalytest.ReadCommitted))
+	db.Set(setup, 1, 10)
+	db.Commit(setup)
+
+	writer, _ := db.BeginTx(string(anomalytest.ReadCommitted))
+	db.Set(writer, 1, 11)
+	dirty, _ := db.BeginTx(string(anomalytest.ReadUncommitted))
+	committed, _ := db.BeginTx(string(anomalytest.ReadCommitted))
+	value, _ := db.Get(dirty, 1)
+	assert.Equal(t, 11, value, "READ_UNCOMMITTED sees the uncommitted write")
+	value, _ = db.Get(committed, 1)
+	assert.Equal(t, 10, value, "READ_COMMITTED does not")
+	db.Commit(writer)
+	value, _ = db.Get(committed, 1)
+	assert.Equal(t, 11, value, "READ_COMMITTED reads are not repeatable")
+}
+
+func TestConfigurableDBRepeatableRead(t *testing.T) {
+	db := NewConfigurableDB()
+	reader, _ := db.BeginTx(string(anomalytest.RepeatableRead))
+	writer, _ := db.BeginTx(string(anomalytest.ReadCommitted))
+	first, _ := db.Get(reader, 1)
+
+	done := make(chan error, 1)
+	go func() { done <- db.Set(writer, 1, 11) }()
+	assertBlocked(t, done) // the reader's shared lock keeps the writer out
+	second, _ := db.Get(reader, 1)
+	assert.Equal(t, first, second)
+
+	db.Commit(reader)
+	assertGranted(t, done)
+	assert.NoError(t, db.Commit(writer))
+}
+
+func TestConfigurableDBRepeatableReadPreventsLostUpdate(t *testing.T) {
+	db := NewConfigurableDB()
+	exec := anomalytest.NewTxnsExecutor(db)
+	for name, other := range map[string]string{"txn1": "txn2", "txn2": "txn1"} {
+		txn := exec.NewTxn(name)
+		txn.BeginTxWithIsolation(anomalytest.RepeatableRead)
+		txn.Get(1)
+		txn.Barrier(name + "_read")
+		txn.WaitFor(other + "_read")
+		txn.Set(1, 1) // the increment of what it read
+		txn.Commit()
+	}
+	results := exec.Execute(true)
+
+	// Both read under shared locks, so the second to ask to upgrade its lock for the write deadlocks and is
+	// rolled back instead of overwriting the first's increment
+	if victims := results.DeadlockVictims(); assert.Len(t, victims, 1) {
+		survivor := map[string]string{"txn1": "txn2", "txn2": "txn1"}[victims[0]]
+		assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome(survivor))
+	}
+	assert.Equal(t, map[int]int{1: 1}, db.State())
+}
+
+func TestConfigurableDBSerializablePreventsPhantoms(t *testing.T) {
+	db := NewConfigurableDB()
+	setup, _ := db.BeginTx(string(anomalytest.ReadCommitted))
+	db.Set(setup, 1, 10)
+	db.Set(setup, 2, 20)
+	db.Commit(setup)
+
+	reader, _ := db.BeginTx(string(anomalytest.Serializable))
+	inserter, _ := db.BeginTx(string(anomalytest.ReadCommitted))
+	first, _ := db.Scan(reader, 1, 10)
+
+	done := make(chan error, 1)
+	go func() { done <- db.Set(inserter, 3, 30) }()
+	assertBlocked(t, done) // the reader's range lock keeps the insert out
+	second, _ := db.Scan(reader, 1, 10)
+	assert.Equal(t, first, second)
+
+	db.Commit(reader)
+	assertGranted(t, done)
+	assert.NoError(t, db.Commit(inserter))
+}
+
+func TestConfigurableDBRepeatableReadSeesPhantoms(t *testing.T) {
+	db := NewConfigurableDB()
+	setup, _ := db.BeginTx(string(anomalytest.ReadCommitted))
+	db.Set(setup, 1, 10)
+	db.Commit(setup)
+
+	reader, _ := db.BeginTx(string(anomalytest.RepeatableRead))
+	inserter, _ := db.BeginTx(string(anomalytest.ReadCommitted))
+	first, _ := db.Scan(reader, 1, 10)
+	assert.NoError(t, db.Set(inserter, 3, 30), "only the keys the scan found are locked")
+	assert.NoError(t, db.Commit(inserter))
+	second, _ := db.Scan(reader, 1, 10)
+	assert.Equal(t, map[int]int{1: 10}, first)
+	assert.Equal(t, map[int]int{1: 10, 3: 30}, second)
+	db.Commit(reader)
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+)
+
+// GrowOnlyCounter is a G-Counter CRDT. Every transaction owns its own slot and only ever
+// adds to it, and the counter's value is the sum of all slots. Because increments to
+// different slots commute, concurrent increments can never overwrite each other.
+type GrowOnlyCounter struct {
+	slots map[int64]int // txId -> total increments made by that txn
+}
+
+func newGrowOnlyCounter() *GrowOnlyCounter {
+	return &GrowOnlyCounter{
+		slots: make(map[int64]int),
+	}
+}
+
+// Value returns the sum of all slots
+func (c *GrowOnlyCounter) Value() int {
+	total := 0
+	for _, n := range c.slots {
+		total += n
+	}
+	return total
+}
+
+// CRDTCounterDB stores a GrowOnlyCounter per key. It exists to contrast with the
+// transactional implementations: there are no row locks and no undo of overwritten
+// values, yet concurrent increments are never lost because they never conflict.
+// Only Increment can change a value; Set and Delete are not supported.
+type CRDTCounterDB struct {
+	counters  map[int]*GrowOnlyCounter
+	mu        sync.Mutex // protects the maps themselves, not the counter semantics
+	nextTxnId int64
+	logger    anomalytest.Logger
+}
+
+func NewCRDTCounterDB() *CRDTCounterDB {
+	return &CRDTCounterDB{
+		counters:  make(map[int]*GrowOnlyCounter),
+		mu:        sync.Mutex{},
+		nextTxnId: 1,
+		logger:    anomalytest.DefaultLogger(),
+	}
+}
+
+func (d *CRDTCounterDB) Capabilities() anomalytest.Capability {
+	return anomalytest.CapIncrement
+}
+
+func (d *CRDTCounterDB) BeginTx(isolationLevel string) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	txId := d.nextTxnId
+	d.nextTxnId++
+	return txId, nil
+}
+
+func (d *CRDTCounterDB) Increment(txId int64, key int, delta int) error {
+	if delta < 0 {
+		return fmt.Errorf("grow-only counter cannot decrement key %d by %d: %w", key, -delta, errors.ErrUnsupported)
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	counter := d.counters[key]
+	if counter == nil {
+		counter = newGrowOnlyCounter()
+		d.counters[key] = counter
+	}
+	counter.slots[txId] += delta
+	return nil
+}
+
+func (d *CRDTCounterDB) Set(txId int64, key int, value int) error {
+	return fmt.Errorf("grow-only counter cannot set key %d: %w", key, errors.ErrUnsupported)
+}
+
+func (d *CRDTCounterDB) Get(txId int64, key int) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	counter := d.counters[key]
+	if counter == nil {
+		return 0, nil
+	}
+	return counter.Value(), nil
+}
+
+// State returns the value of every counter
+func (d *CRDTCounterDB) State() map[int]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state := make(map[int]int, len(d.counters))
+	for key, counter := range d.counters {
+		state[key] = counter.Value()
+	}
+	return state
+}
+
+func (d *CRDTCounterDB) Delete(txId int64, key int) error {
+	return fmt.Errorf("grow-only counter cannot delete key %d: %w", key, errors.ErrUnsupported)
+}
+
+func (d *CRDTCounterDB) Commit(txId int64) error {
+	// Increments are merged into the counter as they happen, so there is nothing to publish
+	return nil
+}
+
+func (d *CRDTCounterDB) Rollback(txId int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Dropping the txn's own slot discards exactly its increments and nobody else's
+	for _, counter := range d.counters {
+		delete(counter.slots, txId)
+	}
+	return nil
+}
+
+// SetLogger sets the logger that PrintState writes to
+func (d *CRDTCounterDB) SetLogger(logger anomalytest.Logger) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logger = logger
+}
+
+func (d *CRDTCounterDB) PrintState() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	values := make(map[int]int, len(d.counters))
+	slots := make(map[int]map[int64]int, len(d.counters))
+	for key, counter := range d.counters {
+		values[key] = counter.Value()
+		slots[key] = counter.slots
+	}
+	d.logger.Info("database state", "data", values, "slots", slots, "next_txn_id", d.nextTxnId)
+}
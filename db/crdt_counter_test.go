@@ -0,0 +1,60 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ anomalytest.IncrementDatabase = (*CRDTCounterDB)(nil)
+
+func TestCRDTCounterDBConcurrentIncrements(t *testing.T) {
+	db := NewCRDTCounterDB()
+	const txns, incrementsPerTxn = 10, 100
+
+	// No barriers or locks: every txn increments the same key as fast as it can
+	var wg sync.WaitGroup
+	for i := 0; i < txns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			txId, _ := db.BeginTx("READ_UNCOMMITTED")
+			for j := 0; j < incrementsPerTxn; j++ {
+				assert.NoError(t, db.Increment(txId, 1, 1))
+			}
+			assert.NoError(t, db.Commit(txId))
+		}()
+	}
+	wg.Wait()
+
+	txId, _ := db.BeginTx("READ_UNCOMMITTED")
+	value, err := db.Get(txId, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, txns*incrementsPerTxn, value, "No increment should be lost")
+}
+
+func TestCRDTCounterDBRollbackDiscardsOnlyOwnIncrements(t *testing.T) {
+	db := NewCRDTCounterDB()
+
+	txn1, _ := db.BeginTx("READ_UNCOMMITTED")
+	txn2, _ := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, db.Increment(txn1, 1, 5))
+	assert.NoError(t, db.Increment(txn2, 1, 7))
+	assert.NoError(t, db.Rollback(txn1))
+	assert.NoError(t, db.Commit(txn2))
+
+	value, err := db.Get(txn2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 7, value)
+
+	assert.True(t, errors.Is(db.Set(txn2, 1, 0), errors.ErrUnsupported))
+	assert.True(t, errors.Is(db.Increment(txn2, 1, -1), errors.ErrUnsupported))
+}
+
+func TestCRDTCounterDBLostUpdateAtomicIncrement(t *testing.T) {
+	db := NewCRDTCounterDB()
+	anomalytest.TestLostUpdateAtomicIncrement(t, db)
+}
@@ -0,0 +1,17 @@
+package db
+
+import "github.com/makalaaneesh/lonely-transactions/anomalytest"
+
+// DecoratorFunc wraps a database with additional behavior. Decorators must pass transaction ids
+// from the inner database through unchanged, so that stacked decorators agree on them.
+type DecoratorFunc func(inner anomalytest.Database) anomalytest.Database
+
+// Decorate stacks decorators on top of inner. The first decorator is the outermost layer:
+// Decorate(base, A, B) is A(B(base)), so every call passes through A, then B, then reaches base.
+func Decorate(inner anomalytest.Database, decorators ...DecoratorFunc) anomalytest.Database {
+	db := inner
+	for i := len(decorators) - 1; i >= 0; i-- {
+		db = decorators[i](db)
+	}
+	return db
+}
@@ -0,0 +1,54 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+	"github.com/stretchr/testify/assert"
+)
+
+// tracingDB is a minimal decorator that logs the order in which layers see BeginTx
+type tracingDB struct {
+	anomalytest.Database
+	name string
+	log  *[]string
+}
+
+func withTracing(name string, log *[]string) DecoratorFunc {
+	return func(inner anomalytest.Database) anomalytest.Database {
+		return &tracingDB{Database: inner, name: name, log: log}
+	}
+}
+
+func (d *tracingDB) BeginTx(isolationLevel string) (int64, error) {
+	*d.log = append(*d.log, d.name)
+	return d.Database.BeginTx(isolationLevel)
+}
+
+func TestDecorateOrderAndTxnIds(t *testing.T) {
+	var log []string
+	base := NewSimpleDBReadUncommitted()
+	db := Decorate(base, withTracing("outer", &log), withTracing("middle", &log), WithReplicationLag(time.Millisecond))
+
+	txId, err := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"outer", "middle"}, log, "The first decorator should see calls first")
+	assert.Equal(t, int64(1), txId, "Decorators should forward the base database's txn id")
+
+	assert.NoError(t, db.Set(txId, 1, 100))
+	value, err := db.Get(txId, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, value)
+	assert.NoError(t, db.Commit(txId))
+
+	outer := db.(*tracingDB)
+	middle := outer.Database.(*tracingDB)
+	_, ok := middle.Database.(*ReplicationLagDB)
+	assert.True(t, ok, "The last decorator should wrap the base database directly")
+}
+
+func TestDecorateWithoutDecoratorsReturnsInner(t *testing.T) {
+	base := NewSimpleDBReadUncommitted()
+	assert.Same(t, base, Decorate(base))
+}
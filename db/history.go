@@ -0,0 +1,16 @@
+package db
+
+import "slices"
+
+// history holds the values committed to each key, oldest first
+type history map[int][]int
+
+// add records that value was committed to key
+func (h history) add(key int, value int) {
+	h[key] = append(h[key], value)
+}
+
+// of returns a copy of the values committed to key
+func (h history) of(key int) []int {
+	return slices.Clone(h[key])
+}
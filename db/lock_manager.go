@@ -0,0 +1,679 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+)
+
+// LockMode is the mode a row lock is requested in
+type LockMode int
+
+const (
+	LockShared    LockMode = iota // compatible with other shared locks on the row
+	LockExclusive                 // compatible with no other lock on the row
+)
+
+func (m LockMode) String() string {
+	if m == LockExclusive {
+		return "exclusive"
+	}
+	return "shared"
+}
+
+// LockManager grants row locks to transactions. Acquire may block until the lock can be granted, and must fail
+// with anomalytest.ErrTxnNotActive if the transaction ends while waiting. A transaction that already holds a
+// lock in a mode at least as strong as the one requested gets it again without waiting; a request for an
+// exclusive lock on a row the transaction holds shared upgrades it. ReleaseAll releases every lock the
+// transaction holds and ends it, failing its requests still waiting.
+//
+// A lock manager can also implement HoldsLock(txId int64, key int) bool, anomalytest.LockWaitInspector,
+// anomalytest.LockWaitCounter, anomalytest.LockTimer, anomalytest.LockObservable, anomalytest.Resetter,
+// LockStats() LockStats and the lock event log methods of BlockingLockManager; the database reports them through its own methods of
+// the same names, which otherwise report nothing.
+type LockManager interface {
+	Acquire(txId int64, key int, mode LockMode) error
+	ReleaseAll(txId int64)
+}
+
+// RangeLocker is implemented by lock managers that can lock a range of keys, including the keys in it that do
+// not exist yet. AcquireRange grants txId a shared lock on every key from lo to hi, blocking while another
+// transaction holds an exclusive lock on any of them; until txId's locks are released, exclusive requests by
+// others for a key in the range block. It fails like Acquire.
+type RangeLocker interface {
+	AcquireRange(txId int64, lo, hi int) error
+}
+
+// keyRange is the keys from lo to hi, inclusive
+type keyRange struct {
+	lo, hi int
+}
+
+func (r keyRange) contains(key int) bool {
+	return r.lo <= key && key <= r.hi
+}
+
+// LockStats are contention totals over every transaction's lock requests
+type LockStats struct {
+	Acquisitions int           // lock requests granted, not counting requests for a lock already held
+	Waits        int           // lock requests that had to wait for another transaction, granted or not
+	WaitTime     time.Duration // total time those requests spent waiting
+}
+
+// LockEventKind distinguishes lock acquisitions from releases in the lock event log
+type LockEventKind int
+
+const (
+	LockAcquired LockEventKind = iota
+	LockReleased
+)
+
+func (k LockEventKind) String() string {
+	if k == LockAcquired {
+		return "ACQUIRE"
+	}
+	return "RELEASE"
+}
+
+// LockEvent records a single row lock acquisition or release
+type LockEvent struct {
+	Seq  int64 // position of the event across all transactions
+	TxId int64
+	Key  int
+	Kind LockEventKind
+}
+
+// BlockingLockManager is the default LockManager: a request that conflicts with a lock held by another
+// transaction blocks until that transaction releases it. Deadlocks are left waiting unless detection is
+// turned on with SetDeadlockDetection.
+type BlockingLockManager struct {
+	mu         sync.Mutex
+	released   *sync.Cond                       // broadcast whenever locks are released or the manager is reset
+	exclusive  map[int]int64                    // key -> txn holding it exclusively
+	shared     map[int]map[int64]bool           // key -> txns holding it shared
+	held       map[int64]map[int]LockMode       // txnId -> keys it holds, in the strongest mode it holds them
+	ended      map[int64]bool                   // txns that have committed or rolled back with requests still waiting
+	waiting    map[int64]int                    // txnId -> number of its requests blocked waiting, several in a Parallel group
+	waiters    map[int64]int                    // txnId -> key it is blocked waiting to lock
+	ranges     map[int64][]keyRange             // txnId -> key ranges it holds shared, from AcquireRange
+	rangeWait  map[int64]keyRange               // txnId -> key range it is blocked waiting to lock
+	waits      map[int64]int                    // txnId -> number of times it had to wait for a lock
+	stats      LockStats                        // totals since the manager was created or last reset
+	timings    map[int64]anomalytest.LockTiming // txnId -> its most recent granted lock request
+	grants     map[int][]int64                  // key -> txns granted a lock on it, in grant order
+	fifo       bool                             // grant waiters in arrival order; see SetFIFOLocks
+	queues     map[int][]int64                  // key -> txns waiting to lock it, in arrival order, in FIFO mode
+	releasedBy map[int]int64                    // key -> txn that last released a lock on it
+	unblocked  map[int64][]int64                // txnId -> waiters granted a lock once it released it, in grant order
+	detect     bool                             // fail requests that would deadlock; see SetDeadlockDetection
+	observer   anomalytest.LockObserver         // told about lock waits; see SetLockObserver
+	generation int                              // incremented by Reset, so waiters from before it give up
+
+	// Optional lock event log
+	recordLocks  bool
+	lockEvents   []LockEvent
+	lockEventSeq int64
+}
+
+func NewBlockingLockManager() *BlockingLockManager {
+	m := &BlockingLockManager{
+		exclusive:  make(map[int]int64),
+		shared:     make(map[int]map[int64]bool),
+		held:       make(map[int64]map[int]LockMode),
+		ended:      make(map[int64]bool),
+		waiting:    make(map[int64]int),
+		waiters:    make(map[int64]int),
+		ranges:     make(map[int64][]keyRange),
+		rangeWait:  make(map[int64]keyRange),
+		waits:      make(map[int64]int),
+		timings:    make(map[int64]anomalytest.LockTiming),
+		grants:     make(map[int][]int64),
+		queues:     make(map[int][]int64),
+		releasedBy: make(map[int]int64),
+		unblocked:  make(map[int64][]int64),
+	}
+	m.released = sync.NewCond(&m.mu)
+	return m
+}
+
+// Acquire grants txId the lock on key in mode, blocking while another transaction holds a conflicting lock.
+// It fails if the transaction ends while waiting, e.g. because it was rolled back after timing out, or if
+// the manager is reset while it waits.
+func (m *BlockingLockManager) Acquire(txId int64, key int, mode LockMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if held, ok := m.held[txId][key]; ok && held >= mode {
+		return nil // Already hold this lock
+	}
+
+	requested := time.Now()
+	generation := m.generation
+	waited, queued := false, false
+	for !m.ended[txId] && !(m.grantable(txId, key, mode) && m.firstInLine(txId, key)) {
+		if m.detect {
+			if cycle := m.deadlockCycle(txId, m.blockers(txId, key)); cycle != nil {
+				delete(m.waiters, txId)
+				if queued {
+					m.dequeue(txId, key)
+				}
+				if waited {
+					m.doneWaiting(txId)
+				}
+				return &anomalytest.DeadlockError{Victim: txId, Cycle: cycle}
+			}
+		}
+		if m.fifo && !queued {
+			m.queues[key] = append(m.queues[key], txId)
+			queued = true
+		}
+		if !waited {
+			m.waiting[txId]++
+			if m.observer != nil {
+				m.observer.OnLockWait(txId, key)
+			}
+		}
+		waited = true
+		m.waiters[txId] = key
+		m.released.Wait() // Held by another txn, block until it is released
+		if generation != m.generation {
+			// Reset ran while waiting: txId may now belong to a transaction of the next run
+			return fmt.Errorf("txn %d locking key %d after a reset: %w", txId, key, anomalytest.ErrTxnNotActive)
+		}
+	}
+	delete(m.waiters, txId)
+	ended := m.ended[txId]
+	if waited {
+		m.doneWaiting(txId)
+	}
+	if waited && !ended {
+		// The release that made the lock grantable was the last one on key
+		if releaser, ok := m.releasedBy[key]; ok {
+			m.unblocked[releaser] = append(m.unblocked[releaser], txId)
+		}
+	}
+	if queued {
+		m.dequeue(txId, key)
+	}
+	if waited {
+		m.waits[txId]++
+		m.stats.Waits++
+		m.stats.WaitTime += time.Since(requested)
+	}
+	if ended {
+		// Nothing would ever release a lock granted to an ended txn
+		return fmt.Errorf("txn %d locking key %d: %w", txId, key, anomalytest.ErrTxnNotActive)
+	}
+
+	if mode == LockExclusive {
+		m.exclusive[key] = txId
+		delete(m.shared[key], txId)
+	} else {
+		if m.shared[key] == nil {
+			m.shared[key] = make(map[int64]bool)
+		}
+		m.shared[key][txId] = true
+	}
+	if m.held[txId] == nil {
+		m.held[txId] = make(map[int]LockMode)
+	}
+	m.held[txId][key] = mode
+	m.grants[key] = append(m.grants[key], txId)
+	m.stats.Acquisitions++
+	m.timings[txId] = anomalytest.LockTiming{Key: key, Requested: requested, Granted: time.Now()}
+	m.recordLockEvent(txId, key, LockAcquired)
+	if waited && m.observer != nil {
+		m.observer.OnLockAcquired(txId, key)
+	}
+	return nil
+}
+
+// grantable reports whether no other transaction holds a lock on key that conflicts with mode. Caller must hold mu.
+func (m *BlockingLockManager) grantable(txId int64, key int, mode LockMode) bool {
+	if holder, ok := m.exclusive[key]; ok && holder != txId {
+		return false
+	}
+	if mode == LockShared {
+		return true
+	}
+	for holder := range m.shared[key] {
+		if holder != txId {
+			return false
+		}
+	}
+	return len(m.rangeHolders(txId, key)) == 0
+}
+
+// AcquireRange grants txId a shared lock on every key from lo to hi, blocking while another transaction holds
+// an exclusive lock on a key in the range. Range requests do not queue in FIFO mode, and are not recorded in
+// the lock event log or reported by HoldsLock and LockWaiters.
+func (m *BlockingLockManager) AcquireRange(txId int64, lo, hi int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := keyRange{lo: lo, hi: hi}
+	if slices.Contains(m.ranges[txId], r) {
+		return nil // Already hold this range
+	}
+
+	requested := time.Now()
+	generation := m.generation
+	waited := false
+	for !m.ended[txId] {
+		blockers := m.rangeBlockers(txId, r)
+		if len(blockers) == 0 {
+			break
+		}
+		if m.detect {
+			if cycle := m.deadlockCycle(txId, blockers); cycle != nil {
+				delete(m.rangeWait, txId)
+				if waited {
+					m.doneWaiting(txId)
+				}
+				return &anomalytest.DeadlockError{Victim: txId, Cycle: cycle}
+			}
+		}
+		if !waited {
+			m.waiting[txId]++
+		}
+		waited = true
+		m.rangeWait[txId] = r
+		m.released.Wait() // A key in the range is held exclusively, block until it is released
+		if generation != m.generation {
+			return fmt.Errorf("txn %d locking keys %d to %d after a reset: %w", txId, lo, hi, anomalytest.ErrTxnNotActive)
+		}
+	}
+	delete(m.rangeWait, txId)
+	ended := m.ended[txId]
+	if waited {
+		m.doneWaiting(txId)
+		m.waits[txId]++
+		m.stats.Waits++
+		m.stats.WaitTime += time.Since(requested)
+	}
+	if ended {
+		return fmt.Errorf("txn %d locking keys %d to %d: %w", txId, lo, hi, anomalytest.ErrTxnNotActive)
+	}
+	m.ranges[txId] = append(m.ranges[txId], r)
+	m.stats.Acquisitions++
+	return nil
+}
+
+// rangeHolders returns the transactions other than txId that hold a range containing key, in ascending
+// order. Caller must hold mu.
+func (m *BlockingLockManager) rangeHolders(txId int64, key int) []int64 {
+	var holders []int64
+	for holder, ranges := range m.ranges {
+		if holder != txId && slices.ContainsFunc(ranges, func(r keyRange) bool { return r.contains(key) }) {
+			holders = append(holders, holder)
+		}
+	}
+	slices.Sort(holders)
+	return holders
+}
+
+// rangeBlockers returns the transactions other than txId that hold an exclusive lock on a key in r, in
+// ascending order. Caller must hold mu.
+func (m *BlockingLockManager) rangeBlockers(txId int64, r keyRange) []int64 {
+	var holders []int64
+	for key, holder := range m.exclusive {
+		if holder != txId && r.contains(key) {
+			holders = append(holders, holder)
+		}
+	}
+	slices.Sort(holders)
+	return slices.Compact(holders)
+}
+
+// firstInLine reports whether no earlier waiter in FIFO mode is queued for key ahead of txId. A transaction
+// that already holds key, upgrading its lock, never queues behind waiters, since they may be waiting for it.
+// Caller must hold mu.
+func (m *BlockingLockManager) firstInLine(txId int64, key int) bool {
+	queue := m.queues[key]
+	if !m.fifo || len(queue) == 0 || queue[0] == txId {
+		return true
+	}
+	_, holds := m.held[txId][key]
+	return holds
+}
+
+// dequeue removes txId from the FIFO queue for key and wakes the waiters, since the next in line may now be
+// grantable, e.g. another shared request. Caller must hold mu.
+func (m *BlockingLockManager) dequeue(txId int64, key int) {
+	m.queues[key] = slices.DeleteFunc(m.queues[key], func(id int64) bool { return id == txId })
+	if len(m.queues[key]) == 0 {
+		delete(m.queues, key)
+	}
+	m.released.Broadcast()
+}
+
+// deadlockCycle returns the wait-for cycle txId would close by waiting for blockers, starting with txId and each
+// transaction waiting for the next, or nil if waiting would not deadlock. Only the holders of a lock count
+// as blocking its waiters, not the waiters queued ahead in FIFO mode. Caller must hold mu.
+func (m *BlockingLockManager) deadlockCycle(txId int64, blockers []int64) []int64 {
+	visited := make(map[int64]bool)
+	var find func(path []int64, blockers []int64) []int64
+	find = func(path []int64, blockers []int64) []int64 {
+		for _, blocker := range blockers {
+			if blocker == txId {
+				return slices.Clone(path)
+			}
+			next, waiting := m.waitingOn(blocker)
+			if visited[blocker] || !waiting {
+				continue
+			}
+			visited[blocker] = true
+			if cycle := find(append(path, blocker), next); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	return find([]int64{txId}, blockers)
+}
+
+// waitingOn returns the transactions whose locks keep txId waiting, and whether it is waiting at all.
+// Caller must hold mu.
+func (m *BlockingLockManager) waitingOn(txId int64) ([]int64, bool) {
+	if key, ok := m.waiters[txId]; ok {
+		return m.blockers(txId, key), true
+	}
+	if r, ok := m.rangeWait[txId]; ok {
+		return m.rangeBlockers(txId, r), true
+	}
+	return nil, false
+}
+
+// SetDeadlockDetection turns deadlock detection on or off. When on, a request that would wait for a
+// transaction that is itself waiting, directly or through others, for a lock the requester holds fails at
+// once with an *anomalytest.DeadlockError naming the requester as the victim. The victim keeps the locks it
+// holds until it is rolled back. When off, the default, such a request waits forever or until its
+// transaction ends.
+func (m *BlockingLockManager) SetDeadlockDetection(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.detect = enabled
+}
+
+// SetLockObserver sets the observer told when a row lock request starts waiting and when a request that
+// waited is granted, or stops the reports if observer is nil. It is called with the manager's mutex held.
+// Range requests are not reported.
+func (m *BlockingLockManager) SetLockObserver(observer anomalytest.LockObserver) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.observer = observer
+}
+
+// SetFIFOLocks turns FIFO granting on or off. When on, the transactions waiting for a lock on a key are
+// granted it in the order they requested it, and a new request waits behind any queued ones. When off,
+// the default, every waiter is woken when locks are released and whichever gets there first is granted
+// the lock, so the grant order among waiters is up to the scheduler.
+func (m *BlockingLockManager) SetFIFOLocks(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fifo = enabled
+	if !enabled {
+		m.queues = make(map[int][]int64)
+	}
+	m.released.Broadcast()
+}
+
+// UnblockedBy returns the transactions that waited for a lock and were granted it after txId released its
+// locks, in the order they were granted. A waiter is attributed to the transaction whose release made its
+// lock grantable; if several waited for the same lock, only the one granted it is, and the others are
+// attributed to whichever transaction releases it to them later.
+func (m *BlockingLockManager) UnblockedBy(txId int64) []int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.unblocked[txId])
+}
+
+// GrantOrder returns the transactions that were granted a lock on key, in the order they were granted it.
+// A transaction appears again if it upgraded a shared lock to exclusive.
+func (m *BlockingLockManager) GrantOrder(key int) []int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return slices.Clone(m.grants[key])
+}
+
+// ReleaseAll releases all locks held by a transaction. If it still has requests waiting it is marked ended
+// until they have all failed, so that a lock it is waiting for is never granted.
+func (m *BlockingLockManager) ReleaseAll(txId int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.waiting[txId] > 0 {
+		m.ended[txId] = true
+	}
+	keys := make([]int, 0, len(m.held[txId]))
+	for key := range m.held[txId] {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys) // release in a stable order so the event log is deterministic
+	for _, key := range keys {
+		if m.exclusive[key] == txId {
+			delete(m.exclusive, key)
+		}
+		delete(m.shared[key], txId)
+		if len(m.shared[key]) == 0 {
+			delete(m.shared, key)
+		}
+		m.releasedBy[key] = txId
+		m.recordLockEvent(txId, key, LockReleased)
+	}
+	delete(m.held, txId)
+	delete(m.ranges, txId)
+	m.released.Broadcast()
+}
+
+// doneWaiting records that one of txId's requests stopped waiting, and forgets that txId ended once none
+// is left. Caller must hold mu.
+func (m *BlockingLockManager) doneWaiting(txId int64) {
+	m.waiting[txId]--
+	if m.waiting[txId] == 0 {
+		delete(m.waiting, txId)
+		delete(m.ended, txId)
+	}
+}
+
+// HoldsLock reports whether txId currently holds a lock on key, in either mode
+func (m *BlockingLockManager) HoldsLock(txId int64, key int) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, ok := m.held[txId][key]
+	return ok
+}
+
+// LockWaiters returns the transactions that are waiting for a row lock, mapped to the key they are waiting for
+func (m *BlockingLockManager) LockWaiters() map[int64]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	waiters := make(map[int64]int, len(m.waiters))
+	for txId, key := range m.waiters {
+		waiters[txId] = key
+	}
+	return waiters
+}
+
+// LockWaitCount returns how many times txId had to wait for a row lock held by another transaction
+func (m *BlockingLockManager) LockWaitCount(txId int64) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.waits[txId]
+}
+
+// LockStats returns the contention totals of every lock request since the manager was created or last reset,
+// range requests included
+func (m *BlockingLockManager) LockStats() LockStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.stats
+}
+
+// LastLockTiming returns when txId's most recent lock request that was granted was made and granted
+func (m *BlockingLockManager) LastLockTiming(txId int64) (anomalytest.LockTiming, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	timing, ok := m.timings[txId]
+	return timing, ok
+}
+
+// WaitChain returns the current chains of lock waits, each starting at a transaction nothing waits for and
+// listing the transaction it waits for, the one that one waits for, and so on, until one that is not waiting.
+// A transaction blocked by several shared holders starts one chain per holder. A deadlock shows as a chain
+// that ends with a transaction already in it. The chains come from a single snapshot of the lock table.
+func (m *BlockingLockManager) WaitChain() [][]int64 {
+	m.mu.Lock()
+	waitsFor := make(map[int64][]int64, len(m.waiters)+len(m.rangeWait))
+	for txId := range m.waiters {
+		waitsFor[txId], _ = m.waitingOn(txId)
+	}
+	for txId := range m.rangeWait {
+		waitsFor[txId], _ = m.waitingOn(txId)
+	}
+	m.mu.Unlock()
+	return waitChains(waitsFor)
+}
+
+// blockers returns the transactions whose locks on key, or on a range containing it, keep txId waiting, in
+// ascending order. Caller must hold mu.
+func (m *BlockingLockManager) blockers(txId int64, key int) []int64 {
+	if holder, ok := m.exclusive[key]; ok && holder != txId {
+		return []int64{holder}
+	}
+	var holders []int64
+	for holder := range m.shared[key] {
+		if holder != txId {
+			holders = append(holders, holder)
+		}
+	}
+	holders = append(holders, m.rangeHolders(txId, key)...)
+	slices.Sort(holders)
+	return slices.Compact(holders)
+}
+
+// waitChains follows the wait-for edges in waitsFor from every transaction that nothing waits for, and then
+// from the lowest transaction of any cycle no such chain reached
+func waitChains(waitsFor map[int64][]int64) [][]int64 {
+	waitedOn := make(map[int64]bool)
+	for _, blockers := range waitsFor {
+		for _, blocker := range blockers {
+			waitedOn[blocker] = true
+		}
+	}
+	waiters := make([]int64, 0, len(waitsFor))
+	for txId := range waitsFor {
+		waiters = append(waiters, txId)
+	}
+	sort.Slice(waiters, func(i, j int) bool { return waiters[i] < waiters[j] })
+
+	var chains [][]int64
+	visited := make(map[int64]bool)
+	var follow func(chain []int64)
+	follow = func(chain []int64) {
+		last := chain[len(chain)-1]
+		visited[last] = true
+		blockers := waitsFor[last]
+		if len(blockers) == 0 {
+			if len(chain) > 1 { // a lone waiter whose lock was just released is about to stop waiting
+				chains = append(chains, append([]int64(nil), chain...))
+			}
+			return
+		}
+		for _, blocker := range blockers {
+			if slices.Contains(chain, blocker) {
+				chains = append(chains, append(append([]int64(nil), chain...), blocker))
+				continue
+			}
+			follow(append(chain, blocker))
+		}
+	}
+	for _, txId := range waiters {
+		if !waitedOn[txId] {
+			follow([]int64{txId})
+		}
+	}
+	for _, txId := range waiters {
+		if !visited[txId] {
+			follow([]int64{txId})
+		}
+	}
+	return chains
+}
+
+// SetLockRecording turns the lock event log on or off. Events recorded so far are kept.
+func (m *BlockingLockManager) SetLockRecording(enabled bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.recordLocks = enabled
+}
+
+// recordLockEvent appends to the lock event log. Caller must hold mu.
+func (m *BlockingLockManager) recordLockEvent(txId int64, key int, kind LockEventKind) {
+	if !m.recordLocks {
+		return
+	}
+	m.lockEventSeq++
+	m.lockEvents = append(m.lockEvents, LockEvent{
+		Seq:  m.lockEventSeq,
+		TxId: txId,
+		Key:  key,
+		Kind: kind,
+	})
+}
+
+// LockEvents returns every recorded lock acquisition and release, in the order they happened
+func (m *BlockingLockManager) LockEvents() []LockEvent {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	events := make([]LockEvent, len(m.lockEvents))
+	copy(events, m.lockEvents)
+	return events
+}
+
+// Reset releases every lock and forgets every transaction, and clears the lock event log. Transactions
+// still waiting for a lock fail with ErrTxnNotActive instead of being granted it under an id that may be reused.
+func (m *BlockingLockManager) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.generation++
+	m.exclusive = make(map[int]int64)
+	m.shared = make(map[int]map[int64]bool)
+	m.held = make(map[int64]map[int]LockMode)
+	m.ended = make(map[int64]bool)
+	m.waiting = make(map[int64]int)
+	m.waiters = make(map[int64]int)
+	m.ranges = make(map[int64][]keyRange)
+	m.rangeWait = make(map[int64]keyRange)
+	m.waits = make(map[int64]int)
+	m.stats = LockStats{}
+	m.timings = make(map[int64]anomalytest.LockTiming)
+	m.grants = make(map[int][]int64)
+	m.queues = make(map[int][]int64)
+	m.releasedBy = make(map[int]int64)
+	m.unblocked = make(map[int64][]int64)
+	m.lockEvents = nil
+	m.lockEventSeq = 0
+	m.released.Broadcast()
+}
+
+// CheckTwoPhaseLocking verifies the two-phase property over a lock event log: once a
+// transaction has released any lock (shrinking phase), it must not acquire another one.
+func CheckTwoPhaseLocking(events []LockEvent) error {
+	firstRelease := make(map[int64]LockEvent)
+	for _, event := range events {
+		switch event.Kind {
+		case LockReleased:
+			if _, ok := firstRelease[event.TxId]; !ok {
+				firstRelease[event.TxId] = event
+			}
+		case LockAcquired:
+			if release, ok := firstRelease[event.TxId]; ok {
+				return fmt.Errorf("txn %d acquired lock on key %d (event %d) after releasing lock on key %d (event %d)",
+					event.TxId, event.Key, event.Seq, release.Key, release.Seq)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,353 @@
+package db
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+	"github.com/stretchr/testify/assert"
+)
+
+// acquireAsync requests a lock in the background and returns a channel that receives the result
+func acquireAsync(lm LockManager, txId int64, key int, mode LockMode) <-chan error {
+	done := make(chan error, 1)
+	go func() {
+		done <- lm.Acquire(txId, key, mode)
+	}()
+	return done
+}
+
+// assertBlocked asserts that a lock request is still waiting
+func assertBlocked(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		t.Fatalf("lock request should block, returned %v", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+// assertGranted asserts that a lock request finishes successfully
+func assertGranted(t *testing.T, done <-chan error) {
+	t.Helper()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("lock request was never granted")
+	}
+}
+
+func TestBlockingLockManagerModes(t *testing.T) {
+	lm := NewBlockingLockManager()
+
+	assert.NoError(t, lm.Acquire(1, 1, LockShared))
+	assertGranted(t, acquireAsync(lm, 2, 1, LockShared)) // shared locks are compatible
+
+	exclusive := acquireAsync(lm, 3, 1, LockExclusive)
+	assertBlocked(t, exclusive)
+	lm.ReleaseAll(1)
+	assertBlocked(t, exclusive) // txn 2 still holds it shared
+	lm.ReleaseAll(2)
+	assertGranted(t, exclusive)
+
+	shared := acquireAsync(lm, 4, 1, LockShared)
+	assertBlocked(t, shared)
+	assert.Equal(t, map[int64]int{4: 1}, lm.LockWaiters())
+	lm.ReleaseAll(3)
+	assertGranted(t, shared)
+	assert.Equal(t, 1, lm.LockWaitCount(4))
+}
+
+func TestBlockingLockManagerUpgrade(t *testing.T) {
+	lm := NewBlockingLockManager()
+
+	assert.NoError(t, lm.Acquire(1, 1, LockShared))
+	assert.NoError(t, lm.Acquire(1, 1, LockExclusive), "the only shared holder can upgrade without waiting")
+	assert.NoError(t, lm.Acquire(1, 1, LockShared), "an exclusive lock covers a shared request")
+	assert.Equal(t, 0, lm.LockWaitCount(1))
+
+	assertBlocked(t, acquireAsync(lm, 2, 1, LockShared))
+}
+
+func TestBlockingLockManagerFailsWaiterThatEnds(t *testing.T) {
+	lm := NewBlockingLockManager()
+	assert.NoError(t, lm.Acquire(1, 1, LockExclusive))
+
+	waiting := acquireAsync(lm, 2, 1, LockExclusive)
+	assertBlocked(t, waiting)
+	lm.ReleaseAll(2) // e.g. rolled back after timing out
+	select {
+	case err := <-waiting:
+		assert.ErrorIs(t, err, anomalytest.ErrTxnNotActive)
+	case <-time.After(time.Second):
+		t.Fatal("waiter should fail once its txn ends")
+	}
+	assert.False(t, lm.HoldsLock(2, 1))
+	assert.Empty(t, lm.ended, "an ended txn is forgotten once none of its requests is waiting")
+
+	lm.ReleaseAll(1)
+	assert.Empty(t, lm.ended, "a txn with no requests waiting is not marked ended at all")
+}
+
+// errLockBusy is returned by noWaitLockManager instead of blocking
+var errLockBusy = errors.New("lock busy")
+
+// noWaitLockManager fails any request that conflicts with a held lock instead of waiting for it
+type noWaitLockManager struct {
+	*BlockingLockManager
+}
+
+func (m noWaitLockManager) Acquire(txId int64, key int, mode LockMode) error {
+	m.mu.Lock()
+	grantable := m.grantable(txId, key, mode)
+	m.mu.Unlock()
+	if !grantable {
+		return errLockBusy
+	}
+	return m.BlockingLockManager.Acquire(txId, key, mode)
+}
+
+func TestSimpleDBReadUncommittedWriteLockWithCustomLockManager(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLockWith(noWaitLockManager{NewBlockingLockManager()})
+	tx1, _ := db.BeginTx("")
+	tx2, _ := db.BeginTx("")
+
+	assert.NoError(t, db.Set(tx1, 1, 100))
+	assert.ErrorIs(t, db.Set(tx2, 1, 200), errLockBusy, "the custom manager should fail instead of blocking")
+	assert.True(t, db.HoldsLock(tx1, 1))
+	assert.NoError(t, db.Commit(tx1))
+	assert.NoError(t, db.Set(tx2, 1, 200))
+	assert.NoError(t, db.Commit(tx2))
+	assert.Equal(t, map[int]int{1: 200}, db.State())
+	assert.Equal(t, LockStats{Acquisitions: 2}, db.LockStats(), "a request that fails instead of waiting never waits")
+}
+
+func TestBlockingLockManagerWaitChain(t *testing.T) {
+	lm := NewBlockingLockManager()
+	assert.NoError(t, lm.Acquire(1, 1, LockExclusive))
+	assert.NoError(t, lm.Acquire(2, 2, LockExclusive))
+	assert.NoError(t, lm.Acquire(4, 3, LockShared))
+	assert.NoError(t, lm.Acquire(5, 3, LockShared))
+	assert.Empty(t, lm.WaitChain())
+
+	waits := []<-chan error{
+		acquireAsync(lm, 2, 1, LockExclusive),
+		acquireAsync(lm, 3, 2, LockExclusive),
+		acquireAsync(lm, 6, 3, LockExclusive),
+	}
+	for _, waiting := range waits {
+		assertBlocked(t, waiting)
+	}
+	assert.Equal(t, [][]int64{{3, 2, 1}, {6, 4}, {6, 5}}, lm.WaitChain())
+
+	// txn 1 now waits for txn 3, closing a cycle
+	deadlocked := acquireAsync(lm, 1, 2, LockExclusive)
+	assertBlocked(t, deadlocked)
+	assert.Equal(t, [][]int64{{3, 2, 1, 2}, {6, 4}, {6, 5}}, lm.WaitChain())
+
+	// Without txn 3 nothing leads into the cycle, so it is reported starting from its lowest txn
+	lm.ReleaseAll(3)
+	assert.ErrorIs(t, <-waits[1], anomalytest.ErrTxnNotActive)
+	assert.Equal(t, [][]int64{{6, 4}, {6, 5}, {1, 2, 1}}, lm.WaitChain())
+
+	for txId := int64(1); txId <= 6; txId++ {
+		lm.ReleaseAll(txId)
+	}
+	assert.Empty(t, lm.WaitChain())
+}
+
+// waitUntilWaiting waits for txId to be blocked on a lock, so that requests arrive in a known order
+func waitUntilWaiting(t *testing.T, lm *BlockingLockManager, txId int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := lm.LockWaiters()[txId]; ok {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("txn %d never started waiting", txId)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBlockingLockManagerFIFO(t *testing.T) {
+	lm := NewBlockingLockManager()
+	lm.SetFIFOLocks(true)
+	assert.NoError(t, lm.Acquire(1, 1, LockExclusive))
+
+	waiting := make(map[int64]<-chan error)
+	for txId := int64(2); txId <= 5; txId++ {
+		waiting[txId] = acquireAsync(lm, txId, 1, LockExclusive)
+		waitUntilWaiting(t, lm, txId)
+	}
+	for txId := int64(1); txId < 5; txId++ {
+		lm.ReleaseAll(txId)
+		assertGranted(t, waiting[txId+1])
+		for later := txId + 2; later <= 5; later++ {
+			assertBlocked(t, waiting[later])
+		}
+	}
+	assert.Equal(t, []int64{1, 2, 3, 4, 5}, lm.GrantOrder(1), "waiters are granted the lock in arrival order")
+}
+
+func TestBlockingLockManagerFIFOQueuesSharedBehindExclusive(t *testing.T) {
+	lm := NewBlockingLockManager()
+	lm.SetFIFOLocks(true)
+	assert.NoError(t, lm.Acquire(1, 1, LockShared))
+
+	exclusive := acquireAsync(lm, 2, 1, LockExclusive)
+	waitUntilWaiting(t, lm, 2)
+	shared := acquireAsync(lm, 3, 1, LockShared)
+	assertBlocked(t, shared) // compatible with txn 1's lock, but txn 2 asked first
+	assert.NoError(t, lm.Acquire(1, 1, LockExclusive), "an upgrade does not queue behind waiters")
+	lm.ReleaseAll(1)
+	assertGranted(t, exclusive)
+	assertBlocked(t, shared)
+	lm.ReleaseAll(2)
+	assertGranted(t, shared)
+	assert.Equal(t, []int64{1, 1, 2, 3}, lm.GrantOrder(1))
+}
+
+func TestBlockingLockManagerUnblockedBy(t *testing.T) {
+	lm := NewBlockingLockManager()
+	assert.NoError(t, lm.Acquire(1, 1, LockExclusive))
+	assert.NoError(t, lm.Acquire(1, 2, LockExclusive))
+
+	competing := map[int64]<-chan error{
+		2: acquireAsync(lm, 2, 1, LockExclusive),
+		3: acquireAsync(lm, 3, 1, LockExclusive),
+	}
+	other := acquireAsync(lm, 4, 2, LockExclusive)
+	for txId := int64(2); txId <= 4; txId++ {
+		waitUntilWaiting(t, lm, txId)
+	}
+	lm.ReleaseAll(1)
+	assertGranted(t, other)
+
+	// Only one of the txns competing for key 1 gets it when txn 1 releases it
+	var winner, loser int64
+	select {
+	case err := <-competing[2]:
+		assert.NoError(t, err)
+		winner, loser = 2, 3
+	case err := <-competing[3]:
+		assert.NoError(t, err)
+		winner, loser = 3, 2
+	case <-time.After(time.Second):
+		t.Fatal("neither competing request was granted")
+	}
+	assertBlocked(t, competing[loser])
+	assert.ElementsMatch(t, []int64{winner, 4}, lm.UnblockedBy(1))
+
+	lm.ReleaseAll(winner)
+	assertGranted(t, competing[loser])
+	assert.Equal(t, []int64{loser}, lm.UnblockedBy(winner), "the loser is attributed to the release that granted its lock")
+	assert.Empty(t, lm.UnblockedBy(4))
+}
+
+func TestBlockingLockManagerDeadlockDetection(t *testing.T) {
+	lm := NewBlockingLockManager()
+	lm.SetDeadlockDetection(true)
+
+	// 1 -> 2 -> 3 -> 1 through three keys
+	assert.NoError(t, lm.Acquire(1, 1, LockExclusive))
+	assert.NoError(t, lm.Acquire(2, 2, LockExclusive))
+	assert.NoError(t, lm.Acquire(3, 3, LockExclusive))
+	first := acquireAsync(lm, 1, 2, LockExclusive)
+	waitUntilWaiting(t, lm, 1)
+	second := acquireAsync(lm, 2, 3, LockExclusive)
+	waitUntilWaiting(t, lm, 2)
+
+	err := lm.Acquire(3, 1, LockExclusive)
+	var deadlock *anomalytest.DeadlockError
+	assert.ErrorAs(t, err, &deadlock)
+	assert.ErrorIs(t, err, anomalytest.ErrDeadlock)
+	assert.Equal(t, int64(3), deadlock.Victim)
+	assert.Equal(t, []int64{3, 1, 2}, deadlock.Cycle)
+	assert.NotContains(t, lm.LockWaiters(), int64(3))
+	assertBlocked(t, second) // the victim keeps its locks until it ends
+
+	lm.ReleaseAll(3)
+	assertGranted(t, second)
+	lm.ReleaseAll(2)
+	assertGranted(t, first)
+}
+
+func TestBlockingLockManagerDeadlockOnUpgrade(t *testing.T) {
+	lm := NewBlockingLockManager()
+	lm.SetDeadlockDetection(true)
+
+	assert.NoError(t, lm.Acquire(1, 1, LockShared))
+	assert.NoError(t, lm.Acquire(2, 1, LockShared))
+	upgrade := acquireAsync(lm, 1, 1, LockExclusive)
+	waitUntilWaiting(t, lm, 1)
+
+	err := lm.Acquire(2, 1, LockExclusive)
+	assert.ErrorIs(t, err, anomalytest.ErrDeadlock)
+	lm.ReleaseAll(2)
+	assertGranted(t, upgrade)
+}
+
+func TestBlockingLockManagerRangeLocks(t *testing.T) {
+	lm := NewBlockingLockManager()
+
+	assert.NoError(t, lm.AcquireRange(1, 1, 10))
+	assert.NoError(t, lm.AcquireRange(2, 5, 15), "range locks are shared")
+	assert.NoError(t, lm.Acquire(1, 3, LockExclusive), "a txn can write inside its own range")
+	assertGranted(t, acquireAsync(lm, 3, 20, LockExclusive)) // outside every range
+
+	insert := acquireAsync(lm, 3, 7, LockExclusive) // a key that no txn has locked yet
+	assertBlocked(t, insert)
+	lm.ReleaseAll(1)
+	assertBlocked(t, insert) // txn 2's range still covers it
+	lm.ReleaseAll(2)
+	assertGranted(t, insert)
+	assert.Equal(t, 1, lm.LockWaitCount(3))
+
+	scan := make(chan error, 1)
+	go func() { scan <- lm.AcquireRange(4, 1, 10) }()
+	assertBlocked(t, scan) // txn 3 holds key 7 exclusively
+	lm.ReleaseAll(3)
+	assertGranted(t, scan)
+}
+
+func TestBlockingLockManagerDeadlockOnRange(t *testing.T) {
+	lm := NewBlockingLockManager()
+	lm.SetDeadlockDetection(true)
+
+	assert.NoError(t, lm.AcquireRange(1, 1, 10))
+	assert.NoError(t, lm.Acquire(2, 20, LockExclusive))
+	insert := acquireAsync(lm, 2, 5, LockExclusive)
+	waitUntilWaiting(t, lm, 2)
+
+	err := lm.Acquire(1, 20, LockExclusive)
+	var deadlock *anomalytest.DeadlockError
+	assert.ErrorAs(t, err, &deadlock)
+	assert.Equal(t, []int64{1, 2}, deadlock.Cycle)
+	assert.Equal(t, [][]int64{{2, 1}}, lm.WaitChain())
+	lm.ReleaseAll(1)
+	assertGranted(t, insert)
+}
+
+func TestBlockingLockManagerLockStats(t *testing.T) {
+	lm := NewBlockingLockManager()
+	assert.NoError(t, lm.Acquire(1, 1, LockExclusive))
+	assert.NoError(t, lm.Acquire(1, 1, LockExclusive), "a lock already held is not counted again")
+	assert.NoError(t, lm.AcquireRange(1, 5, 10))
+
+	waiting := acquireAsync(lm, 2, 1, LockShared)
+	assertBlocked(t, waiting)
+	lm.ReleaseAll(1)
+	assertGranted(t, waiting)
+
+	stats := lm.LockStats()
+	assert.Equal(t, 3, stats.Acquisitions)
+	assert.Equal(t, 1, stats.Waits)
+	assert.GreaterOrEqual(t, stats.WaitTime, 20*time.Millisecond, "the waiter was blocked for assertBlocked's 20ms")
+
+	lm.Reset()
+	assert.Equal(t, LockStats{}, lm.LockStats())
+}
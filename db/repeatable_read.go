@@ -0,0 +1,17 @@
+package db
+
+// DatabaseRepeatableRead is the snapshot isolation database with first-committer-wins validation: reads come
+// from the snapshot taken when the transaction began, and Commit fails with ErrSerializationFailure, rolling
+// the transaction back, if another transaction committed a key it wrote in the meantime. Of two concurrent
+// read-modify-write transactions on the same key, the second to commit aborts instead of overwriting the
+// first, so lost updates are prevented by aborting rather than blocking. Write skew is still possible, since
+// the transactions in it write different keys.
+type DatabaseRepeatableRead struct {
+	*DatabaseSnapshotIsolation
+}
+
+func NewDatabaseRepeatableRead() *DatabaseRepeatableRead {
+	d := NewDatabaseSnapshotIsolation()
+	d.firstCommitterWins = true
+	return &DatabaseRepeatableRead{DatabaseSnapshotIsolation: d}
+}
@@ -0,0 +1,81 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabaseRepeatableReadDirtyReadAbort(t *testing.T) {
+	anomalytest.TestDirtyReadAbort_G1a(t, NewDatabaseRepeatableRead())
+}
+
+// Writes do not block, so unlike in a locking database T2 is not made to wait for T1 in G0: its commit
+// fails instead, and the final state is T1's values for both keys
+func TestDatabaseRepeatableReadAbortsSecondWriterInG0(t *testing.T) {
+	exec := anomalytest.HermitageG0(NewDatabaseRepeatableRead())
+	results := exec.Execute(true)
+
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("T1"))
+	assert.Equal(t, anomalytest.OutcomeAborted, results.Outcome("T2"))
+	finalReads := exec.Reads("check")
+	assert.Equal(t, 11, results.GetValue(finalReads[0]))
+	assert.Equal(t, 21, results.GetValue(finalReads[1]))
+}
+
+func TestDatabaseRepeatableReadNonRepeatableRead(t *testing.T) {
+	anomalytest.TestNonRepeatableRead(t, NewDatabaseRepeatableRead())
+}
+
+func TestDatabaseRepeatableReadReadYourOwnWrites(t *testing.T) {
+	anomalytest.TestReadYourOwnWrites(t, NewDatabaseRepeatableRead())
+}
+
+func TestDatabaseRepeatableReadReadSkew(t *testing.T) {
+	anomalytest.TestReadSkew(t, NewDatabaseRepeatableRead())
+}
+
+func TestDatabaseRepeatableReadConservedSum(t *testing.T) {
+	anomalytest.TestConservedSum(t, NewDatabaseRepeatableRead())
+}
+
+func TestDatabaseRepeatableReadFirstCommitterWins(t *testing.T) {
+	db := NewDatabaseRepeatableRead()
+	txn1, _ := db.BeginTx(string(anomalytest.RepeatableRead))
+	txn2, _ := db.BeginTx(string(anomalytest.RepeatableRead))
+
+	// Both increment key 1 from the same snapshot
+	value1, _ := db.Get(txn1, 1)
+	value2, _ := db.Get(txn2, 1)
+	assert.NoError(t, db.Set(txn1, 1, value1+1))
+	assert.NoError(t, db.Set(txn2, 1, value2+1))
+
+	assert.NoError(t, db.Commit(txn1))
+	err := db.Commit(txn2)
+	assert.ErrorIs(t, err, anomalytest.ErrSerializationFailure)
+	assert.True(t, anomalytest.IsRetryable(err))
+	assert.Empty(t, db.ActiveTxns(), "the failed commit rolls txn2 back")
+	assert.Equal(t, map[int]int{1: 1}, db.State(), "txn1's increment is not lost")
+
+	// A retry begins after txn1's commit, so it reads 1 and does not conflict with it
+	retry, _ := db.BeginTx(string(anomalytest.RepeatableRead))
+	value, _ := db.Get(retry, 1)
+	db.Set(retry, 1, value+1)
+	assert.NoError(t, db.Commit(retry))
+	assert.Equal(t, map[int]int{1: 2}, db.State())
+	assert.Equal(t, []int{1, 2}, db.History(1))
+}
+
+// First-committer-wins only checks keys both transactions wrote, so write skew still gets through
+func TestDatabaseRepeatableReadAllowsWriteSkew(t *testing.T) {
+	exec := anomalytest.OnCallDoctors(NewDatabaseRepeatableRead())
+	results := exec.Execute(true)
+
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("alice"))
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("bob"))
+}
+
+func TestDatabaseRepeatableReadDirtyReadCircularInformationFlowG1c(t *testing.T) {
+	anomalytest.TestDirtyReadCircularInformationFlow_G1c(t, NewDatabaseRepeatableRead())
+}
@@ -0,0 +1,232 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+)
+
+// ReplicationEvent records a committed write and when it became visible on the replica
+type ReplicationEvent struct {
+	TxId        int64
+	Key         int
+	Value       int
+	Deleted     bool
+	CommittedAt time.Time
+	VisibleAt   time.Time
+}
+
+// replicatedWrite is a write made by a transaction, waiting to be shipped to the replica
+type replicatedWrite struct {
+	value   int
+	deleted bool
+}
+
+// replicatedCommit is a committed transaction queued for the replica
+type replicatedCommit struct {
+	txId        int64
+	writes      map[int]replicatedWrite
+	committedAt time.Time
+	visibleAt   time.Time
+}
+
+// ReplicationLagDB models an asynchronously replicated database. Writes go to the inner (primary)
+// database, and a transaction always reads its own writes from there. Every other read is served
+// from a replica that only receives a committed transaction's writes lag after it commits.
+type ReplicationLagDB struct {
+	inner anomalytest.Database
+	lag   time.Duration
+
+	commitMu  sync.Mutex // held across the primary's commit and the enqueue, so the queue is in the primary's commit order
+	mu        sync.Mutex
+	replica   map[int]int                       // committed data as seen by other transactions
+	txnWrites map[int64]map[int]replicatedWrite // txnId -> key -> latest write
+	queue     []*replicatedCommit               // commits not yet visible, in commit order
+	history   []ReplicationEvent
+	logger    anomalytest.Logger
+}
+
+func NewReplicationLagDB(inner anomalytest.Database, lag time.Duration) *ReplicationLagDB {
+	return &ReplicationLagDB{
+		inner:     inner,
+		lag:       lag,
+		replica:   make(map[int]int),
+		txnWrites: make(map[int64]map[int]replicatedWrite),
+		logger:    anomalytest.DefaultLogger(),
+	}
+}
+
+// WithReplicationLag is a DecoratorFunc that wraps a database with NewReplicationLagDB
+func WithReplicationLag(lag time.Duration) DecoratorFunc {
+	return func(inner anomalytest.Database) anomalytest.Database {
+		return NewReplicationLagDB(inner, lag)
+	}
+}
+
+func (d *ReplicationLagDB) BeginTx(isolationLevel string) (int64, error) {
+	txId, err := d.inner.BeginTx(isolationLevel)
+	if err != nil {
+		return 0, err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.txnWrites[txId] = make(map[int]replicatedWrite)
+	return txId, nil
+}
+
+func (d *ReplicationLagDB) Set(txId int64, key int, value int) error {
+	if err := d.inner.Set(txId, key, value); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.txnWrites[txId][key] = replicatedWrite{value: value}
+	return nil
+}
+
+func (d *ReplicationLagDB) Get(txId int64, key int) (int, error) {
+	d.mu.Lock()
+	writes, active := d.txnWrites[txId]
+	_, wroteKey := writes[key]
+	value := d.replica[key]
+	d.mu.Unlock()
+
+	if !active {
+		return 0, fmt.Errorf("txn %d reading key %d: %w", txId, key, anomalytest.ErrTxnNotActive)
+	}
+
+	if wroteKey {
+		// Read-your-writes: a transaction's own writes are served by the primary
+		return d.inner.Get(txId, key)
+	}
+	return value, nil
+}
+
+func (d *ReplicationLagDB) Delete(txId int64, key int) error {
+	if err := d.inner.Delete(txId, key); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.txnWrites[txId][key] = replicatedWrite{deleted: true}
+	return nil
+}
+
+// Commit commits on the primary and queues the transaction's writes for the replica. The primary may release
+// its row locks as it commits, so the enqueue happens before another commit can start, or a later writer of
+// the same key could be queued, and applied, ahead of this one.
+func (d *ReplicationLagDB) Commit(txId int64) error {
+	d.commitMu.Lock()
+	defer d.commitMu.Unlock()
+	if err := d.inner.Commit(txId); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	d.queue = append(d.queue, &replicatedCommit{
+		txId:        txId,
+		writes:      d.txnWrites[txId],
+		committedAt: now,
+		visibleAt:   now.Add(d.lag),
+	})
+	delete(d.txnWrites, txId)
+	time.AfterFunc(d.lag, d.applyDue)
+	return nil
+}
+
+// applyDue applies every queued commit whose lag has elapsed, in commit order
+func (d *ReplicationLagDB) applyDue() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for len(d.queue) > 0 && !d.queue[0].visibleAt.After(now) {
+		commit := d.queue[0]
+		d.queue = d.queue[1:]
+		for key, write := range commit.writes {
+			if write.deleted {
+				delete(d.replica, key)
+			} else {
+				d.replica[key] = write.value
+			}
+			d.history = append(d.history, ReplicationEvent{
+				TxId:        commit.txId,
+				Key:         key,
+				Value:       write.value,
+				Deleted:     write.deleted,
+				CommittedAt: commit.committedAt,
+				VisibleAt:   now,
+			})
+		}
+	}
+}
+
+func (d *ReplicationLagDB) Rollback(txId int64) error {
+	if err := d.inner.Rollback(txId); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.txnWrites, txId)
+	return nil
+}
+
+// State returns the replica's contents, which is what transactions see for keys they have not written
+func (d *ReplicationLagDB) State() map[int]int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	state := make(map[int]int, len(d.replica))
+	for key, value := range d.replica {
+		state[key] = value
+	}
+	return state
+}
+
+// ActiveTxns returns the transactions that have begun but not yet committed or rolled back
+func (d *ReplicationLagDB) ActiveTxns() []int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	txns := make([]int64, 0, len(d.txnWrites))
+	for txId := range d.txnWrites {
+		txns = append(txns, txId)
+	}
+	return txns
+}
+
+// PendingCommits returns the committed transactions whose writes have not reached the replica yet
+func (d *ReplicationLagDB) PendingCommits() []int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	txns := make([]int64, len(d.queue))
+	for i, commit := range d.queue {
+		txns[i] = commit.txId
+	}
+	return txns
+}
+
+// ReplicationLog returns every write applied to the replica so far, in the order it became visible
+func (d *ReplicationLagDB) ReplicationLog() []ReplicationEvent {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]ReplicationEvent(nil), d.history...)
+}
+
+// SetLogger sets the logger that PrintState writes the replica state to
+func (d *ReplicationLagDB) SetLogger(logger anomalytest.Logger) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logger = logger
+}
+
+func (d *ReplicationLagDB) PrintState() {
+	d.inner.PrintState()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	pending := make([]string, len(d.queue))
+	for i, commit := range d.queue {
+		pending[i] = fmt.Sprintf("txn %d: %d writes, visible at %s", commit.txId, len(commit.writes), commit.visibleAt.Format(time.StampMicro))
+	}
+	d.logger.Info("replica state", "replica", d.replica, "pending", pending)
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplicationLagDBReadYourWritesAndLag(t *testing.T) {
+	const lag = 50 * time.Millisecond
+	db := NewReplicationLagDB(NewSimpleDBReadUncommitted(), lag)
+
+	writer, _ := db.BeginTx("READ_UNCOMMITTED")
+	reader, _ := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, db.Set(writer, 1, 100))
+
+	value, _ := db.Get(writer, 1)
+	assert.Equal(t, 100, value, "The writer should read its own write immediately")
+	value, _ = db.Get(reader, 1)
+	assert.Equal(t, 0, value, "Other transactions should not see an uncommitted write")
+
+	assert.NoError(t, db.Commit(writer))
+	value, _ = db.Get(reader, 1)
+	assert.Equal(t, 0, value, "The commit should not be visible before the lag elapses")
+
+	assert.Eventually(t, func() bool {
+		value, _ := db.Get(reader, 1)
+		return value == 100
+	}, 10*lag, lag/10, "The commit should become visible after the lag")
+
+	log := db.ReplicationLog()
+	assert.Len(t, log, 1)
+	assert.Equal(t, writer, log[0].TxId)
+	assert.Equal(t, 100, log[0].Value)
+	assert.GreaterOrEqual(t, log[0].VisibleAt.Sub(log[0].CommittedAt), lag)
+}
+
+func TestReplicationLagDBRollbackIsNeverReplicated(t *testing.T) {
+	db := NewReplicationLagDB(NewSimpleDBReadUncommitted(), time.Millisecond)
+
+	writer, _ := db.BeginTx("READ_UNCOMMITTED")
+	reader, _ := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, db.Set(writer, 1, 100))
+	assert.NoError(t, db.Rollback(writer))
+
+	time.Sleep(10 * time.Millisecond)
+	value, _ := db.Get(reader, 1)
+	assert.Equal(t, 0, value)
+	assert.Empty(t, db.ReplicationLog())
+}
+
+func TestReplicationLagDBGetRejectsEndedTxn(t *testing.T) {
+	db := NewReplicationLagDB(NewSimpleDBReadUncommitted(), time.Millisecond)
+
+	txId, _ := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, db.Commit(txId))
+	_, err := db.Get(txId, 1)
+	assert.ErrorIs(t, err, anomalytest.ErrTxnNotActive)
+	_, err = db.Get(txId+1, 1) // never begun
+	assert.ErrorIs(t, err, anomalytest.ErrTxnNotActive)
+}
+
+// slowCommitDB pauses after the commit of txn pause, once the primary has committed and released its locks
+type slowCommitDB struct {
+	*SimpleDBReadUncommittedWriteLock
+	pause int64
+}
+
+func (d *slowCommitDB) Commit(txId int64) error {
+	err := d.SimpleDBReadUncommittedWriteLock.Commit(txId)
+	if txId == d.pause {
+		time.Sleep(50 * time.Millisecond)
+	}
+	return err
+}
+
+func TestReplicationLagDBReplicatesInCommitOrder(t *testing.T) {
+	const lag = 10 * time.Millisecond
+	primary := &slowCommitDB{SimpleDBReadUncommittedWriteLock: NewSimpleDBReadUncommittedWriteLock()}
+	db := NewReplicationLagDB(primary, lag)
+	first, _ := db.BeginTx("READ_UNCOMMITTED")
+	primary.pause = first
+
+	second, _ := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, db.Set(first, 1, 1))
+	done := make(chan error, 1)
+	go func() {
+		err := db.Set(second, 1, 2) // waits for first's row lock
+		if err == nil {
+			err = db.Commit(second) // runs while first's commit is paused
+		}
+		done <- err
+	}()
+	assert.NoError(t, db.Commit(first))
+	assert.NoError(t, <-done)
+
+	assert.Eventually(t, func() bool { return len(db.PendingCommits()) == 0 }, time.Second, lag)
+	assert.Equal(t, map[int]int{1: 2}, db.State(), "the replica should end with the later commit's value")
+	if log := db.ReplicationLog(); assert.Len(t, log, 2) {
+		assert.Equal(t, []int64{first, second}, []int64{log[0].TxId, log[1].TxId})
+	}
+}
+
+func TestReplicationLagDBWaitQuiescent(t *testing.T) {
+	const lag = 50 * time.Millisecond
+	db := NewReplicationLagDB(NewSimpleDBReadUncommitted(), lag)
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	writer := exec.NewTxn("writer")
+	writer.BeginTx()
+	writer.Set(1, 100)
+	writer.Commit()
+	exec.Execute(false)
+
+	err := exec.WaitQuiescent(db, time.Millisecond)
+	assert.ErrorContains(t, err, "commits not yet visible [1]")
+
+	assert.NoError(t, exec.WaitQuiescent(db, 10*lag))
+	assert.Equal(t, map[int]int{1: 100}, db.State())
+}
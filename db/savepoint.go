@@ -0,0 +1,32 @@
+package db
+
+import "slices"
+
+// savepoint marks a point in a transaction that it can be rolled back to
+type savepoint struct {
+	name    string
+	undoOps int          // length of the transaction's undo log when the savepoint was set
+	writes  map[int]bool // keys the transaction had written by then, for databases that track them
+	values  map[int]int  // the transaction's latest write to each key by then, for databases that track them
+}
+
+// savepoints holds the savepoints of each transaction, oldest first
+type savepoints map[int64][]savepoint
+
+// set adds sp to txId's savepoints, dropping an earlier one of the same name
+func (s savepoints) set(txId int64, sp savepoint) {
+	list := slices.DeleteFunc(s[txId], func(old savepoint) bool { return old.name == sp.name })
+	s[txId] = append(list, sp)
+}
+
+// rollbackTo returns txId's savepoint called name and forgets the ones set after it
+func (s savepoints) rollbackTo(txId int64, name string) (savepoint, bool) {
+	list := s[txId]
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].name == name {
+			s[txId] = list[:i+1]
+			return list[i], true
+		}
+	}
+	return savepoint{}, false
+}
@@ -2,25 +2,44 @@ package db
 
 import (
 	"fmt"
+	"maps"
+	"slices"
 	"sync"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
 )
 
 type SimpleDBReadUncommitted struct {
 	data       map[int]int
+	index      valueIndex // value -> keys, kept in step with data
 	mu         sync.RWMutex
 	nextTxnId  int64
 	txnUndoOps map[int64][]func()
+	txnValues  map[int64]map[int]int // txnId -> the latest value it wrote to each key, added to history when it commits
+	history    history
+	savepoints savepoints
+	logger     anomalytest.Logger
 }
 
 func NewSimpleDBReadUncommitted() *SimpleDBReadUncommitted {
 	return &SimpleDBReadUncommitted{
 		data:       make(map[int]int),
+		index:      make(valueIndex),
 		mu:         sync.RWMutex{},
 		nextTxnId:  1,
 		txnUndoOps: make(map[int64][]func()),
+		txnValues:  make(map[int64]map[int]int),
+		history:    make(history),
+		savepoints: make(savepoints),
+		logger:     anomalytest.DefaultLogger(),
 	}
 }
 
+func (d *SimpleDBReadUncommitted) Capabilities() anomalytest.Capability {
+	return anomalytest.CapSnapshot | anomalytest.CapIndex | anomalytest.CapAggregate | anomalytest.CapScan |
+		anomalytest.CapSavepoint | anomalytest.CapBatch
+}
+
 func (d *SimpleDBReadUncommitted) BeginTx(isolationLevel string) (int64, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -34,43 +53,135 @@ func (d *SimpleDBReadUncommitted) BeginTx(isolationLevel string) (int64, error)
 func (d *SimpleDBReadUncommitted) Set(txId int64, key int, value int) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	if _, active := d.txnUndoOps[txId]; !active {
+		return fmt.Errorf("txn %d writing key %d: %w", txId, key, anomalytest.ErrTxnNotActive)
+	}
+	d.set(txId, key, value)
+	return nil
+}
+
+// SetMany writes every key in kv under one hold of mu, so that no other operation sees some of the writes
+// without the others
+func (d *SimpleDBReadUncommitted) SetMany(txId int64, kv map[int]int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	keys := slices.Sorted(maps.Keys(kv))
+	if _, active := d.txnUndoOps[txId]; !active {
+		return fmt.Errorf("txn %d writing keys %v: %w", txId, keys, anomalytest.ErrTxnNotActive)
+	}
+	for _, key := range keys {
+		d.set(txId, key, kv[key])
+	}
+	return nil
+}
+
+// set writes value to key and records how to undo it. Caller must hold mu.
+// Each undo op restores what key held just before its own write, so applying them in reverse order walks any
+// mix of Set and Delete on a key back to the value, or absence, it had before the transaction.
+func (d *SimpleDBReadUncommitted) set(txId int64, key int, value int) {
 	oldValue, ok := d.data[key]
 	if ok {
 		d.txnUndoOps[txId] = append(d.txnUndoOps[txId], func() {
-			d.data[key] = oldValue
+			d.put(key, oldValue)
 		})
 	} else {
 		d.txnUndoOps[txId] = append(d.txnUndoOps[txId], func() {
-			delete(d.data, key)
+			d.remove(key)
 		})
 	}
+	d.put(key, value)
+	if d.txnValues[txId] == nil {
+		d.txnValues[txId] = make(map[int]int)
+	}
+	d.txnValues[txId][key] = value
+}
+
+// put writes value to key and keeps the value index in step. Caller must hold mu.
+func (d *SimpleDBReadUncommitted) put(key int, value int) {
+	if oldValue, ok := d.data[key]; ok {
+		d.index.remove(oldValue, key)
+	}
 	d.data[key] = value
-	return nil
+	d.index.add(value, key)
+}
+
+// remove deletes key and keeps the value index in step. Caller must hold mu.
+func (d *SimpleDBReadUncommitted) remove(key int) {
+	if oldValue, ok := d.data[key]; ok {
+		d.index.remove(oldValue, key)
+	}
+	delete(d.data, key)
 }
 
 func (d *SimpleDBReadUncommitted) Get(txId int64, key int) (int, error) {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
+	if _, active := d.txnUndoOps[txId]; !active {
+		return 0, fmt.Errorf("txn %d reading key %d: %w", txId, key, anomalytest.ErrTxnNotActive)
+	}
 	return d.data[key], nil
 }
 
+// GetByValue returns the keys whose value is value, in ascending order. Like Get, it sees every write,
+// committed or not.
+func (d *SimpleDBReadUncommitted) GetByValue(txId int64, value int) ([]int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.index.keys(value), nil
+}
+
+// Sum returns the total of keys, read under one hold of mu so that no write lands partway through.
+// Like Get, it sees every write, committed or not.
+func (d *SimpleDBReadUncommitted) Sum(txId int64, keys []int) (int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	total := 0
+	for _, key := range keys {
+		total += d.data[key]
+	}
+	return total, nil
+}
+
+// Scan returns every key from lo to hi with its value. Like Get, it sees every write, committed or not.
+func (d *SimpleDBReadUncommitted) Scan(txId int64, lo, hi int) (map[int]int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	rows := make(map[int]int)
+	for key, value := range d.data {
+		if lo <= key && key <= hi {
+			rows[key] = value
+		}
+	}
+	return rows, nil
+}
+
 func (d *SimpleDBReadUncommitted) Delete(txId int64, key int) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	if _, active := d.txnUndoOps[txId]; !active {
+		return fmt.Errorf("txn %d deleting key %d: %w", txId, key, anomalytest.ErrTxnNotActive)
+	}
 	oldValue, ok := d.data[key]
 	if ok {
 		d.txnUndoOps[txId] = append(d.txnUndoOps[txId], func() {
-			d.data[key] = oldValue
+			d.put(key, oldValue)
 		})
 	}
-	delete(d.data, key)
+	d.remove(key)
+	delete(d.txnValues[txId], key)
 	return nil
 }
 
 func (d *SimpleDBReadUncommitted) Commit(txId int64) error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	values := d.txnValues[txId]
+	for _, key := range slices.Sorted(maps.Keys(values)) {
+		d.history.add(key, values[key])
+	}
 	delete(d.txnUndoOps, txId)
+	delete(d.txnValues, txId)
+	delete(d.savepoints, txId)
 	return nil
 }
 
@@ -82,23 +193,132 @@ func (d *SimpleDBReadUncommitted) Rollback(txId int64) error {
 		d.txnUndoOps[txId][i]()
 	}
 	delete(d.txnUndoOps, txId)
+	delete(d.txnValues, txId)
+	delete(d.savepoints, txId)
 	return nil
 }
 
-func (d *SimpleDBReadUncommitted) PrintState() {
+// Savepoint marks txId's current point under name so that RollbackTo can return to it
+func (d *SimpleDBReadUncommitted) Savepoint(txId int64, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	undoOps, active := d.txnUndoOps[txId]
+	if !active {
+		return fmt.Errorf("txn %d setting savepoint %s: %w", txId, name, anomalytest.ErrTxnNotActive)
+	}
+	d.savepoints.set(txId, savepoint{name: name, undoOps: len(undoOps), values: maps.Clone(d.txnValues[txId])})
+	return nil
+}
+
+// RollbackTo undoes txId's writes since the savepoint called name, in reverse order, and keeps the
+// transaction active
+func (d *SimpleDBReadUncommitted) RollbackTo(txId int64, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	undoOps, active := d.txnUndoOps[txId]
+	if !active {
+		return fmt.Errorf("txn %d rolling back to savepoint %s: %w", txId, name, anomalytest.ErrTxnNotActive)
+	}
+	sp, ok := d.savepoints.rollbackTo(txId, name)
+	if !ok {
+		return fmt.Errorf("txn %d rolling back to savepoint %s: %w", txId, name, anomalytest.ErrNoSavepoint)
+	}
+	for i := len(undoOps) - 1; i >= sp.undoOps; i-- {
+		undoOps[i]()
+	}
+	d.txnUndoOps[txId] = undoOps[:sp.undoOps]
+	d.txnValues[txId] = maps.Clone(sp.values)
+	return nil
+}
+
+// Snapshot returns a copy of all data. Every transaction sees every write, committed or not.
+func (d *SimpleDBReadUncommitted) Snapshot(txId int64) (map[int]int, error) {
+	return d.State(), nil
+}
+
+// State returns a copy of all data, including writes of transactions that have not committed yet
+func (d *SimpleDBReadUncommitted) State() map[int]int {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
-	fmt.Println("--------------------------------")
-	fmt.Println("Database State:")
+	state := make(map[int]int, len(d.data))
 	for key, value := range d.data {
-		fmt.Printf("  %d: %d\n", key, value)
+		state[key] = value
+	}
+	return state
+}
+
+// History returns the values committed to key, oldest first. A transaction that wrote key several times
+// adds only its last write when it commits, and one that deleted key adds nothing.
+func (d *SimpleDBReadUncommitted) History(key int) []int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.history.of(key)
+}
+
+// ActiveTxns returns the transactions that have begun but not yet committed or rolled back
+func (d *SimpleDBReadUncommitted) ActiveTxns() []int64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	txns := make([]int64, 0, len(d.txnUndoOps))
+	for txId := range d.txnUndoOps {
+		txns = append(txns, txId)
+	}
+	return txns
+}
+
+// DumpState serializes the committed data so that LoadState can restore it. Writes are applied in place
+// at read uncommitted, so it fails while any transaction is active rather than capture uncommitted data.
+func (d *SimpleDBReadUncommitted) DumpState() ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if len(d.txnUndoOps) > 0 {
+		return nil, fmt.Errorf("dumping state with %d active txns", len(d.txnUndoOps))
+	}
+	return encodeState(d.data)
+}
+
+// LoadState replaces all data with a dump made by DumpState. It fails while any transaction is active.
+func (d *SimpleDBReadUncommitted) LoadState(dump []byte) error {
+	data, index, err := decodeState(dump)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.txnUndoOps) > 0 {
+		return fmt.Errorf("loading state with %d active txns", len(d.txnUndoOps))
 	}
+	d.data = data
+	d.index = index
+	return nil
+}
 
-	fmt.Println("Txn Undo Ops:")
+// Reset discards all data and transactions and restarts transaction ids at 1
+func (d *SimpleDBReadUncommitted) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.data = make(map[int]int)
+	d.index = make(valueIndex)
+	d.nextTxnId = 1
+	d.txnUndoOps = make(map[int64][]func())
+	d.txnValues = make(map[int64]map[int]int)
+	d.history = make(history)
+	d.savepoints = make(savepoints)
+}
+
+// SetLogger sets the logger that PrintState writes to
+func (d *SimpleDBReadUncommitted) SetLogger(logger anomalytest.Logger) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logger = logger
+}
+
+func (d *SimpleDBReadUncommitted) PrintState() {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	undoOps := make(map[int64]int, len(d.txnUndoOps))
 	for txId, ops := range d.txnUndoOps {
-		fmt.Printf("  Txn %d: %v\n", txId, ops)
+		undoOps[txId] = len(ops)
 	}
-	fmt.Println("Next Txn ID:")
-	fmt.Printf("  %d\n", d.nextTxnId)
-	fmt.Println("--------------------------------")
+	d.logger.Info("database state", "data", d.data, "undo_ops", undoOps, "next_txn_id", d.nextTxnId)
 }
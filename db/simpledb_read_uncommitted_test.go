@@ -1,9 +1,12 @@
 package db
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestSimpleDBReadUncommittedDirtyReadAbort(t *testing.T) {
@@ -25,3 +28,382 @@ func TestSimpleDBReadUncommittedDirtyWrite(t *testing.T) {
 	db := NewSimpleDBReadUncommitted()
 	anomalytest.TestDirtyWrite(t, db)
 }
+
+func TestSimpleDBReadUncommittedDirtyWriteG0(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	anomalytest.TestDirtyWrite_G0(t, db)
+}
+
+// Skipped: the naive database has no Increment operation
+func TestSimpleDBReadUncommittedLostUpdateAtomicIncrement(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	anomalytest.TestLostUpdateAtomicIncrement(t, db)
+}
+
+func TestSimpleDBReadUncommittedLostUpdateCompareAndSwap(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	anomalytest.TestLostUpdateCompareAndSwap(t, db)
+}
+
+// Skipped: the naive database keeps a single version of each key, so it cannot serve snapshots
+func TestSimpleDBReadUncommittedSnapshotReadConsistency(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	anomalytest.TestSnapshotReadConsistency(t, db)
+}
+
+func TestSimpleDBReadUncommittedReadYourOwnWrites(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	anomalytest.TestReadYourOwnWrites(t, db)
+}
+
+func TestSimpleDBReadUncommittedNonRepeatableRead(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	anomalytest.TestNonRepeatableRead(t, db)
+}
+
+func TestSimpleDBReadUncommittedAssertHoldsLockIsSkipped(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.AssertHoldsLock(1) // no row locks to check
+	txn1.Commit()
+
+	results := exec.Execute(true)
+	assert.Empty(t, results.AssertionFailures())
+	skipped := results.SkippedOps()
+	assert.Len(t, skipped, 1)
+	assert.Equal(t, 1, skipped[0].OpIndex)
+	assert.Equal(t, anomalytest.CapLocking, skipped[0].Missing)
+}
+
+func TestSimpleDBReadUncommittedCheckpoints(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Barrier("txn1_wrote")
+	txn1.WaitFor("txn2_checkpointed")
+	txn1.Rollback()
+	txn1.Barrier("txn1_rolled_back")
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.BeginTx()
+	txn2.Set(2, 200)
+	txn2.WaitFor("txn1_wrote")
+	txn2.Checkpoint("before_rollback")
+	txn2.Barrier("txn2_checkpointed")
+	txn2.WaitFor("txn1_rolled_back")
+	txn2.Checkpoint("after_rollback")
+	txn2.Checkpoint("after_rollback") // duplicate label is rejected
+	txn2.Commit()
+
+	results := exec.Execute(true)
+
+	// Read uncommitted: the checkpoint sees txn1's uncommitted write
+	assert.Equal(t, map[int]int{1: 100, 2: 200}, results.Checkpoint("before_rollback"))
+	assert.Equal(t, map[int]int{2: 200}, results.Checkpoint("after_rollback"))
+	assert.Nil(t, results.Checkpoint("never_taken"))
+}
+
+func TestSimpleDBReadUncommittedReport(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Barrier("txn1_wrote")
+	txn1.WaitFor("txn2_read")
+	txn1.Rollback()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_wrote")
+	txn2.BeginTx()
+	txn2.Get(1)
+	txn2.Barrier("txn2_read")
+	txn2.Set(2, 200)
+	txn2.Commit()
+
+	results := exec.Execute(false)
+
+	var report strings.Builder
+	assert.NoError(t, results.Report(&report))
+	assert.Equal(t, `txn txn1: rolled back
+  (0)       BEGIN_TX
+  (1) write SET 1 = 100
+  (4)       ROLLBACK
+txn txn2: committed
+  (1)       BEGIN_TX
+  (2) read  GET 1 -> 100
+  (4) write SET 2 = 200
+  (5)       COMMIT
+final state of default:
+  2 = 200
+`, report.String())
+}
+
+func TestSimpleDBReadUncommittedGetByValueFollowsRollback(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	setup := exec.NewTxn("setup")
+	setup.BeginTx()
+	setup.Set(3, 5)
+	setup.Commit()
+	setup.Barrier("setup_done")
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.WaitFor("setup_done")
+	txn1.BeginTx()
+	txn1.Set(1, 5)
+	txn1.Set(3, 7) // moves key 3 out of the value 5 index entry
+	txn1.Barrier("txn1_wrote")
+	txn1.WaitFor("txn2_read")
+	txn1.Rollback()
+	txn1.Barrier("txn1_rolled_back")
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_wrote")
+	txn2.BeginTx()
+	during := txn2.GetByValue(5)
+	duringSeven := txn2.GetByValue(7)
+	txn2.Barrier("txn2_read")
+	txn2.WaitFor("txn1_rolled_back")
+	after := txn2.GetByValue(5)
+	afterSeven := txn2.GetByValue(7)
+	txn2.Commit()
+
+	results := exec.Execute(true)
+
+	// Read uncommitted: the index shows txn1's uncommitted writes, then forgets them on rollback
+	assert.Equal(t, []int{1}, results.Keys(during))
+	assert.Equal(t, []int{3}, results.Keys(duringSeven))
+	assert.Equal(t, []int{3}, results.Keys(after))
+	assert.Empty(t, results.Keys(afterSeven))
+}
+
+func TestSimpleDBReadUncommittedDumpAndLoadState(t *testing.T) {
+	src := NewSimpleDBReadUncommitted()
+	tx1, _ := src.BeginTx("")
+	src.Set(tx1, 1, 10)
+	src.Set(tx1, 2, 20)
+	src.Set(tx1, 3, 20)
+	src.Commit(tx1)
+
+	tx2, _ := src.BeginTx("")
+	src.Set(tx2, 1, 11) // uncommitted
+	_, err := src.DumpState()
+	assert.Error(t, err, "dumping would capture tx2's uncommitted write")
+	src.Rollback(tx2)
+
+	dump, err := src.DumpState()
+	assert.NoError(t, err)
+
+	dst := NewSimpleDBReadUncommitted()
+	tx3, _ := dst.BeginTx("")
+	assert.Error(t, dst.LoadState(dump), "loading under an active txn should fail")
+	dst.Rollback(tx3)
+	assert.NoError(t, dst.LoadState(dump))
+	assert.Equal(t, src.State(), dst.State())
+
+	tx4, _ := dst.BeginTx("")
+	keys, _ := dst.GetByValue(tx4, 20)
+	assert.Equal(t, []int{2, 3}, keys, "the value index should be rebuilt from the dump")
+}
+
+// Skipped: the naive database has no constraints
+func TestSimpleDBReadUncommittedForeignKeyViolation(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	anomalytest.TestForeignKeyViolation(t, db)
+}
+
+func TestSimpleDBReadUncommittedSum(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	tx1, _ := db.BeginTx("")
+	db.Set(tx1, 1, 10)
+	db.Set(tx1, 2, 20)
+
+	tx2, _ := db.BeginTx("")
+	total, err := db.Sum(tx2, []int{1, 2, 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 30, total, "uncommitted writes are summed and a missing key counts as 0")
+}
+
+func TestSimpleDBReadUncommittedMinimizeDirtyRead(t *testing.T) {
+	exec := anomalytest.NewTxnsExecutor(NewSimpleDBReadUncommitted())
+
+	noise := exec.NewTxn("noise")
+	noise.BeginTx()
+	noise.Set(5, 50)
+	noise.Get(6)
+	noise.Commit()
+	noise.Barrier("noise_done")
+
+	writer := exec.NewTxn("writer")
+	writer.BeginTx()
+	writer.Set(2, 20)
+	writer.Set(1, 101)
+	writer.Barrier("writer_wrote")
+	writer.WaitFor("reader_read")
+	writer.Get(2)
+	writer.Rollback()
+
+	reader := exec.NewTxn("reader")
+	reader.WaitFor("noise_done")
+	reader.WaitFor("writer_wrote")
+	reader.BeginTx()
+	reader.Get(3)
+	dirty := reader.Get(1)
+	reader.Barrier("reader_read")
+	reader.Set(4, 40)
+	reader.Commit()
+
+	factory := func() anomalytest.Database { return NewSimpleDBReadUncommitted() }
+	sawDirtyRead := func(results *anomalytest.Results) bool {
+		return results.GetValue(dirty) == 101 && results.Outcome("writer") == anomalytest.OutcomeRolledBack
+	}
+	minimized := anomalytest.Minimize(exec, factory, sawDirtyRead)
+
+	assert.NoError(t, minimized.Validate())
+	assert.True(t, sawDirtyRead(minimized.Execute(false)), "the minimized schedule still reproduces the dirty read")
+	assert.Equal(t, []*anomalytest.GetResult{dirty}, minimized.Reads("reader"))
+	assert.Empty(t, minimized.Reads("noise"), "the noise txn is dropped")
+
+	var report strings.Builder
+	assert.NoError(t, minimized.Execute(false).Report(&report))
+	assert.NotContains(t, report.String(), "SET 2 = 20")
+	assert.NotContains(t, report.String(), "SET 4 = 40")
+}
+
+// scheduleCrossWrites schedules two transactions that each write their own value to keys 1 and 2
+func scheduleCrossWrites(exec *anomalytest.TxnsExecutor) {
+	for _, value := range []int{1, 2} {
+		txn := exec.NewTxn(fmt.Sprintf("txn%d", value))
+		txn.BeginTx()
+		txn.Set(1, value)
+		txn.Set(2, value)
+		txn.Commit()
+	}
+}
+
+func TestSimpleDBReadUncommittedRandomInterleavingsMixWrites(t *testing.T) {
+	exec := anomalytest.NewTxnsExecutor(NewSimpleDBReadUncommitted())
+	scheduleCrossWrites(exec)
+
+	states := exec.ExecuteRandom(1, 50)
+
+	// Without write locks the two transactions' writes can interleave, leaving keys 1 and 2 from different ones
+	assert.Contains(t, states, map[int]int{1: 1, 2: 2})
+	assert.Equal(t, states, exec.ExecuteRandom(1, 50), "the same seed explores the same interleavings")
+}
+
+func TestSimpleDBReadUncommittedSetManyIsNeverMixed(t *testing.T) {
+	exec := anomalytest.NewTxnsExecutor(NewSimpleDBReadUncommitted())
+	for _, value := range []int{1, 2} {
+		txn := exec.NewTxn(fmt.Sprintf("txn%d", value))
+		txn.BeginTx()
+		txn.SetMany(map[int]int{1: value, 2: value, 3: value})
+		txn.Commit()
+	}
+
+	states := exec.ExecuteRandom(1, 50)
+
+	// The writes of TestSimpleDBReadUncommittedRandomInterleavingsMixWrites, but each transaction's as one operation
+	assert.ElementsMatch(t, []map[int]int{{1: 1, 2: 1, 3: 1}, {1: 2, 2: 2, 3: 2}}, states)
+}
+
+func TestSimpleDBReadUncommittedScanSeesPhantom(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	reader, _ := db.BeginTx("READ_UNCOMMITTED")
+	writer, _ := db.BeginTx("READ_UNCOMMITTED")
+	db.Set(writer, 2, 20)
+	db.Commit(writer)
+
+	first, _ := db.Scan(reader, 1, 10)
+	inserter, _ := db.BeginTx("READ_UNCOMMITTED")
+	db.Set(inserter, 3, 30)
+	db.Set(inserter, 11, 110) // outside the range
+	second, _ := db.Scan(reader, 1, 10)
+
+	assert.Equal(t, map[int]int{2: 20}, first)
+	assert.Equal(t, map[int]int{2: 20, 3: 30}, second, "the uncommitted insert appears as a phantom")
+}
+
+func TestSimpleDBReadUncommittedRollbackToSavepoint(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	txn, _ := db.BeginTx("READ_UNCOMMITTED")
+	db.Set(txn, 1, 10)
+	db.Savepoint(txn, "first")
+	db.Set(txn, 1, 11)
+	db.Savepoint(txn, "second")
+	db.Set(txn, 2, 20)
+
+	assert.NoError(t, db.RollbackTo(txn, "first"))
+	assert.Equal(t, map[int]int{1: 10}, db.State())
+	assert.ErrorIs(t, db.RollbackTo(txn, "second"), anomalytest.ErrNoSavepoint, "later savepoints are forgotten")
+
+	db.Rollback(txn)
+	assert.Empty(t, db.State())
+}
+
+func TestSimpleDBReadUncommittedHistory(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	txn1, _ := db.BeginTx("READ_UNCOMMITTED")
+	db.Set(txn1, 1, 10)
+	db.Set(txn1, 1, 11)
+	db.Commit(txn1)
+
+	txn2, _ := db.BeginTx("READ_UNCOMMITTED")
+	db.Set(txn2, 1, 12)
+	db.Savepoint(txn2, "before_13")
+	db.Set(txn2, 1, 13)
+	db.RollbackTo(txn2, "before_13")
+	db.Commit(txn2)
+
+	txn3, _ := db.BeginTx("READ_UNCOMMITTED")
+	db.Set(txn3, 1, 99)
+	db.Rollback(txn3)
+
+	assert.Equal(t, []int{11, 12}, db.History(1), "only each committed txn's last write is kept")
+	assert.Empty(t, db.History(2))
+}
+
+func TestSimpleDBReadUncommittedRejectsOpsAfterTxnEnds(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	txn1, _ := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, db.Set(txn1, 1, 10))
+	assert.NoError(t, db.Commit(txn1))
+
+	assert.ErrorIs(t, db.Set(txn1, 1, 11), anomalytest.ErrTxnNotActive)
+	assert.ErrorIs(t, db.Delete(txn1, 1), anomalytest.ErrTxnNotActive)
+	_, err := db.Get(txn1, 1)
+	assert.ErrorIs(t, err, anomalytest.ErrTxnNotActive)
+
+	txn2, _ := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, db.Rollback(txn2))
+	assert.ErrorIs(t, db.SetMany(txn2, map[int]int{1: 12}), anomalytest.ErrTxnNotActive)
+	assert.Equal(t, map[int]int{1: 10}, db.State(), "a write after the txn ended changes nothing")
+}
+
+func TestSimpleDBReadUncommittedRollbackRestoresKeysAfterSetDeleteSet(t *testing.T) {
+	db := NewSimpleDBReadUncommitted()
+	setup, _ := db.BeginTx("READ_UNCOMMITTED")
+	db.Set(setup, 1, 10)
+	db.Commit(setup)
+
+	txn, _ := db.BeginTx("READ_UNCOMMITTED")
+	for _, key := range []int{1, 2} { // key 2 did not exist before txn
+		assert.NoError(t, db.Set(txn, key, 11))
+		assert.NoError(t, db.Delete(txn, key))
+		assert.NoError(t, db.Set(txn, key, 12))
+	}
+	assert.NoError(t, db.Rollback(txn))
+
+	assert.Equal(t, map[int]int{1: 10}, db.State())
+	keys, _ := db.GetByValue(setup, 12)
+	assert.Empty(t, keys, "the value index is rolled back too")
+}
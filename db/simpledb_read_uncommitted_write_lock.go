@@ -1,159 +1,928 @@
 package db
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"math"
+	"slices"
 	"sync"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
 )
 
+// ReadPolicy is how Get treats a key that another transaction has written but not yet committed
+type ReadPolicy int
+
+const (
+	ReadDirty           ReadPolicy = iota // return the uncommitted value without waiting (the default)
+	ReadLatestCommitted                   // return the value as of the last commit that wrote the key, without waiting
+	ReadBlocking                          // take a shared row lock, waiting for the writer to end, and hold it until commit
+)
+
+func (p ReadPolicy) String() string {
+	switch p {
+	case ReadLatestCommitted:
+		return "latest committed"
+	case ReadBlocking:
+		return "blocking"
+	default:
+		return "dirty"
+	}
+}
+
 type SimpleDBReadUncommittedWriteLock struct {
-	data       map[int]int
-	mu         sync.RWMutex
-	nextTxnId  int64
-	txnUndoOps map[int64][]func()
+	data        map[int]int
+	committed   map[int]int // data as of the last commit, without the writes of active txns
+	history     history     // values committed to each key, oldest first
+	index       valueIndex  // value -> keys, kept in step with data
+	mu          sync.RWMutex
+	nextTxnId   int64
+	txnUndoOps  map[int64][]func()
+	txnWrites   map[int64]map[int]bool // txnId -> keys it has written or deleted
+	readPolicy  ReadPolicy
+	txnPolicies map[int64]ReadPolicy   // txnId -> read policy it began with, in place of readPolicy
+	rangeScans  map[int64]bool         // txns whose Scans lock their whole range first; see lockScanRanges
+	savepoints  savepoints             // txnId -> savepoints it has set, oldest first
+	writeSets   map[int64]map[int]bool // txnId -> keys it declared with DeclareWriteSet
+	requireSets bool                   // whether writes outside a declared write set fail
+	foreignKeys map[int][]int          // parent key -> child keys that reference it
+	logger      anomalytest.Logger
 
 	// Row-level write locks (separate from mu)
-	rowLocksMu   sync.Mutex             // protects rowLocks and txnHeldLocks
-	rowLocks     map[int]*sync.Mutex    // key -> per-row mutex
-	txnHeldLocks map[int64]map[int]bool // txnId -> set of locked keys
+	locks LockManager
 }
 
+// NewSimpleDBReadUncommittedWriteLock creates the database with a BlockingLockManager that detects deadlocks
 func NewSimpleDBReadUncommittedWriteLock() *SimpleDBReadUncommittedWriteLock {
+	lm := NewBlockingLockManager()
+	lm.SetDeadlockDetection(true)
+	return NewSimpleDBReadUncommittedWriteLockWith(lm)
+}
+
+// NewSimpleDBReadUncommittedWriteLockWith creates the database with lm in place of the default
+// BlockingLockManager. Set and Delete take exclusive locks through it.
+func NewSimpleDBReadUncommittedWriteLockWith(lm LockManager) *SimpleDBReadUncommittedWriteLock {
 	return &SimpleDBReadUncommittedWriteLock{
-		data:         make(map[int]int),
-		mu:           sync.RWMutex{},
-		nextTxnId:    1,
-		txnUndoOps:   make(map[int64][]func()),
-		rowLocks:     make(map[int]*sync.Mutex),
-		txnHeldLocks: make(map[int64]map[int]bool),
+		data:        make(map[int]int),
+		committed:   make(map[int]int),
+		history:     make(history),
+		index:       make(valueIndex),
+		mu:          sync.RWMutex{},
+		nextTxnId:   1,
+		txnUndoOps:  make(map[int64][]func()),
+		txnWrites:   make(map[int64]map[int]bool),
+		txnPolicies: make(map[int64]ReadPolicy),
+		rangeScans:  make(map[int64]bool),
+		savepoints:  make(savepoints),
+		writeSets:   make(map[int64]map[int]bool),
+		foreignKeys: make(map[int][]int),
+		locks:       lm,
+		logger:      anomalytest.DefaultLogger(),
 	}
 }
 
+func (d *SimpleDBReadUncommittedWriteLock) Capabilities() anomalytest.Capability {
+	return anomalytest.CapLocking | anomalytest.CapSnapshot | anomalytest.CapIndex | anomalytest.CapForeignKey |
+		anomalytest.CapAggregate | anomalytest.CapIncrement | anomalytest.CapScan | anomalytest.CapSavepoint |
+		anomalytest.CapWriteSet | anomalytest.CapBatch
+}
+
 func (d *SimpleDBReadUncommittedWriteLock) BeginTx(isolationLevel string) (int64, error) {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	txId := d.nextTxnId
 	d.nextTxnId++
 	d.txnUndoOps[txId] = make([]func(), 0)
+	d.txnWrites[txId] = make(map[int]bool)
 	return txId, nil
 }
 
-// acquireRowLock acquires a row-level write lock, blocking if another txn holds it
-func (d *SimpleDBReadUncommittedWriteLock) acquireRowLock(txId int64, key int) {
-	d.rowLocksMu.Lock()
-	if d.txnHeldLocks[txId] != nil && d.txnHeldLocks[txId][key] {
-		d.rowLocksMu.Unlock()
-		return // Already hold this lock
+// beginWithPolicy begins a transaction whose reads follow policy, whatever SetReadPolicy is set to
+func (d *SimpleDBReadUncommittedWriteLock) beginWithPolicy(policy ReadPolicy) int64 {
+	txId, _ := d.BeginTx("")
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.txnPolicies[txId] = policy
+	return txId
+}
+
+// lockScanRanges marks txId as a transaction whose Scans must lock their whole range, for a database that
+// offers it per transaction, until txId ends
+func (d *SimpleDBReadUncommittedWriteLock) lockScanRanges(txId int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.rangeScans[txId] = true
+}
+
+// locksScanRanges reports whether txId was marked by lockScanRanges
+func (d *SimpleDBReadUncommittedWriteLock) locksScanRanges(txId int64) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.rangeScans[txId]
+}
+
+// SetReadPolicy sets how Get treats keys written by transactions that have not committed. It applies to
+// every read from then on, including those of transactions already running, and Sum, Scan, GetByValue
+// and Snapshot read the same way Get does.
+func (d *SimpleDBReadUncommittedWriteLock) SetReadPolicy(policy ReadPolicy) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.readPolicy = policy
+}
+
+// AddForeignKey declares that childKey may only exist while parentKey exists. It is checked at commit
+// against the committed data with the committing transaction's writes applied, whatever the read policy.
+func (d *SimpleDBReadUncommittedWriteLock) AddForeignKey(childKey, parentKey int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.foreignKeys[parentKey] = append(d.foreignKeys[parentKey], childKey)
+}
+
+// checkForeignKeys returns a ConstraintViolationError if committing txId would leave a key
+// without the key it references. Caller must hold mu.
+func (d *SimpleDBReadUncommittedWriteLock) checkForeignKeys(txId int64) error {
+	// after returns key's value once txId has committed
+	after := func(key int) (int, bool) {
+		if d.txnWrites[txId][key] {
+			value, ok := d.data[key]
+			return value, ok
+		}
+		value, ok := d.committed[key]
+		return value, ok
+	}
+	for parent, children := range d.foreignKeys {
+		for _, child := range children {
+			if !d.txnWrites[txId][parent] && !d.txnWrites[txId][child] {
+				continue
+			}
+			value, childExists := after(child)
+			if _, parentExists := after(parent); childExists && !parentExists {
+				return &anomalytest.ConstraintViolationError{
+					Constraint: "foreign key",
+					Keys:       []int{child, parent},
+					Detail:     fmt.Sprintf("txn %d would leave key %d = %d referencing missing key %d", txId, child, value, parent),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// acquireRowLock acquires a row-level write lock, blocking if another txn holds it.
+// It fails if the transaction ends while waiting, e.g. because it was rolled back after timing out.
+func (d *SimpleDBReadUncommittedWriteLock) acquireRowLock(txId int64, key int) error {
+	d.mu.RLock()
+	undeclared := d.requireSets && !d.writeSets[txId][key]
+	d.mu.RUnlock()
+	if undeclared {
+		return fmt.Errorf("txn %d locking key %d outside its declared write set: %w", txId, key, anomalytest.ErrLockNotHeld)
 	}
+	return d.lockRow(txId, key, LockExclusive)
+}
 
-	rowMu := d.rowLocks[key]
-	if rowMu == nil {
-		rowMu = &sync.Mutex{}
-		d.rowLocks[key] = rowMu
+// DeclareWriteSet takes the exclusive row locks on keys in ascending key order, so that transactions that
+// declare their writes up front never deadlock on each other's write locks. The locks are held until the
+// transaction ends, like any write lock. With SetRequireWriteSets on, the transaction can then only write
+// the keys it declared.
+func (d *SimpleDBReadUncommittedWriteLock) DeclareWriteSet(txId int64, keys []int) error {
+	d.mu.Lock()
+	if _, active := d.txnUndoOps[txId]; !active {
+		d.mu.Unlock()
+		return fmt.Errorf("txn %d declaring write set %v: %w", txId, keys, anomalytest.ErrTxnNotActive)
+	}
+	if d.writeSets[txId] == nil {
+		d.writeSets[txId] = make(map[int]bool)
 	}
-	d.rowLocksMu.Unlock()
+	for _, key := range keys {
+		d.writeSets[txId][key] = true
+	}
+	d.mu.Unlock()
 
-	rowMu.Lock() // May block here
+	for _, key := range slices.Compact(slices.Sorted(slices.Values(keys))) {
+		if err := d.lockRow(txId, key, LockExclusive); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetRequireWriteSets sets whether a transaction may only take write locks on keys it declared with
+// DeclareWriteSet. With it on, a write to any other key fails with ErrLockNotHeld instead of taking a lock
+// out of key order, so transactions that only write cannot deadlock. Reads that take shared locks under
+// ReadBlocking are not covered and can still deadlock.
+func (d *SimpleDBReadUncommittedWriteLock) SetRequireWriteSets(enabled bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.requireSets = enabled
+}
 
-	d.rowLocksMu.Lock()
-	if d.txnHeldLocks[txId] == nil {
-		d.txnHeldLocks[txId] = make(map[int]bool)
+// lockRow acquires a row lock in mode. If the lock manager reports a deadlock, the victim is rolled back
+// before the *anomalytest.DeadlockError is returned, so that the others in the cycle can go on. A transaction
+// that has ended fails without asking the lock manager, which forgets ended transactions and would grant it
+// a lock nothing releases. It can still end between that check and the grant, e.g. rolled back after its
+// operation timed out, so the check is repeated once the lock is granted.
+func (d *SimpleDBReadUncommittedWriteLock) lockRow(txId int64, key int, mode LockMode) error {
+	if !d.active(txId) {
+		return fmt.Errorf("txn %d locking key %d: %w", txId, key, anomalytest.ErrTxnNotActive)
+	}
+	if err := d.rollbackVictim(d.locks.Acquire(txId, key, mode)); err != nil {
+		return err
+	}
+	if !d.stillActive(txId) {
+		return fmt.Errorf("txn %d locking key %d: %w", txId, key, anomalytest.ErrTxnNotActive)
 	}
-	d.txnHeldLocks[txId][key] = true
-	d.rowLocksMu.Unlock()
+	return nil
+}
+
+// stillActive reports whether txId is still active after being granted a lock. If it is not, it ended while
+// the lock was being granted and its locks were released before the grant, so they are released again;
+// Commit and Rollback end a transaction before releasing its locks, so none is left behind.
+func (d *SimpleDBReadUncommittedWriteLock) stillActive(txId int64) bool {
+	if d.active(txId) {
+		return true
+	}
+	d.releaseRowLocks(txId)
+	return false
+}
+
+// active reports whether txId has begun and not yet committed or rolled back
+func (d *SimpleDBReadUncommittedWriteLock) active(txId int64) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	_, ok := d.txnUndoOps[txId]
+	return ok
+}
+
+// lockRange takes a shared lock on every key from lo to hi, including those that do not exist yet, so that no
+// other transaction can write one until txId ends. It fails with errors.ErrUnsupported if the lock manager is
+// not a RangeLocker. Deadlocks and transactions that end are handled as in lockRow.
+func (d *SimpleDBReadUncommittedWriteLock) lockRange(txId int64, lo, hi int) error {
+	locker, ok := d.locks.(RangeLocker)
+	if !ok {
+		return fmt.Errorf("txn %d locking keys %d to %d: %T cannot lock ranges: %w", txId, lo, hi, d.locks, errors.ErrUnsupported)
+	}
+	if !d.active(txId) {
+		return fmt.Errorf("txn %d locking keys %d to %d: %w", txId, lo, hi, anomalytest.ErrTxnNotActive)
+	}
+	if err := d.rollbackVictim(locker.AcquireRange(txId, lo, hi)); err != nil {
+		return err
+	}
+	if !d.stillActive(txId) {
+		return fmt.Errorf("txn %d locking keys %d to %d: %w", txId, lo, hi, anomalytest.ErrTxnNotActive)
+	}
+	return nil
 }
 
-// releaseRowLocks releases all row-level locks held by a transaction
+// rollbackVictim rolls back the victim if err is a *anomalytest.DeadlockError, and returns err
+func (d *SimpleDBReadUncommittedWriteLock) rollbackVictim(err error) error {
+	var deadlock *anomalytest.DeadlockError
+	if errors.As(err, &deadlock) {
+		d.Rollback(deadlock.Victim)
+	}
+	return err
+}
+
+// releaseRowLocks releases all row-level locks held by a transaction and marks it ended,
+// so that a lock it was still waiting for is never granted
 func (d *SimpleDBReadUncommittedWriteLock) releaseRowLocks(txId int64) {
-	d.rowLocksMu.Lock()
-	defer d.rowLocksMu.Unlock()
-	for key := range d.txnHeldLocks[txId] {
-		d.rowLocks[key].Unlock()
+	d.locks.ReleaseAll(txId)
+}
+
+// HoldsLock reports whether txId currently holds the row lock on key. It is always false if the lock
+// manager cannot report its lock table.
+func (d *SimpleDBReadUncommittedWriteLock) HoldsLock(txId int64, key int) bool {
+	holder, ok := d.locks.(interface {
+		HoldsLock(txId int64, key int) bool
+	})
+	return ok && holder.HoldsLock(txId, key)
+}
+
+// LockWaiters returns the transactions that are waiting for a row lock, mapped to the key they are waiting for
+func (d *SimpleDBReadUncommittedWriteLock) LockWaiters() map[int64]int {
+	if inspector, ok := d.locks.(anomalytest.LockWaitInspector); ok {
+		return inspector.LockWaiters()
+	}
+	return map[int64]int{}
+}
+
+// SetLockObserver sets the observer that is told when a Set, Delete or read under ReadBlocking starts waiting
+// for a row lock and when it is granted. It has no effect if the lock manager does not implement
+// anomalytest.LockObservable.
+func (d *SimpleDBReadUncommittedWriteLock) SetLockObserver(observer anomalytest.LockObserver) {
+	if observable, ok := d.locks.(anomalytest.LockObservable); ok {
+		observable.SetLockObserver(observer)
+	}
+}
+
+// LockWaitCount returns how many times txId had to wait for a row lock held by another transaction
+func (d *SimpleDBReadUncommittedWriteLock) LockWaitCount(txId int64) int {
+	if counter, ok := d.locks.(anomalytest.LockWaitCounter); ok {
+		return counter.LockWaitCount(txId)
+	}
+	return 0
+}
+
+// LockStats returns how many row locks were granted, how many requests had to wait and for how long in
+// total, since the database was created or last reset. It reports nothing if the lock manager does not keep
+// these totals.
+func (d *SimpleDBReadUncommittedWriteLock) LockStats() LockStats {
+	if reporter, ok := d.locks.(interface{ LockStats() LockStats }); ok {
+		return reporter.LockStats()
+	}
+	return LockStats{}
+}
+
+// LastLockTiming returns when txId's most recent lock request that was granted was made and granted
+func (d *SimpleDBReadUncommittedWriteLock) LastLockTiming(txId int64) (anomalytest.LockTiming, bool) {
+	if timer, ok := d.locks.(anomalytest.LockTimer); ok {
+		return timer.LastLockTiming(txId)
+	}
+	return anomalytest.LockTiming{}, false
+}
+
+// UnblockedBy returns the transactions that were granted a row lock they waited for once txId committed or
+// rolled back, as described for BlockingLockManager.UnblockedBy
+func (d *SimpleDBReadUncommittedWriteLock) UnblockedBy(txId int64) []int64 {
+	if inspector, ok := d.locks.(anomalytest.UnblockInspector); ok {
+		return inspector.UnblockedBy(txId)
+	}
+	return nil
+}
+
+// WaitChain returns the current chains of transactions waiting for each other's row locks, as described
+// for BlockingLockManager.WaitChain, or nil if the lock manager cannot report them
+func (d *SimpleDBReadUncommittedWriteLock) WaitChain() [][]int64 {
+	if chainer, ok := d.locks.(interface{ WaitChain() [][]int64 }); ok {
+		return chainer.WaitChain()
+	}
+	return nil
+}
+
+// SetFIFOLocks turns FIFO granting of row locks on or off, as described for BlockingLockManager.SetFIFOLocks.
+// It has no effect if the lock manager has no FIFO mode.
+func (d *SimpleDBReadUncommittedWriteLock) SetFIFOLocks(enabled bool) {
+	if queuer, ok := d.locks.(interface{ SetFIFOLocks(enabled bool) }); ok {
+		queuer.SetFIFOLocks(enabled)
+	}
+}
+
+// SetDeadlockDetection turns deadlock detection on or off, as described for
+// BlockingLockManager.SetDeadlockDetection. It has no effect if the lock manager cannot detect deadlocks.
+func (d *SimpleDBReadUncommittedWriteLock) SetDeadlockDetection(enabled bool) {
+	if detector, ok := d.locks.(interface{ SetDeadlockDetection(enabled bool) }); ok {
+		detector.SetDeadlockDetection(enabled)
 	}
-	delete(d.txnHeldLocks, txId)
+}
+
+// GrantOrder returns the transactions that were granted the row lock on key, in the order they were granted
+// it, or nil if the lock manager does not record it
+func (d *SimpleDBReadUncommittedWriteLock) GrantOrder(key int) []int64 {
+	if recorder, ok := d.locks.(interface{ GrantOrder(key int) []int64 }); ok {
+		return recorder.GrantOrder(key)
+	}
+	return nil
+}
+
+// lockRecorder is implemented by lock managers that keep a lock event log
+type lockRecorder interface {
+	SetLockRecording(enabled bool)
+	LockEvents() []LockEvent
+}
+
+// SetLockRecording turns the lock event log on or off. Events recorded so far are kept.
+// It has no effect if the lock manager keeps no event log.
+func (d *SimpleDBReadUncommittedWriteLock) SetLockRecording(enabled bool) {
+	if recorder, ok := d.locks.(lockRecorder); ok {
+		recorder.SetLockRecording(enabled)
+	}
+}
+
+// LockEvents returns every recorded lock acquisition and release, in the order they happened
+func (d *SimpleDBReadUncommittedWriteLock) LockEvents() []LockEvent {
+	if recorder, ok := d.locks.(lockRecorder); ok {
+		return recorder.LockEvents()
+	}
+	return nil
+}
+
+// LockOrder returns the keys a transaction acquired locks on, in acquisition order
+func (d *SimpleDBReadUncommittedWriteLock) LockOrder(txId int64) []int {
+	var keys []int
+	for _, event := range d.LockEvents() {
+		if event.TxId == txId && event.Kind == LockAcquired {
+			keys = append(keys, event.Key)
+		}
+	}
+	return keys
 }
 
 func (d *SimpleDBReadUncommittedWriteLock) Set(txId int64, key int, value int) error {
 	// Acquire row lock BEFORE d.mu to avoid deadlock:
 	// If we held d.mu while blocking on a row lock, other txns couldn't commit
 	// (commit needs d.mu), so the row lock would never be released.
-	d.acquireRowLock(txId, key)
+	if err := d.acquireRowLock(txId, key); err != nil {
+		return err
+	}
+	return d.write(txId, key, value)
+}
+
+// Increment adds delta to key under its row lock. Holding the lock across the read and the write means no
+// other transaction can write key in between, so concurrent increments are never lost.
+func (d *SimpleDBReadUncommittedWriteLock) Increment(txId int64, key int, delta int) error {
+	if err := d.acquireRowLock(txId, key); err != nil {
+		return err
+	}
+	d.mu.RLock()
+	value := d.data[key]
+	d.mu.RUnlock()
+	return d.write(txId, key, value+delta)
+}
+
+// AcquireLock takes the row lock on key without writing, blocking while another transaction holds it.
+// Together with WriteLocked it splits Set into two steps that can be scheduled separately.
+func (d *SimpleDBReadUncommittedWriteLock) AcquireLock(txId int64, key int) error {
+	return d.acquireRowLock(txId, key)
+}
+
+// WriteLocked writes value to key under a row lock the transaction already holds, and never blocks
+func (d *SimpleDBReadUncommittedWriteLock) WriteLocked(txId int64, key int, value int) error {
+	if !d.HoldsLock(txId, key) {
+		return fmt.Errorf("txn %d writing key %d: %w", txId, key, anomalytest.ErrLockNotHeld)
+	}
+	return d.write(txId, key, value)
+}
+
+// write applies a write and records how to undo it. The caller must hold the row lock on key.
+// It fails if the transaction has ended since the lock was taken.
+func (d *SimpleDBReadUncommittedWriteLock) write(txId int64, key int, value int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, active := d.txnUndoOps[txId]; !active {
+		return fmt.Errorf("txn %d writing key %d: %w", txId, key, anomalytest.ErrTxnNotActive)
+	}
+	d.applyWrite(txId, key, value)
+	return nil
+}
 
+// SetMany takes the row locks on every key in kv, in ascending key order so that concurrent SetMany calls
+// cannot deadlock on each other, then applies all the writes under one hold of mu. If a lock cannot be
+// taken nothing is written, though the locks already taken are held until the transaction ends.
+func (d *SimpleDBReadUncommittedWriteLock) SetMany(txId int64, kv map[int]int) error {
+	keys := slices.Sorted(maps.Keys(kv))
+	for _, key := range keys {
+		if err := d.acquireRowLock(txId, key); err != nil {
+			return err
+		}
+	}
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	if _, active := d.txnUndoOps[txId]; !active {
+		return fmt.Errorf("txn %d writing keys %v: %w", txId, keys, anomalytest.ErrTxnNotActive)
+	}
+	for _, key := range keys {
+		d.applyWrite(txId, key, kv[key])
+	}
+	return nil
+}
+
+// applyWrite writes value to key and records how to undo it. Caller must hold mu and the row lock on key.
+func (d *SimpleDBReadUncommittedWriteLock) applyWrite(txId int64, key int, value int) {
 	oldValue, ok := d.data[key]
 	if ok {
 		d.txnUndoOps[txId] = append(d.txnUndoOps[txId], func() {
-			d.data[key] = oldValue
+			d.put(key, oldValue)
 		})
 	} else {
 		d.txnUndoOps[txId] = append(d.txnUndoOps[txId], func() {
-			delete(d.data, key)
+			d.remove(key)
 		})
 	}
+	d.txnWrites[txId][key] = true
+	d.put(key, value)
+}
+
+// put writes value to key and keeps the value index in step. Caller must hold mu.
+func (d *SimpleDBReadUncommittedWriteLock) put(key int, value int) {
+	if oldValue, ok := d.data[key]; ok {
+		d.index.remove(oldValue, key)
+	}
 	d.data[key] = value
-	return nil
+	d.index.add(value, key)
+}
+
+// remove deletes key and keeps the value index in step. Caller must hold mu.
+func (d *SimpleDBReadUncommittedWriteLock) remove(key int) {
+	if oldValue, ok := d.data[key]; ok {
+		d.index.remove(oldValue, key)
+	}
+	delete(d.data, key)
 }
 
 func (d *SimpleDBReadUncommittedWriteLock) Get(txId int64, key int) (int, error) {
+	policy, err := d.lockForRead(txId, key)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if _, active := d.txnUndoOps[txId]; !active {
+		return 0, fmt.Errorf("txn %d reading key %d: %w", txId, key, anomalytest.ErrTxnNotActive)
+	}
+	return d.read(txId, key, policy), nil
+}
+
+// Sum returns the total of keys as Get would read them, all under one hold of mu so that no write lands
+// partway through. Under ReadBlocking it first takes a shared lock on every key.
+func (d *SimpleDBReadUncommittedWriteLock) Sum(txId int64, keys []int) (int, error) {
+	sorted := slices.Clone(keys)
+	slices.Sort(sorted) // lock in key order, so two sums cannot wait for each other
+	policy := ReadDirty
+	for _, key := range slices.Compact(sorted) {
+		var err error
+		if policy, err = d.lockForRead(txId, key); err != nil {
+			return 0, err
+		}
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	total := 0
+	for _, key := range keys {
+		total += d.read(txId, key, policy)
+	}
+	return total, nil
+}
+
+// Scan returns every key from lo to hi with its value, as Get would read it. Under ReadBlocking it first takes
+// a shared lock on each key in the range that exists when the scan starts; a key inserted into the range
+// afterwards is not locked, so a later scan can see it appear.
+func (d *SimpleDBReadUncommittedWriteLock) Scan(txId int64, lo, hi int) (map[int]int, error) {
+	inRange := func(key int) bool { return lo <= key && key <= hi }
+	policy := d.policyOf(txId)
+	if policy == ReadBlocking {
+		d.mu.RLock()
+		var keys []int
+		for key := range d.data {
+			if inRange(key) {
+				keys = append(keys, key)
+			}
+		}
+		d.mu.RUnlock()
+		slices.Sort(keys) // lock in key order, like Sum
+		for _, key := range keys {
+			if err := d.lockRow(txId, key, LockShared); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	rows := make(map[int]int)
+	if policy == ReadLatestCommitted {
+		for key, value := range d.committed {
+			if inRange(key) && !d.txnWrites[txId][key] {
+				rows[key] = value
+			}
+		}
+		for key := range d.txnWrites[txId] {
+			if value, ok := d.data[key]; ok && inRange(key) {
+				rows[key] = value
+			}
+		}
+		return rows, nil
+	}
+	for key, value := range d.data {
+		if inRange(key) {
+			rows[key] = value
+		}
+	}
+	return rows, nil
+}
+
+// policyOf returns the read policy txId's reads follow
+func (d *SimpleDBReadUncommittedWriteLock) policyOf(txId int64) ReadPolicy {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
-	return d.data[key], nil
+	if policy, ok := d.txnPolicies[txId]; ok {
+		return policy
+	}
+	return d.readPolicy
+}
+
+// lockForRead returns txId's read policy and, under ReadBlocking, takes a shared row lock on key. It is called
+// BEFORE d.mu, like acquireRowLock.
+func (d *SimpleDBReadUncommittedWriteLock) lockForRead(txId int64, key int) (ReadPolicy, error) {
+	policy := d.policyOf(txId)
+	if policy == ReadBlocking {
+		if err := d.lockRow(txId, key, LockShared); err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
+
+// read returns the value of key visible to txId under policy. Caller must hold mu.
+func (d *SimpleDBReadUncommittedWriteLock) read(txId int64, key int, policy ReadPolicy) int {
+	if policy == ReadLatestCommitted && !d.txnWrites[txId][key] {
+		return d.committed[key]
+	}
+	return d.data[key]
+}
+
+// GetByValue returns the keys whose value, as Get would read it, is value, in ascending order. Under
+// ReadBlocking it first takes a shared lock on every key that has value either committed or uncommitted, so
+// the answer cannot include a write another transaction may still roll back, nor miss a key it is changing.
+func (d *SimpleDBReadUncommittedWriteLock) GetByValue(txId int64, value int) ([]int, error) {
+	policy := d.policyOf(txId)
+	if policy == ReadBlocking {
+		return d.getByValueLocked(txId, value)
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if policy != ReadLatestCommitted {
+		return d.index.keys(value), nil
+	}
+	var keys []int
+	for key, committed := range d.committed {
+		if committed == value && !d.txnWrites[txId][key] {
+			keys = append(keys, key)
+		}
+	}
+	for key := range d.txnWrites[txId] {
+		if current, ok := d.data[key]; ok && current == value {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys, nil
+}
+
+// getByValueLocked is GetByValue under ReadBlocking. A key can take value while it waits for a lock, so it
+// locks in rounds until every key with value is locked.
+func (d *SimpleDBReadUncommittedWriteLock) getByValueLocked(txId int64, value int) ([]int, error) {
+	locked := make(map[int]bool)
+	for {
+		d.mu.RLock()
+		var missing []int
+		for _, key := range d.index.keys(value) {
+			if !locked[key] {
+				missing = append(missing, key)
+			}
+		}
+		for key, committed := range d.committed {
+			if current, ok := d.data[key]; committed == value && !locked[key] && (!ok || current != value) {
+				missing = append(missing, key) // changed away from value by a write that may be rolled back
+			}
+		}
+		if len(missing) == 0 {
+			keys := d.index.keys(value)
+			d.mu.RUnlock()
+			return keys, nil
+		}
+		d.mu.RUnlock()
+
+		slices.Sort(missing) // lock in key order, like Sum
+		for _, key := range missing {
+			if err := d.lockRow(txId, key, LockShared); err != nil {
+				return nil, err
+			}
+			locked[key] = true
+		}
+	}
 }
 
 func (d *SimpleDBReadUncommittedWriteLock) Delete(txId int64, key int) error {
 	// Acquire row lock BEFORE d.mu to avoid deadlock (see Set for explanation)
-	d.acquireRowLock(txId, key)
+	if err := d.acquireRowLock(txId, key); err != nil {
+		return err
+	}
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
+	if _, active := d.txnUndoOps[txId]; !active {
+		return fmt.Errorf("txn %d deleting key %d: %w", txId, key, anomalytest.ErrTxnNotActive)
+	}
 	oldValue, ok := d.data[key]
 	if ok {
 		d.txnUndoOps[txId] = append(d.txnUndoOps[txId], func() {
-			d.data[key] = oldValue
+			d.put(key, oldValue)
 		})
 	}
-	delete(d.data, key)
+	d.txnWrites[txId][key] = true
+	d.remove(key)
 	return nil
 }
 
 func (d *SimpleDBReadUncommittedWriteLock) Commit(txId int64) error {
-	// Release row locks BEFORE d.mu to allow blocked txns to proceed
-	// before we hold d.mu (maintains consistent lock ordering with Set/Delete)
-	d.releaseRowLocks(txId)
-
+	// Publish the writes to the committed data while the row locks still keep other txns from
+	// overwriting them, then release the locks outside d.mu (consistent lock ordering with Set/Delete)
 	d.mu.Lock()
-	defer d.mu.Unlock()
+	if err := d.checkForeignKeys(txId); err != nil {
+		d.undo(txId)
+		d.mu.Unlock()
+		d.releaseRowLocks(txId)
+		return err
+	}
+	for _, key := range slices.Sorted(maps.Keys(d.txnWrites[txId])) {
+		if value, ok := d.data[key]; ok {
+			d.committed[key] = value
+			d.history.add(key, value)
+		} else {
+			delete(d.committed, key)
+		}
+	}
 	delete(d.txnUndoOps, txId)
+	delete(d.txnWrites, txId)
+	delete(d.txnPolicies, txId)
+	delete(d.rangeScans, txId)
+	delete(d.savepoints, txId)
+	delete(d.writeSets, txId)
+	d.mu.Unlock()
+
+	d.releaseRowLocks(txId)
 	return nil
 }
 
 func (d *SimpleDBReadUncommittedWriteLock) Rollback(txId int64) error {
-	// Release row locks BEFORE d.mu (see Commit for explanation)
+	// Undo the writes while the row locks still keep other txns from reading or overwriting them, then
+	// release the locks outside d.mu, as Commit does
+	d.mu.Lock()
+	d.undo(txId)
+	d.mu.Unlock()
+
 	d.releaseRowLocks(txId)
+	return nil
+}
 
-	d.mu.Lock()
-	defer d.mu.Unlock()
+// undo reverts txId's writes and forgets the transaction. Caller must hold mu.
+func (d *SimpleDBReadUncommittedWriteLock) undo(txId int64) {
 	for i := len(d.txnUndoOps[txId]) - 1; i >= 0; i-- {
 		d.txnUndoOps[txId][i]()
 	}
 	delete(d.txnUndoOps, txId)
+	delete(d.txnWrites, txId)
+	delete(d.txnPolicies, txId)
+	delete(d.rangeScans, txId)
+	delete(d.savepoints, txId)
+	delete(d.writeSets, txId)
+}
+
+// Savepoint marks txId's current point under name so that RollbackTo can return to it
+func (d *SimpleDBReadUncommittedWriteLock) Savepoint(txId int64, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	undoOps, active := d.txnUndoOps[txId]
+	if !active {
+		return fmt.Errorf("txn %d setting savepoint %s: %w", txId, name, anomalytest.ErrTxnNotActive)
+	}
+	d.savepoints.set(txId, savepoint{name: name, undoOps: len(undoOps), writes: maps.Clone(d.txnWrites[txId])})
 	return nil
 }
 
-func (d *SimpleDBReadUncommittedWriteLock) PrintState() {
+// RollbackTo undoes txId's writes since the savepoint called name, in reverse order, and keeps the
+// transaction active. The row locks taken since the savepoint are kept until the transaction ends, as
+// strict two-phase locking requires.
+func (d *SimpleDBReadUncommittedWriteLock) RollbackTo(txId int64, name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	undoOps, active := d.txnUndoOps[txId]
+	if !active {
+		return fmt.Errorf("txn %d rolling back to savepoint %s: %w", txId, name, anomalytest.ErrTxnNotActive)
+	}
+	sp, ok := d.savepoints.rollbackTo(txId, name)
+	if !ok {
+		return fmt.Errorf("txn %d rolling back to savepoint %s: %w", txId, name, anomalytest.ErrNoSavepoint)
+	}
+	for i := len(undoOps) - 1; i >= sp.undoOps; i-- {
+		undoOps[i]()
+	}
+	d.txnUndoOps[txId] = undoOps[:sp.undoOps]
+	d.txnWrites[txId] = maps.Clone(sp.writes)
+	return nil
+}
+
+// Snapshot returns every key with its value as Get would read it. Under ReadBlocking it takes a shared lock
+// on every key first, as Scan does over its range.
+func (d *SimpleDBReadUncommittedWriteLock) Snapshot(txId int64) (map[int]int, error) {
+	return d.Scan(txId, math.MinInt, math.MaxInt)
+}
+
+// State returns a copy of all data, including writes of transactions that have not committed yet
+func (d *SimpleDBReadUncommittedWriteLock) State() map[int]int {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
-	fmt.Println("--------------------------------")
-	fmt.Println("Database State:")
+	state := make(map[int]int, len(d.data))
 	for key, value := range d.data {
-		fmt.Printf("  %d: %d\n", key, value)
+		state[key] = value
 	}
+	return state
+}
 
-	fmt.Println("Txn Undo Ops:")
+// History returns the values committed to key, oldest first. A transaction that wrote key several times
+// adds only its last write when it commits, and one that deleted key adds nothing.
+func (d *SimpleDBReadUncommittedWriteLock) History(key int) []int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.history.of(key)
+}
+
+// ActiveTxns returns the transactions that have begun but not yet committed or rolled back
+func (d *SimpleDBReadUncommittedWriteLock) ActiveTxns() []int64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	txns := make([]int64, 0, len(d.txnUndoOps))
+	for txId := range d.txnUndoOps {
+		txns = append(txns, txId)
+	}
+	return txns
+}
+
+// ModifiedBy returns the active transaction that wrote or deleted key, if its value is uncommitted.
+// The row lock ensures at most one active transaction has written any key.
+func (d *SimpleDBReadUncommittedWriteLock) ModifiedBy(key int) (int64, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for txId, keys := range d.txnWrites {
+		if keys[key] {
+			return txId, true
+		}
+	}
+	return 0, false
+}
+
+// DumpState serializes the committed data so that LoadState can restore it. Writes are applied in place
+// at read uncommitted, so it fails while any transaction is active rather than capture uncommitted data.
+func (d *SimpleDBReadUncommittedWriteLock) DumpState() ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if len(d.txnUndoOps) > 0 {
+		return nil, fmt.Errorf("dumping state with %d active txns", len(d.txnUndoOps))
+	}
+	return encodeState(d.data)
+}
+
+// LoadState replaces all data with a dump made by DumpState. It fails while any transaction is active.
+func (d *SimpleDBReadUncommittedWriteLock) LoadState(dump []byte) error {
+	data, index, err := decodeState(dump)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.txnUndoOps) > 0 {
+		return fmt.Errorf("loading state with %d active txns", len(d.txnUndoOps))
+	}
+	d.data = data
+	d.committed = make(map[int]int, len(data))
+	for key, value := range data {
+		d.committed[key] = value
+	}
+	d.index = index
+	return nil
+}
+
+// Reset discards all data and transactions and restarts transaction ids at 1. The read policy and
+// foreign keys are kept. The lock manager is reset too
+// if it implements anomalytest.Resetter, as the default one does: its lock bookkeeping and event log are
+// cleared, and a transaction still blocked on a row lock from before the reset fails with ErrTxnNotActive
+// instead of registering the lock under an id that may have been reused.
+func (d *SimpleDBReadUncommittedWriteLock) Reset() {
+	if resetter, ok := d.locks.(anomalytest.Resetter); ok {
+		resetter.Reset()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.data = make(map[int]int)
+	d.committed = make(map[int]int)
+	d.history = make(history)
+	d.index = make(valueIndex)
+	d.nextTxnId = 1
+	d.txnUndoOps = make(map[int64][]func())
+	d.txnWrites = make(map[int64]map[int]bool)
+	d.txnPolicies = make(map[int64]ReadPolicy)
+	d.rangeScans = make(map[int64]bool)
+	d.savepoints = make(savepoints)
+	d.writeSets = make(map[int64]map[int]bool)
+}
+
+// SetLogger sets the logger that PrintState writes to
+func (d *SimpleDBReadUncommittedWriteLock) SetLogger(logger anomalytest.Logger) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logger = logger
+}
+
+func (d *SimpleDBReadUncommittedWriteLock) PrintState() {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	undoOps := make(map[int64]int, len(d.txnUndoOps))
 	for txId, ops := range d.txnUndoOps {
-		fmt.Printf("  Txn %d: %v\n", txId, ops)
+		undoOps[txId] = len(ops)
 	}
-	fmt.Println("Next Txn ID:")
-	fmt.Printf("  %d\n", d.nextTxnId)
-	fmt.Println("--------------------------------")
+	d.logger.Info("database state", "data", d.data, "undo_ops", undoOps, "next_txn_id", d.nextTxnId)
 }
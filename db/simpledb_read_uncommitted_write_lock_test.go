@@ -1,9 +1,25 @@
 package db
 
 import (
+	"context"
+	"fmt"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ anomalytest.LockingDatabase   = (*SimpleDBReadUncommittedWriteLock)(nil)
+	_ anomalytest.StateDumper       = (*SimpleDBReadUncommittedWriteLock)(nil)
+	_ anomalytest.LockTimer         = (*SimpleDBReadUncommittedWriteLock)(nil)
+	_ anomalytest.WriterInspector   = (*SimpleDBReadUncommittedWriteLock)(nil)
+	_ anomalytest.IncrementDatabase = (*SimpleDBReadUncommittedWriteLock)(nil)
+	_ anomalytest.SavepointDatabase = (*SimpleDBReadUncommittedWriteLock)(nil)
+	_ anomalytest.WriteSetDeclarer  = (*SimpleDBReadUncommittedWriteLock)(nil)
+	_ anomalytest.Historian         = (*SimpleDBReadUncommittedWriteLock)(nil)
 )
 
 func TestSimpleDBReadUncommittedWriteLockDirtyReadAbort(t *testing.T) {
@@ -25,3 +41,1085 @@ func TestSimpleDBReadUncommittedWriteLockDirtyWrite(t *testing.T) {
 	db := NewSimpleDBReadUncommittedWriteLock()
 	anomalytest.TestDirtyWrite(t, db)
 }
+
+func TestSimpleDBReadUncommittedWriteLockDirtyWriteG0(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	anomalytest.TestDirtyWrite_G0(t, db)
+}
+
+func TestSimpleDBReadUncommittedWriteLockLostUpdateAtomicIncrement(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	anomalytest.TestLostUpdateAtomicIncrement(t, db)
+}
+
+func TestSimpleDBReadUncommittedWriteLockLostUpdateCompareAndSwap(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	anomalytest.TestLostUpdateCompareAndSwap(t, db)
+}
+
+func TestSimpleDBReadUncommittedWriteLockLockOrder(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.SetLockRecording(true)
+
+	txn1, _ := db.BeginTx("READ_UNCOMMITTED")
+	txn2, _ := db.BeginTx("READ_UNCOMMITTED")
+	db.Set(txn1, 2, 200)
+	db.Set(txn1, 1, 100)
+	db.Set(txn1, 2, 201) // already held, must not be recorded twice
+	db.Commit(txn1)
+	db.Delete(txn2, 3)
+	db.Rollback(txn2)
+
+	assert.Equal(t, []int{2, 1}, db.LockOrder(txn1))
+	assert.Equal(t, []int{3}, db.LockOrder(txn2))
+
+	events := db.LockEvents()
+	assert.Equal(t, []LockEvent{
+		{Seq: 1, TxId: txn1, Key: 2, Kind: LockAcquired},
+		{Seq: 2, TxId: txn1, Key: 1, Kind: LockAcquired},
+		{Seq: 3, TxId: txn1, Key: 1, Kind: LockReleased},
+		{Seq: 4, TxId: txn1, Key: 2, Kind: LockReleased},
+		{Seq: 5, TxId: txn2, Key: 3, Kind: LockAcquired},
+		{Seq: 6, TxId: txn2, Key: 3, Kind: LockReleased},
+	}, events)
+	assert.NoError(t, CheckTwoPhaseLocking(events))
+}
+
+func TestCheckTwoPhaseLockingDetectsViolation(t *testing.T) {
+	events := []LockEvent{
+		{Seq: 1, TxId: 1, Key: 1, Kind: LockAcquired},
+		{Seq: 2, TxId: 2, Key: 2, Kind: LockAcquired},
+		{Seq: 3, TxId: 1, Key: 1, Kind: LockReleased},
+		{Seq: 4, TxId: 2, Key: 1, Kind: LockAcquired},
+		{Seq: 5, TxId: 1, Key: 3, Kind: LockAcquired}, // txn 1 grows after shrinking
+	}
+	err := CheckTwoPhaseLocking(events)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "txn 1 acquired lock on key 3")
+}
+
+func TestSimpleDBReadUncommittedWriteLockAssertHoldsLock(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.AssertHoldsLock(1)
+	txn1.AssertHoldsLock(2) // never written, so never locked
+	txn1.Commit()
+	txn1.AssertHoldsLock(1) // released by the commit
+
+	results := exec.Execute(true)
+
+	assert.Equal(t, []anomalytest.AssertionFailure{
+		{TxnName: "txn1", OpIndex: 3, Description: "expected txn txn1 to hold the lock on key 2"},
+		{TxnName: "txn1", OpIndex: 5, Description: "expected txn txn1 to hold the lock on key 1"},
+	}, results.AssertionFailures())
+}
+
+func TestSimpleDBReadUncommittedWriteLockSplitSet(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.AcquireLock(1)
+	txn1.AssertHoldsLock(1)
+	txn1.Barrier("txn1_locked")
+	// txn2 tries to write key 1 now, and blocks on the lock before writing anything
+	txn1.WaitForWithTimeout("txn2_wrote", 100*time.Millisecond)
+	read := txn1.Get(1)
+	txn1.WriteLocked(1, 100)
+	txn1.WriteLocked(2, 200) // never locked
+	txn1.Commit()
+	txn1.Barrier("txn1_committed")
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.BeginTx()
+	txn2.WaitFor("txn1_locked")
+	txn2.Set(1, 300)
+	txn2.Barrier("txn2_wrote")
+	txn2.Commit()
+	txn2.Barrier("txn2_committed")
+
+	check := exec.NewTxn("check")
+	check.WaitFor("txn1_committed")
+	check.WaitFor("txn2_committed")
+	check.BeginTx()
+	final1 := check.Get(1)
+	final2 := check.Get(2)
+	check.Commit()
+
+	results := exec.Execute(true)
+
+	assert.Equal(t, 0, results.GetValue(read), "txn2 should not write between txn1's lock and write")
+	assert.Equal(t, 300, results.GetValue(final1), "txn2's write should land after txn1 commits")
+	assert.Equal(t, 0, results.GetValue(final2))
+	assert.Empty(t, results.AssertionFailures())
+	opErrs := results.Errors()
+	assert.Len(t, opErrs, 1)
+	assert.Equal(t, 7, opErrs[0].OpIndex)
+	assert.ErrorIs(t, opErrs[0], anomalytest.ErrLockNotHeld)
+}
+
+func TestSimpleDBReadUncommittedWriteLockTxnTimeoutReleasesLocks(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Barrier("txn1_wrote")
+	txn1.WaitFor("txn2_done")
+	txn1.Commit()
+	txn1.Barrier("txn1_committed")
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.SetTimeout(50 * time.Millisecond)
+	txn2.BeginTx()
+	txn2.Set(2, 200)
+	txn2.WaitFor("txn1_wrote")
+	txn2.Set(1, 300) // blocks on txn1's lock until the timeout
+	txn2.Commit()
+	txn2.Barrier("txn2_done")
+
+	check := exec.NewTxn("check")
+	check.SetTimeout(time.Second) // time out instead of hanging if a lock leaked
+	check.WaitFor("txn1_committed")
+	check.BeginTx()
+	check.Set(1, 400)
+	check.Set(2, 500)
+	check.Commit()
+
+	results := exec.Execute(true)
+
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("txn1"))
+	assert.Equal(t, anomalytest.OutcomeTimedOut, results.Outcome("txn2"))
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("check"), "txn2's locks should have been released")
+	opErrs := results.Errors()
+	assert.Len(t, opErrs, 1)
+	assert.ErrorIs(t, opErrs[0], anomalytest.ErrTimeout)
+	assert.ErrorIs(t, opErrs[0], anomalytest.ErrAborted)
+}
+
+func TestSimpleDBReadUncommittedWriteLockWaitQuiescentReportsWaiters(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	holder, _ := db.BeginTx("READ_UNCOMMITTED")
+	waiter, _ := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, db.Set(holder, 1, 100))
+	go db.Set(waiter, 1, 200)
+
+	err := exec.WaitQuiescent(db, 20*time.Millisecond)
+	assert.ErrorContains(t, err, "active txns [1 2]")
+	assert.ErrorContains(t, err, "lock waiters [txn 2 on key 1]")
+
+	assert.NoError(t, db.Commit(holder))
+	assert.Eventually(t, func() bool { return db.HoldsLock(waiter, 1) }, time.Second, time.Millisecond)
+	assert.NoError(t, db.Commit(waiter))
+	assert.NoError(t, exec.WaitQuiescent(db, 20*time.Millisecond))
+}
+
+func TestSimpleDBReadUncommittedWriteLockReadsDoNotBlock(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Barrier("txn1_wrote")
+	txn1.WaitFor("txn2_read")
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_wrote")
+	txn2.BeginTx()
+	read := txn2.Get(1)
+	txn2.Barrier("txn2_read")
+	txn2.Commit()
+
+	results := exec.Execute(false)
+
+	// Reads take no locks at read uncommitted, so txn2 sees the dirty value instead of waiting for txn1
+	assert.Equal(t, 100, results.GetValue(read))
+	assert.False(t, results.DidBlock(read))
+}
+
+func TestSimpleDBReadUncommittedWriteLockCancelRollsBackInFlightTxns(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Barrier("txn1_locked")
+	txn1.WaitFor("txn2_wrote") // never signaled: txn2 is blocked on txn1's lock
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_locked")
+	txn2.BeginTx()
+	txn2.Set(2, 200)
+	txn2.Set(1, 300)
+	txn2.Barrier("txn2_wrote")
+	txn2.Commit()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	results := exec.ExecuteContext(ctx, false)
+
+	assert.Equal(t, anomalytest.OutcomeAborted, results.Outcome("txn1"))
+	assert.Equal(t, anomalytest.OutcomeAborted, results.Outcome("txn2"))
+	assert.Empty(t, db.State(), "both transactions' writes should be undone")
+	assert.NoError(t, exec.WaitQuiescent(db, time.Second), "no locks should be left held or awaited")
+	for key := 1; key <= 2; key++ {
+		assert.False(t, db.HoldsLock(1, key))
+		assert.False(t, db.HoldsLock(2, key))
+	}
+}
+
+func TestDeleteMissingKeyReleasesLock(t *testing.T) {
+	for _, end := range []string{"commit", "rollback"} {
+		t.Run(end, func(t *testing.T) {
+			db := NewSimpleDBReadUncommittedWriteLock()
+			tx1, _ := db.BeginTx("")
+			assert.NoError(t, db.Delete(tx1, 1))
+			assert.True(t, db.HoldsLock(tx1, 1), "deleting a missing key should still lock it")
+			if end == "commit" {
+				assert.NoError(t, db.Commit(tx1))
+			} else {
+				assert.NoError(t, db.Rollback(tx1))
+			}
+			assert.False(t, db.HoldsLock(tx1, 1))
+
+			tx2, _ := db.BeginTx("")
+			locked := make(chan error, 1)
+			go func() {
+				locked <- db.AcquireLock(tx2, 1)
+			}()
+			select {
+			case err := <-locked:
+				assert.NoError(t, err)
+			case <-time.After(time.Second):
+				t.Fatal("lock on the deleted key was never released")
+			}
+			assert.Equal(t, 0, db.LockWaitCount(tx2), "the lock should be free immediately")
+			_, exists := db.State()[1]
+			assert.False(t, exists)
+		})
+	}
+}
+
+func TestSimpleDBReadUncommittedWriteLockResetRestartsTxnIds(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Barrier("txn1_wrote")
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_wrote")
+	txn2.BeginTx()
+	txn2.Set(1, 200)
+	txn2.Rollback()
+
+	for run := 1; run <= 2; run++ {
+		if run > 1 {
+			exec.Reset()
+			assert.Empty(t, db.State(), "reset should discard the previous run's data")
+		}
+		results := exec.Execute(false)
+		assert.Equal(t, int64(1), results.TxnId("txn1"), "run %d", run)
+		assert.Equal(t, int64(2), results.TxnId("txn2"), "run %d", run)
+		assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("txn1"), "run %d", run)
+		assert.Equal(t, anomalytest.OutcomeRolledBack, results.Outcome("txn2"), "run %d", run)
+		assert.Empty(t, results.Errors(), "run %d", run)
+		assert.Equal(t, map[int]int{1: 100}, db.State(), "run %d", run)
+		assert.False(t, db.HoldsLock(1, 1))
+		assert.False(t, db.HoldsLock(2, 1))
+	}
+}
+
+func TestSimpleDBReadUncommittedWriteLockParallelWritesRollBack(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	setup := exec.NewTxn("setup")
+	setup.BeginTx()
+	setup.Set(1, 10)
+	setup.Commit()
+	setup.Barrier("setup_committed")
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.WaitFor("setup_committed")
+	txn1.BeginTx()
+	var groups []func(*anomalytest.Txn)
+	for i := 0; i < 8; i++ {
+		groups = append(groups, func(g *anomalytest.Txn) {
+			g.Set(1, 100+i)
+			g.Set(2+i%2, 200+i)
+			g.Delete(1)
+		})
+	}
+	txn1.Parallel(groups...)
+	txn1.Rollback()
+
+	results := exec.Execute(false)
+
+	assert.Empty(t, results.Errors())
+	assert.Equal(t, map[int]int{1: 10}, db.State(), "rolling back concurrent writes should restore the committed state")
+	assert.NoError(t, exec.WaitQuiescent(db, time.Second))
+	for key := 1; key <= 3; key++ {
+		assert.False(t, db.HoldsLock(results.TxnId("txn1"), key))
+	}
+}
+
+func TestSimpleDBReadUncommittedWriteLockLockTiming(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	first := txn1.Set(1, 100)
+	again := txn1.Set(1, 101) // already holds the lock
+	txn1.Barrier("txn1_locked")
+	txn1.WaitForWithTimeout("txn2_wrote", 50*time.Millisecond) // txn2 cannot write until txn1 commits
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_locked")
+	txn2.BeginTx()
+	blocked := txn2.Set(1, 200)
+	txn2.Barrier("txn2_wrote")
+	txn2.Commit()
+
+	results := exec.Execute(false)
+
+	firstTiming, ok := results.LockTiming(first)
+	assert.True(t, ok)
+	assert.Equal(t, 1, firstTiming.Key)
+	_, ok = results.LockTiming(again)
+	assert.False(t, ok, "no lock was requested for a key txn1 already held")
+
+	blockedTiming, ok := results.LockTiming(blocked)
+	assert.True(t, ok)
+	assert.GreaterOrEqual(t, blockedTiming.Granted.Sub(blockedTiming.Requested), 40*time.Millisecond)
+	assert.True(t, blockedTiming.Granted.After(firstTiming.Granted))
+}
+
+func TestSimpleDBReadUncommittedWriteLockReadPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy   ReadPolicy
+		during   int // txn2's read of key 1 while txn1's write is uncommitted
+		blocks   bool
+		byOld    []int       // txn2's lookup of the keys with key 1's committed value, right after the read
+		snapshot map[int]int // txn2's snapshot, right after the lookup
+	}{
+		{policy: ReadDirty, during: 100, snapshot: map[int]int{1: 100}},
+		{policy: ReadLatestCommitted, during: 10, byOld: []int{1}, snapshot: map[int]int{1: 10}},
+		{policy: ReadBlocking, during: 100, blocks: true, snapshot: map[int]int{1: 100}}, // waits for txn1 to commit
+	} {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			db := NewSimpleDBReadUncommittedWriteLock()
+			db.SetReadPolicy(tc.policy)
+			exec := anomalytest.NewTxnsExecutor(db)
+
+			setup := exec.NewTxn("setup")
+			setup.BeginTx()
+			setup.Set(1, 10)
+			setup.Commit()
+			setup.Barrier("setup_done")
+
+			txn1 := exec.NewTxn("txn1")
+			txn1.WaitFor("setup_done")
+			txn1.BeginTx()
+			txn1.Set(1, 100)
+			txn1.Barrier("txn1_wrote")
+			txn1.WaitForWithTimeout("txn2_read", 50*time.Millisecond) // a blocking read cannot finish until txn1 commits
+			txn1.Commit()
+
+			txn2 := exec.NewTxn("txn2")
+			txn2.WaitFor("txn1_wrote")
+			txn2.BeginTx()
+			during := txn2.Get(1)
+			byOld := txn2.GetByValue(10)
+			txn2.Checkpoint("during")
+			txn2.Barrier("txn2_read")
+			txn2.Set(2, 200)
+			own := txn2.Get(2)
+			ownByValue := txn2.GetByValue(200)
+			txn2.Commit()
+
+			results := exec.Execute(false)
+
+			assert.Empty(t, results.Errors())
+			assert.Equal(t, tc.during, results.GetValue(during))
+			assert.Equal(t, tc.blocks, results.DidBlock(during))
+			assert.Equal(t, tc.byOld, results.Keys(byOld))
+			assert.Equal(t, tc.snapshot, results.Checkpoint("during"))
+			assert.Equal(t, 200, results.GetValue(own), "a txn always reads its own writes")
+			assert.Equal(t, []int{2}, results.Keys(ownByValue))
+			assert.Equal(t, map[int]int{1: 100, 2: 200}, db.State())
+		})
+	}
+}
+
+func TestSimpleDBReadUncommittedWriteLockReadBlockingGetByValueWaitsForWriter(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.SetReadPolicy(ReadBlocking)
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	setup := exec.NewTxn("setup")
+	setup.BeginTx()
+	setup.Set(1, 10)
+	setup.Commit()
+	setup.Barrier("setup_done")
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.WaitFor("setup_done")
+	txn1.BeginTx()
+	txn1.Set(1, 100) // key 1 no longer has value 10, unless txn1 rolls back
+	txn1.Barrier("txn1_wrote")
+	wait := txn1.WaitForOrTimeout("txn2_looked_up", 50*time.Millisecond)
+	txn1.Rollback()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_wrote")
+	txn2.BeginTx()
+	byValue := txn2.GetByValue(10)
+	txn2.Barrier("txn2_looked_up")
+	txn2.Commit()
+
+	results := exec.Execute(false)
+
+	assert.Empty(t, results.Errors())
+	timedOut, ok := results.WaitTimedOut(wait)
+	assert.True(t, ok)
+	assert.True(t, timedOut, "the lookup should wait for txn1 to end")
+	assert.Equal(t, []int{1}, results.Keys(byValue), "txn1's rolled back write must not hide key 1")
+}
+
+func TestSimpleDBReadUncommittedWriteLockReadLatestCommittedAfterRollback(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.SetReadPolicy(ReadLatestCommitted)
+
+	tx1, _ := db.BeginTx("")
+	db.Set(tx1, 1, 10)
+	db.Commit(tx1)
+
+	tx2, _ := db.BeginTx("")
+	db.Set(tx2, 1, 20)
+	db.Delete(tx2, 1)
+	tx3, _ := db.BeginTx("")
+	value, _ := db.Get(tx3, 1)
+	assert.Equal(t, 10, value)
+	db.Rollback(tx2)
+
+	tx4, _ := db.BeginTx("")
+	db.Delete(tx4, 1)
+	db.Commit(tx4)
+	value, _ = db.Get(tx3, 1)
+	assert.Equal(t, 0, value, "the committed delete is visible")
+}
+
+func TestSimpleDBReadUncommittedWriteLockReadLatestCommittedDirtyReadAbort(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.SetReadPolicy(ReadLatestCommitted)
+	anomalytest.TestDirtyReadAbort_G1a(t, db)
+}
+
+func TestSimpleDBReadUncommittedWriteLockReadLatestCommittedDirtyReadCommit(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.SetReadPolicy(ReadLatestCommitted)
+	anomalytest.TestDirtyReadCommit_G1b(t, db)
+}
+
+func TestSimpleDBReadUncommittedWriteLockReadLatestCommittedDirtyReadCircularInformationFlowG1c(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.SetReadPolicy(ReadLatestCommitted)
+	anomalytest.TestDirtyReadCircularInformationFlow_G1c(t, db)
+}
+
+func TestSimpleDBReadUncommittedWriteLockReadLatestCommittedReadYourOwnWrites(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.SetReadPolicy(ReadLatestCommitted)
+	anomalytest.TestReadYourOwnWrites(t, db)
+}
+
+func TestSimpleDBReadUncommittedWriteLockModifiedBy(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+
+	tx1, _ := db.BeginTx("")
+	tx2, _ := db.BeginTx("")
+	db.Set(tx1, 1, 10)
+	db.Delete(tx2, 2)
+
+	writer, ok := db.ModifiedBy(1)
+	assert.True(t, ok)
+	assert.Equal(t, tx1, writer)
+	writer, ok = db.ModifiedBy(2)
+	assert.True(t, ok, "a delete is an uncommitted write too")
+	assert.Equal(t, tx2, writer)
+	_, ok = db.ModifiedBy(3)
+	assert.False(t, ok)
+
+	db.Commit(tx1)
+	_, ok = db.ModifiedBy(1)
+	assert.False(t, ok, "the value is clean once its writer commits")
+
+	tx3, _ := db.BeginTx("")
+	db.Set(tx3, 1, 11)
+	writer, ok = db.ModifiedBy(1)
+	assert.True(t, ok)
+	assert.Equal(t, tx3, writer, "the last uncommitted writer is reported")
+
+	db.Rollback(tx2)
+	db.Rollback(tx3)
+	_, ok = db.ModifiedBy(1)
+	assert.False(t, ok)
+	_, ok = db.ModifiedBy(2)
+	assert.False(t, ok)
+}
+
+func TestSimpleDBReadUncommittedWriteLockSerializationOrderFollowsDependencies(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	setup := exec.NewTxn("setup")
+	setup.BeginTx()
+	setup.Set(1, 10)
+	setup.Commit()
+	setup.Barrier("setup_done")
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.WaitFor("setup_done")
+	txn1.BeginTx()
+	txn1.Get(1)
+	txn1.Barrier("txn1_read")
+	txn1.WaitFor("txn2_committed")
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_read")
+	txn2.BeginTx()
+	txn2.Set(1, 20)
+	txn2.Commit()
+	txn2.Barrier("txn2_committed")
+
+	results := exec.Execute(false)
+
+	// txn2 commits first, but txn1 read the value txn2 overwrote, so txn1 must come before it
+	assert.Equal(t, []string{"setup", "txn1", "txn2"}, results.SerializationOrder())
+}
+
+func TestSimpleDBReadUncommittedWriteLockSerializationOrderOfLostUpdate(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	setup := exec.NewTxn("setup")
+	setup.BeginTx()
+	setup.Set(1, 10)
+	setup.Commit()
+	setup.Barrier("setup_done")
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.WaitFor("setup_done")
+	txn1.BeginTx()
+	txn1.Get(1)
+	txn1.Barrier("txn1_read")
+	txn1.WaitFor("txn2_read")
+	txn1.Set(1, 11)
+	txn1.Commit()
+	txn1.Barrier("txn1_committed")
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_read")
+	txn2.BeginTx()
+	txn2.Get(1)
+	txn2.Barrier("txn2_read")
+	txn2.WaitFor("txn1_committed")
+	txn2.Set(1, 12)
+	txn2.Commit()
+
+	results := exec.Execute(false)
+
+	// Both read 10 and then overwrote it: neither serial order explains that
+	assert.Nil(t, results.SerializationOrder())
+}
+
+func TestSimpleDBReadUncommittedWriteLockForeignKeyViolation(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	anomalytest.TestForeignKeyViolation(t, db)
+}
+
+func TestSimpleDBReadUncommittedWriteLockForeignKeyRollsBackCommit(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.AddForeignKey(2, 1)
+
+	tx1, _ := db.BeginTx("")
+	db.Set(tx1, 2, 20)
+	err := db.Commit(tx1)
+	assert.ErrorIs(t, err, anomalytest.ErrConstraintViolation)
+	assert.ErrorIs(t, err, anomalytest.ErrAborted)
+	var violation *anomalytest.ConstraintViolationError
+	if assert.ErrorAs(t, err, &violation) {
+		assert.Equal(t, "foreign key", violation.Constraint)
+		assert.Equal(t, []int{2, 1}, violation.Keys)
+		assert.Contains(t, violation.Detail, "key 2 = 20")
+	}
+	assert.Empty(t, db.State(), "the rejected commit's writes are rolled back")
+	assert.False(t, db.HoldsLock(tx1, 2))
+
+	tx2, _ := db.BeginTx("")
+	db.Set(tx2, 1, 10)
+	db.Set(tx2, 2, 20)
+	assert.NoError(t, db.Commit(tx2), "the parent is inserted in the same commit")
+
+	tx3, _ := db.BeginTx("")
+	db.Delete(tx3, 2)
+	db.Delete(tx3, 1)
+	assert.NoError(t, db.Commit(tx3), "the child is deleted in the same commit")
+}
+
+func TestSimpleDBReadUncommittedWriteLockReadLatestCommittedConservedSum(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.SetReadPolicy(ReadLatestCommitted)
+	anomalytest.TestConservedSum(t, db)
+}
+
+func TestSimpleDBReadUncommittedWriteLockReadBlockingConservedSum(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.SetReadPolicy(ReadBlocking)
+	anomalytest.TestConservedSum(t, db)
+}
+
+func TestSimpleDBReadUncommittedWriteLockReadBlockingReadSkew(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.SetReadPolicy(ReadBlocking)
+	anomalytest.TestReadSkew(t, db)
+}
+
+func TestSimpleDBReadUncommittedWriteLockReadBlockingNonRepeatableRead(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.SetReadPolicy(ReadBlocking)
+	anomalytest.TestNonRepeatableRead(t, db)
+}
+
+func TestSimpleDBReadUncommittedWriteLockConstraintViolationIsReported(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.AddForeignKey(2, 1)
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(3, 30)
+	txn1.Set(2, 20)
+	txn1.Commit()
+
+	results := exec.Execute(false)
+
+	assert.Equal(t, anomalytest.OutcomeAborted, results.Outcome("txn1"))
+	errs := results.Errors()
+	if assert.Len(t, errs, 1) {
+		var violation *anomalytest.ConstraintViolationError
+		assert.ErrorAs(t, errs[0].Err, &violation)
+		assert.Equal(t, []int{2, 1}, violation.Keys)
+	}
+	assert.Empty(t, db.State(), "every write of the failed commit is rolled back")
+}
+
+func TestSimpleDBReadUncommittedWriteLockUnblockedBy(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 100)
+	txn1.Set(2, 200)
+	txn1.Barrier("txn1_locked")
+	txn1.WaitForWithTimeout("txn2_done", 50*time.Millisecond) // times out: txn2 is blocked on txn1's lock
+	txn1.Commit()
+
+	for i, name := range []string{"txn2", "txn3"} {
+		txn := exec.NewTxn(name)
+		txn.WaitFor("txn1_locked")
+		txn.BeginTx()
+		txn.Set(i+1, 300)
+		txn.Commit()
+		txn.Barrier(name + "_done")
+	}
+
+	results := exec.Execute(false)
+
+	assert.ElementsMatch(t, []string{"txn2", "txn3"}, results.UnblockedBy("txn1"))
+	assert.Empty(t, results.UnblockedBy("txn2"))
+}
+
+func TestSimpleDBReadUncommittedWriteLockDeadlock(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 10)
+	txn1.Barrier("txn1_locked_1")
+	txn1.WaitFor("txn2_locked_2")
+	txn1.Set(2, 10)
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.BeginTx()
+	txn2.Set(2, 20)
+	txn2.Barrier("txn2_locked_2")
+	txn2.WaitFor("txn1_locked_1")
+	txn2.Set(1, 20)
+	txn2.Commit()
+
+	results := exec.Execute(true)
+
+	// Whichever txn requests the second lock last closes the cycle and is rolled back; the other commits
+	victims := results.DeadlockVictims()
+	if assert.Len(t, victims, 1) {
+		survivor := map[string]string{"txn1": "txn2", "txn2": "txn1"}[victims[0]]
+		assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome(survivor))
+		value := map[string]int{"txn1": 10, "txn2": 20}[survivor]
+		assert.Equal(t, map[int]int{1: value, 2: value}, db.State())
+	}
+	assert.ErrorIs(t, results.Errors()[0], anomalytest.ErrDeadlock)
+}
+
+func TestSimpleDBReadUncommittedWriteLockConcurrentIncrements(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+	for i := 0; i < 8; i++ {
+		txn := exec.NewTxn(fmt.Sprintf("racer%d", i))
+		txn.BeginTx()
+		txn.Increment(1, 1)
+		txn.Increment(1, 1)
+		txn.Commit()
+	}
+	exec.Execute(false)
+
+	assert.Equal(t, map[int]int{1: 16}, db.State())
+}
+
+func TestSimpleDBReadUncommittedWriteLockRandomInterleavingsKeepWritesTogether(t *testing.T) {
+	exec := anomalytest.NewTxnsExecutor(NewSimpleDBReadUncommittedWriteLock())
+	scheduleCrossWrites(exec)
+
+	states := exec.ExecuteRandom(1, 50)
+
+	// Write locks keep either transaction from writing between the other's two writes; runs that deadlock
+	// roll one of them back
+	assert.ElementsMatch(t, []map[int]int{{1: 1, 2: 1}, {1: 2, 2: 2}}, states)
+}
+
+func TestSimpleDBReadUncommittedWriteLockConcurrentSetMany(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+	// Opposite key orders in the maps make no difference: the locks are always taken in ascending order
+	for i := 0; i < 8; i++ {
+		txn := exec.NewTxn(fmt.Sprintf("writer%d", i))
+		txn.BeginTx()
+		txn.SetMany(map[int]int{3 - i%2: i, 2 + i%2: i, 1: i})
+		txn.Commit()
+	}
+
+	results := exec.Execute(false)
+
+	assert.False(t, results.HadDeadlock())
+	assert.Empty(t, results.Errors())
+	state := db.State()
+	assert.Len(t, state, 3)
+	assert.Equal(t, state[1], state[2], "a mix of writers: %v", state)
+	assert.Equal(t, state[1], state[3], "a mix of writers: %v", state)
+}
+
+func TestSimpleDBReadUncommittedWriteLockScanSeesPhantom(t *testing.T) {
+	for _, policy := range []ReadPolicy{ReadDirty, ReadLatestCommitted, ReadBlocking} {
+		t.Run(policy.String(), func(t *testing.T) {
+			db := NewSimpleDBReadUncommittedWriteLock()
+			db.SetReadPolicy(policy)
+			setup, _ := db.BeginTx("READ_UNCOMMITTED")
+			db.Set(setup, 2, 20)
+			db.Commit(setup)
+
+			reader, _ := db.BeginTx("READ_UNCOMMITTED")
+			first, _ := db.Scan(reader, 1, 10)
+			inserter, _ := db.BeginTx("READ_UNCOMMITTED")
+			assert.NoError(t, db.Set(inserter, 3, 30), "a scan does not lock keys that do not exist yet")
+			db.Commit(inserter)
+			second, _ := db.Scan(reader, 1, 10)
+
+			assert.Equal(t, map[int]int{2: 20}, first)
+			assert.Equal(t, map[int]int{2: 20, 3: 30}, second, "the insert appears as a phantom")
+		})
+	}
+}
+
+func TestSimpleDBReadUncommittedWriteLockRollbackToSavepoint(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	setup := exec.NewTxn("setup")
+	setup.BeginTx()
+	setup.Set(1, 10)
+	setup.Set(2, 20)
+	setup.Commit()
+	setup.Barrier("setup_done")
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.WaitFor("setup_done")
+	txn1.BeginTx()
+	txn1.Set(1, 11)
+	txn1.Savepoint("sp")
+	txn1.Set(2, 21)
+	txn1.Set(3, 31)
+	txn1.RollbackTo("sp")
+	one := txn1.Get(1)
+	two := txn1.Get(2)
+	txn1.Set(2, 22) // the savepoint stays, so it can be rolled back to again
+	txn1.RollbackTo("sp")
+	txn1.Commit()
+
+	results := exec.Execute(false)
+
+	assert.Empty(t, results.Errors())
+	assert.Equal(t, 11, results.GetValue(one), "the write before the savepoint is kept")
+	assert.Equal(t, 20, results.GetValue(two), "the writes after the savepoint are undone")
+	assert.Equal(t, map[int]int{1: 11, 2: 20}, db.State())
+}
+
+func TestSimpleDBReadUncommittedWriteLockRollbackToKeepsLocks(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	txn1, _ := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, db.Savepoint(txn1, "sp"))
+	assert.NoError(t, db.Set(txn1, 1, 10))
+	assert.NoError(t, db.RollbackTo(txn1, "sp"))
+	assert.ErrorIs(t, db.RollbackTo(txn1, "missing"), anomalytest.ErrNoSavepoint)
+
+	// Locks taken after the savepoint are held until the transaction ends
+	assert.True(t, db.HoldsLock(txn1, 1))
+	assert.NoError(t, db.Commit(txn1))
+	assert.False(t, db.HoldsLock(txn1, 1))
+
+	txn2, _ := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, db.Set(txn2, 1, 20))
+	assert.NoError(t, db.Commit(txn2))
+	assert.Equal(t, map[int]int{1: 20}, db.State())
+	assert.ErrorIs(t, db.RollbackTo(txn1, "sp"), anomalytest.ErrTxnNotActive)
+}
+
+func TestSimpleDBReadUncommittedWriteLockDeclaredWriteSetsDoNotDeadlock(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	// The writes of TestSimpleDBReadUncommittedWriteLockDeadlock, in opposite key orders, but with both
+	// write sets declared up front: txn2 waits for key 1 before it has locked anything
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.DeclareWriteSet(1, 2)
+	txn1.Set(1, 10)
+	txn1.Barrier("txn1_locked_1")
+	txn1.Set(2, 10)
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_locked_1")
+	txn2.BeginTx()
+	txn2.DeclareWriteSet(2, 1)
+	txn2.Set(2, 20)
+	txn2.Set(1, 20)
+	txn2.Commit()
+
+	results := exec.Execute(false)
+
+	assert.False(t, results.HadDeadlock())
+	assert.Empty(t, results.Errors())
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("txn1"))
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("txn2"))
+	assert.Equal(t, map[int]int{1: 20, 2: 20}, db.State())
+}
+
+func TestSimpleDBReadUncommittedWriteLockRequireWriteSets(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	db.SetRequireWriteSets(true)
+	txn, _ := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, db.DeclareWriteSet(txn, []int{3, 1}))
+	assert.True(t, db.HoldsLock(txn, 1))
+	assert.True(t, db.HoldsLock(txn, 3))
+
+	assert.NoError(t, db.Set(txn, 1, 10))
+	assert.ErrorIs(t, db.Set(txn, 2, 20), anomalytest.ErrLockNotHeld)
+	assert.False(t, db.HoldsLock(txn, 2))
+	assert.NoError(t, db.Commit(txn))
+	assert.Equal(t, map[int]int{1: 10}, db.State())
+}
+
+func TestSimpleDBReadUncommittedWriteLockHistory(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	txn1, _ := db.BeginTx("")
+	db.Set(txn1, 1, 10)
+	db.Set(txn1, 2, 20)
+	db.Commit(txn1)
+
+	txn2, _ := db.BeginTx("")
+	db.Set(txn2, 1, 11)
+	db.Delete(txn2, 2)
+	db.Commit(txn2)
+
+	txn3, _ := db.BeginTx("")
+	db.Set(txn3, 1, 99)
+	db.Rollback(txn3)
+
+	assert.Equal(t, []int{10, 11}, db.History(1))
+	assert.Equal(t, []int{20}, db.History(2), "a delete is not a value")
+
+	db.Reset()
+	assert.Empty(t, db.History(1))
+}
+
+func TestSimpleDBReadUncommittedWriteLockTracesLockWaits(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	exec := anomalytest.NewTxnsExecutor(db)
+	exec.SetTracing(true)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.Set(1, 10)
+	txn1.Barrier("txn1_wrote")
+	txn1.WaitForWithTimeout("txn2_wrote", 50*time.Millisecond) // txn2 blocks on key 1, so this times out
+	txn1.Commit()
+
+	txn2 := exec.NewTxn("txn2")
+	txn2.WaitFor("txn1_wrote")
+	txn2.BeginTx()
+	txn2.Set(1, 20)
+	txn2.Barrier("txn2_wrote")
+	txn2.Commit()
+
+	exec.Execute(false)
+	trace := exec.Trace()
+
+	index := func(txnName, kind string) int {
+		return slices.IndexFunc(trace, func(event anomalytest.TraceEvent) bool {
+			return event.TxnName == txnName && event.Kind == kind
+		})
+	}
+	wait, commit, acquired := index("txn2", anomalytest.TraceLockWait), index("txn1", anomalytest.OpCommit), index("txn2", anomalytest.TraceLockAcquired)
+	assert.NotEqual(t, -1, wait, "txn2 should wait for txn1's lock on key 1")
+	assert.Less(t, wait, commit)
+	assert.Less(t, commit, acquired, "txn2 is granted the lock once txn1 commits")
+	assert.Equal(t, 1, trace[wait].Key)
+}
+
+func TestSimpleDBReadUncommittedWriteLockRejectsOpsAfterCommit(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	txn1, _ := db.BeginTx("READ_UNCOMMITTED")
+	assert.NoError(t, db.Set(txn1, 1, 10))
+	assert.NoError(t, db.Commit(txn1))
+
+	assert.ErrorIs(t, db.Set(txn1, 1, 11), anomalytest.ErrTxnNotActive)
+	_, err := db.Get(txn1, 1)
+	assert.ErrorIs(t, err, anomalytest.ErrTxnNotActive)
+	assert.Equal(t, map[int]int{1: 10}, db.State())
+	assert.False(t, db.HoldsLock(txn1, 1), "the rejected write leaves no lock behind")
+}
+
+// slowReleaseLockManager pauses after releasing a transaction's locks, so that a waiter it wakes runs first
+type slowReleaseLockManager struct {
+	*BlockingLockManager
+}
+
+func (m slowReleaseLockManager) ReleaseAll(txId int64) {
+	m.BlockingLockManager.ReleaseAll(txId)
+	time.Sleep(20 * time.Millisecond)
+}
+
+func TestSimpleDBReadUncommittedWriteLockRollbackUndoesBeforeWakingWaiters(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLockWith(slowReleaseLockManager{NewBlockingLockManager()})
+	db.SetReadPolicy(ReadBlocking)
+	setup, _ := db.BeginTx("")
+	db.Set(setup, 1, 10)
+	db.Set(setup, 2, 20)
+	db.Commit(setup)
+
+	aborted, _ := db.BeginTx("")
+	reader, _ := db.BeginTx("")
+	writer, _ := db.BeginTx("")
+	assert.NoError(t, db.Set(aborted, 1, 100))
+	assert.NoError(t, db.Set(aborted, 2, 100))
+	read := make(chan int, 1)
+	go func() {
+		value, _ := db.Get(reader, 1)
+		read <- value
+	}()
+	wrote := make(chan error, 1)
+	go func() { wrote <- db.Set(writer, 2, 200) }()
+	assertBlocked(t, wrote)
+
+	assert.NoError(t, db.Rollback(aborted))
+	assert.Equal(t, 10, <-read, "the reader must not see the rolled back write")
+	assertGranted(t, wrote)
+	assert.Equal(t, map[int]int{1: 10, 2: 200}, db.State(), "the rollback must not undo the writer's write")
+	assert.NoError(t, db.Rollback(writer))
+	assert.Equal(t, map[int]int{1: 10, 2: 20}, db.State(), "the writer's own rollback restores the committed value")
+	assert.NoError(t, db.Commit(reader))
+}
+
+// pausingLockManager pauses each Acquire until resumed, after the database has checked the transaction is
+// active and before the lock is granted
+type pausingLockManager struct {
+	*BlockingLockManager
+	paused, resume chan struct{}
+}
+
+func (m pausingLockManager) Acquire(txId int64, key int, mode LockMode) error {
+	m.paused <- struct{}{}
+	<-m.resume
+	return m.BlockingLockManager.Acquire(txId, key, mode)
+}
+
+func TestSimpleDBReadUncommittedWriteLockReleasesLockGrantedAfterRollback(t *testing.T) {
+	lm := pausingLockManager{NewBlockingLockManager(), make(chan struct{}), make(chan struct{})}
+	db := NewSimpleDBReadUncommittedWriteLockWith(lm)
+	txn, _ := db.BeginTx("")
+	wrote := make(chan error, 1)
+	go func() { wrote <- db.Set(txn, 1, 10) }()
+	<-lm.paused
+
+	assert.NoError(t, db.Rollback(txn)) // e.g. after the write timed out, with nothing waiting in the manager
+	close(lm.resume)
+	select {
+	case err := <-wrote:
+		assert.ErrorIs(t, err, anomalytest.ErrTxnNotActive)
+	case <-time.After(time.Second):
+		t.Fatal("the write should fail once its txn has ended")
+	}
+	assert.False(t, db.HoldsLock(txn, 1), "a lock granted after the rollback must be released")
+	assert.Empty(t, db.State())
+}
+
+func TestSimpleDBReadUncommittedWriteLockRollbackRestoresKeysAfterSetDeleteSet(t *testing.T) {
+	db := NewSimpleDBReadUncommittedWriteLock()
+	setup, _ := db.BeginTx("READ_UNCOMMITTED")
+	db.Set(setup, 1, 10)
+	db.Commit(setup)
+
+	txn, _ := db.BeginTx("READ_UNCOMMITTED")
+	for _, key := range []int{1, 2} { // key 2 did not exist before txn
+		assert.NoError(t, db.Set(txn, key, 11))
+		assert.NoError(t, db.Delete(txn, key))
+		assert.NoError(t, db.Set(txn, key, 12))
+	}
+	assert.NoError(t, db.Rollback(txn))
+
+	assert.Equal(t, map[int]int{1: 10}, db.State())
+	keys, _ := db.GetByValue(setup, 12)
+	assert.Empty(t, keys, "the value index is rolled back too")
+}
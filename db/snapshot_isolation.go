@@ -0,0 +1,429 @@
+package db
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+)
+
+// version is one value of a key, written by txnId. A version with committedAt 0 is pending until its
+// transaction commits; an aborted one stays until garbage collection so that VersionHistory can show it.
+type version struct {
+	txnId       int64
+	value       int
+	deleted     bool  // a tombstone written by Delete
+	committedAt int64 // commit timestamp, 0 while pending
+	aborted     bool
+}
+
+// siTxn is the state of an active snapshot isolation transaction
+type siTxn struct {
+	startTs  int64 // reads see the versions committed at or before it
+	readOnly bool  // begun with BeginSnapshot
+	writes   []int // keys it has a pending version of, in the order first written
+}
+
+// DatabaseSnapshotIsolation is an MVCC database: each transaction reads from the snapshot of committed data
+// taken when it began, plus its own writes, which stay invisible to others until it commits. Reads never
+// block and never see uncommitted or aborted data. Writes do not check for conflicts: when two concurrent
+// transactions write the same key, both commit and the later commit's value wins, so lost updates and write
+// skew are possible.
+type DatabaseSnapshotIsolation struct {
+	versions  map[int][]version // key -> versions, pending and aborted ones included, in commit order
+	txns      map[int64]*siTxn  // active transactions
+	history   history           // values committed to each key, oldest first, kept past garbage collection
+	clock     Clock             // nil: each commit takes the next integer, and each snapshot the latest commit's
+	latestTs  int64             // the latest timestamp given to a snapshot or a commit
+	nextTxnId int64
+	mu        sync.RWMutex
+	logger    anomalytest.Logger
+
+	// firstCommitterWins makes Commit fail when another transaction committed a key it wrote after it began
+	firstCommitterWins bool
+}
+
+func NewDatabaseSnapshotIsolation() *DatabaseSnapshotIsolation {
+	return &DatabaseSnapshotIsolation{
+		versions:  make(map[int][]version),
+		txns:      make(map[int64]*siTxn),
+		history:   make(history),
+		nextTxnId: 1,
+		logger:    anomalytest.DefaultLogger(),
+	}
+}
+
+func (d *DatabaseSnapshotIsolation) Capabilities() anomalytest.Capability {
+	return anomalytest.CapMVCC | anomalytest.CapSnapshot | anomalytest.CapAggregate | anomalytest.CapScan
+}
+
+// SetClock makes the database take snapshot and commit timestamps from clock instead of counting commits.
+// Set it before any transaction begins.
+func (d *DatabaseSnapshotIsolation) SetClock(clock Clock) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.clock = clock
+}
+
+// timestamp returns the time for a snapshot, or for a commit if commit is set. A snapshot is never
+// taken before the latest commit, and a commit is always timestamped after every snapshot already taken, so a
+// ManualClock that has not moved since a transaction began cannot slip a commit into its snapshot.
+// Caller must hold mu.
+func (d *DatabaseSnapshotIsolation) timestamp(commit bool) int64 {
+	var ts int64
+	if d.clock != nil {
+		ts = d.clock.Now()
+	}
+	if commit {
+		ts = max(ts, d.latestTs+1)
+	} else {
+		ts = max(ts, d.latestTs)
+	}
+	d.latestTs = ts
+	return ts
+}
+
+func (d *DatabaseSnapshotIsolation) BeginTx(isolationLevel string) (int64, error) {
+	return d.begin(false), nil
+}
+
+// BeginSnapshot begins a read-only transaction on the latest committed snapshot; its writes fail with ErrReadOnly
+func (d *DatabaseSnapshotIsolation) BeginSnapshot() (int64, error) {
+	return d.begin(true), nil
+}
+
+func (d *DatabaseSnapshotIsolation) begin(readOnly bool) int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	txId := d.nextTxnId
+	d.nextTxnId++
+	d.txns[txId] = &siTxn{startTs: d.timestamp(false), readOnly: readOnly}
+	return txId
+}
+
+// ReadTimestamp returns the timestamp of the snapshot txId reads from, assigned when it began
+func (d *DatabaseSnapshotIsolation) ReadTimestamp(txId int64) (int64, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	txn, ok := d.txns[txId]
+	if !ok {
+		return 0, false
+	}
+	return txn.startTs, true
+}
+
+// activeTxn returns txId's state, or an error wrapping ErrTxnNotActive. Caller must hold mu.
+func (d *DatabaseSnapshotIsolation) activeTxn(txId int64, action string) (*siTxn, error) {
+	txn, ok := d.txns[txId]
+	if !ok {
+		return nil, fmt.Errorf("txn %d %s: %w", txId, action, anomalytest.ErrTxnNotActive)
+	}
+	return txn, nil
+}
+
+func (d *DatabaseSnapshotIsolation) Set(txId int64, key int, value int) error {
+	return d.write(txId, key, version{txnId: txId, value: value}, fmt.Sprintf("writing key %d", key))
+}
+
+func (d *DatabaseSnapshotIsolation) Delete(txId int64, key int) error {
+	return d.write(txId, key, version{txnId: txId, deleted: true}, fmt.Sprintf("deleting key %d", key))
+}
+
+// write replaces txId's pending version of key with v, or adds it
+func (d *DatabaseSnapshotIsolation) write(txId int64, key int, v version, action string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	txn, err := d.activeTxn(txId, action)
+	if err != nil {
+		return err
+	}
+	if txn.readOnly {
+		return fmt.Errorf("txn %d %s: %w", txId, action, anomalytest.ErrReadOnly)
+	}
+	versions := d.versions[key]
+	for i := range versions {
+		if versions[i].txnId == txId && versions[i].committedAt == 0 && !versions[i].aborted {
+			versions[i] = v
+			return nil
+		}
+	}
+	d.versions[key] = append(versions, v)
+	txn.writes = append(txn.writes, key)
+	return nil
+}
+
+// visible returns the value of key that txId sees: its own pending write if it has one, otherwise the newest
+// version committed at or before its snapshot. Caller must hold mu.
+func (d *DatabaseSnapshotIsolation) visible(txId int64, txn *siTxn, key int) (int, bool) {
+	var seen *version
+	for i, v := range d.versions[key] {
+		switch {
+		case v.aborted:
+		case v.txnId == txId && v.committedAt == 0:
+			return v.value, !v.deleted
+		case v.committedAt != 0 && v.committedAt <= txn.startTs:
+			seen = &d.versions[key][i]
+		}
+	}
+	if seen == nil || seen.deleted {
+		return 0, false
+	}
+	return seen.value, true
+}
+
+func (d *DatabaseSnapshotIsolation) Get(txId int64, key int) (int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	txn, err := d.activeTxn(txId, fmt.Sprintf("reading key %d", key))
+	if err != nil {
+		return 0, err
+	}
+	value, _ := d.visible(txId, txn, key)
+	return value, nil
+}
+
+// Sum returns the total of keys in txId's snapshot
+func (d *DatabaseSnapshotIsolation) Sum(txId int64, keys []int) (int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	txn, err := d.activeTxn(txId, "summing")
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, key := range keys {
+		value, _ := d.visible(txId, txn, key)
+		total += value
+	}
+	return total, nil
+}
+
+// Scan returns every key from lo to hi in txId's snapshot, with its own writes applied. Keys other
+// transactions insert into the range after txId began never appear, so repeated scans return the same rows.
+func (d *DatabaseSnapshotIsolation) Scan(txId int64, lo, hi int) (map[int]int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	txn, err := d.activeTxn(txId, fmt.Sprintf("scanning keys %d to %d", lo, hi))
+	if err != nil {
+		return nil, err
+	}
+	rows := make(map[int]int)
+	for key := range d.versions {
+		if lo > key || key > hi {
+			continue
+		}
+		if value, ok := d.visible(txId, txn, key); ok {
+			rows[key] = value
+		}
+	}
+	return rows, nil
+}
+
+// Snapshot returns every key-value pair in txId's snapshot, with its own writes applied
+func (d *DatabaseSnapshotIsolation) Snapshot(txId int64) (map[int]int, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	txn, err := d.activeTxn(txId, "taking a snapshot")
+	if err != nil {
+		return nil, err
+	}
+	state := make(map[int]int)
+	for key := range d.versions {
+		if value, ok := d.visible(txId, txn, key); ok {
+			state[key] = value
+		}
+	}
+	return state, nil
+}
+
+// Commit makes txId's writes visible to transactions that begin afterwards, all at one new timestamp,
+// then garbage collects versions no active transaction can see any more
+func (d *DatabaseSnapshotIsolation) Commit(txId int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	txn, err := d.activeTxn(txId, "committing")
+	if err != nil {
+		return err
+	}
+	if d.firstCommitterWins {
+		if err := d.writeConflict(txId, txn); err != nil {
+			d.abort(txId, txn)
+			return err
+		}
+	}
+	if len(txn.writes) > 0 {
+		commitTs := d.timestamp(true)
+		for _, key := range txn.writes {
+			versions := d.versions[key]
+			for i := range versions {
+				if versions[i].txnId == txId && versions[i].committedAt == 0 && !versions[i].aborted {
+					// Move the version after every earlier commit, keeping the slice in commit order
+					v := versions[i]
+					v.committedAt = commitTs
+					if !v.deleted {
+						d.history.add(key, v.value)
+					}
+					versions = append(append(versions[:i:i], versions[i+1:]...), v)
+					break
+				}
+			}
+			d.versions[key] = versions
+		}
+	}
+	delete(d.txns, txId)
+	d.collectGarbage()
+	return nil
+}
+
+// Rollback discards txId's writes. Its versions are marked aborted and kept until the next garbage collection.
+func (d *DatabaseSnapshotIsolation) Rollback(txId int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if txn, ok := d.txns[txId]; ok {
+		d.abort(txId, txn)
+	}
+	return nil
+}
+
+// abort marks txId's pending versions aborted and ends it. Caller must hold mu.
+func (d *DatabaseSnapshotIsolation) abort(txId int64, txn *siTxn) {
+	for _, key := range txn.writes {
+		for i := range d.versions[key] {
+			if v := &d.versions[key][i]; v.txnId == txId && v.committedAt == 0 {
+				v.aborted = true
+			}
+		}
+	}
+	delete(d.txns, txId)
+}
+
+// writeConflict returns an error wrapping ErrSerializationFailure if another transaction committed a key
+// txId wrote after txId's snapshot was taken. Garbage collection keeps every version committed after the
+// oldest active snapshot, so the versions it checks are still there. Caller must hold mu.
+func (d *DatabaseSnapshotIsolation) writeConflict(txId int64, txn *siTxn) error {
+	for _, key := range txn.writes {
+		for _, v := range d.versions[key] {
+			if v.committedAt > txn.startTs {
+				return fmt.Errorf("txn %d committing: key %d was written by txn %d, which committed after txn %d began: %w",
+					txId, key, v.txnId, txId, anomalytest.ErrSerializationFailure)
+			}
+		}
+	}
+	return nil
+}
+
+// collectGarbage drops the versions that no active transaction can see: aborted ones, and committed ones
+// superseded by a version committed at or before the oldest active snapshot. With no transaction active,
+// only the latest committed version of each key is kept, and a key whose latest version is a tombstone is
+// dropped altogether. Caller must hold mu.
+func (d *DatabaseSnapshotIsolation) collectGarbage() {
+	horizon := d.latestTs
+	for _, txn := range d.txns {
+		horizon = min(horizon, txn.startTs)
+	}
+	for key, versions := range d.versions {
+		// The newest version committed at or before the horizon is the oldest one anyone can still see
+		oldest := -1
+		for i, v := range versions {
+			if v.committedAt != 0 && v.committedAt <= horizon {
+				oldest = i
+			}
+		}
+		kept := versions[:0]
+		for i, v := range versions {
+			switch {
+			case v.aborted:
+			case v.committedAt != 0 && i < oldest:
+			case i == oldest && v.deleted:
+			default:
+				kept = append(kept, v)
+			}
+		}
+		if len(kept) == 0 {
+			delete(d.versions, key)
+		} else {
+			d.versions[key] = kept
+		}
+	}
+}
+
+// VersionHistory returns every stored version of key: committed ones in commit order, each visible from its
+// commit timestamp until the next one's, followed by pending and aborted ones
+func (d *DatabaseSnapshotIsolation) VersionHistory(key int) []anomalytest.VersionInfo {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	var committed, uncommitted []anomalytest.VersionInfo
+	for _, v := range d.versions[key] {
+		info := anomalytest.VersionInfo{TxId: v.txnId, Value: v.value, Deleted: v.deleted, BeginTs: v.committedAt}
+		switch {
+		case v.aborted:
+			info.Status = anomalytest.VersionAborted
+			uncommitted = append(uncommitted, info)
+		case v.committedAt == 0:
+			info.Status = anomalytest.VersionPending
+			uncommitted = append(uncommitted, info)
+		default:
+			info.Status = anomalytest.VersionCommitted
+			if n := len(committed); n > 0 {
+				committed[n-1].EndTs = v.committedAt
+			}
+			committed = append(committed, info)
+		}
+	}
+	return append(committed, uncommitted...)
+}
+
+// History returns the values committed to key, oldest first. Unlike VersionHistory, it keeps the values
+// that garbage collection has dropped, and leaves out pending, aborted and deleted versions.
+func (d *DatabaseSnapshotIsolation) History(key int) []int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.history.of(key)
+}
+
+// State returns the latest committed value of every key, without the writes of active transactions
+func (d *DatabaseSnapshotIsolation) State() map[int]int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	state := make(map[int]int)
+	for key, versions := range d.versions {
+		for i := len(versions) - 1; i >= 0; i-- {
+			if v := versions[i]; v.committedAt != 0 {
+				if !v.deleted {
+					state[key] = v.value
+				}
+				break
+			}
+		}
+	}
+	return state
+}
+
+// ActiveTxns returns the transactions that have begun but not yet committed or rolled back
+func (d *DatabaseSnapshotIsolation) ActiveTxns() []int64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	txns := make([]int64, 0, len(d.txns))
+	for txId := range d.txns {
+		txns = append(txns, txId)
+	}
+	return txns
+}
+
+// SetLogger sets the logger that PrintState writes to
+func (d *DatabaseSnapshotIsolation) SetLogger(logger anomalytest.Logger) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.logger = logger
+}
+
+func (d *DatabaseSnapshotIsolation) PrintState() {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	versions := make(map[int]int, len(d.versions))
+	for key, vs := range d.versions {
+		versions[key] = len(vs)
+	}
+	d.logger.Info("database state", "versions", versions, "active_txns", len(d.txns), "latest_ts", d.latestTs,
+		"next_txn_id", d.nextTxnId)
+}
@@ -0,0 +1,186 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	_ anomalytest.VersionInspector = (*DatabaseSnapshotIsolation)(nil)
+	_ anomalytest.SnapshotReader   = (*DatabaseSnapshotIsolation)(nil)
+	_ anomalytest.Historian        = (*DatabaseSnapshotIsolation)(nil)
+	_ anomalytest.ReadTimestamper  = (*DatabaseSnapshotIsolation)(nil)
+	_ anomalytest.SumDatabase      = (*DatabaseSnapshotIsolation)(nil)
+)
+
+func TestDatabaseSnapshotIsolationDirtyReadAbort(t *testing.T) {
+	anomalytest.TestDirtyReadAbort_G1a(t, NewDatabaseSnapshotIsolation())
+}
+
+func TestDatabaseSnapshotIsolationDirtyReadCircularInformationFlowG1c(t *testing.T) {
+	anomalytest.TestDirtyReadCircularInformationFlow_G1c(t, NewDatabaseSnapshotIsolation())
+}
+
+// Writes are buffered in the writing transaction until it commits, so T2's update in G0 neither blocks nor
+// overwrites T1's uncommitted one: both commit, and the later commit's values win
+func TestDatabaseSnapshotIsolationBuffersWritesInG0(t *testing.T) {
+	exec := anomalytest.HermitageG0(NewDatabaseSnapshotIsolation())
+	results := exec.Execute(true)
+
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("T1"))
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("T2"))
+	finalReads := exec.Reads("check")
+	assert.Equal(t, 12, results.GetValue(finalReads[0]))
+	assert.Equal(t, 22, results.GetValue(finalReads[1]))
+}
+
+func TestDatabaseSnapshotIsolationSnapshotReadConsistency(t *testing.T) {
+	anomalytest.TestSnapshotReadConsistency(t, NewDatabaseSnapshotIsolation())
+}
+
+func TestDatabaseSnapshotIsolationReadSkew(t *testing.T) {
+	anomalytest.TestReadSkew(t, NewDatabaseSnapshotIsolation())
+}
+
+func TestDatabaseSnapshotIsolationNonRepeatableRead(t *testing.T) {
+	anomalytest.TestNonRepeatableRead(t, NewDatabaseSnapshotIsolation())
+}
+
+func TestDatabaseSnapshotIsolationReadYourOwnWrites(t *testing.T) {
+	anomalytest.TestReadYourOwnWrites(t, NewDatabaseSnapshotIsolation())
+}
+
+func TestDatabaseSnapshotIsolationConservedSum(t *testing.T) {
+	anomalytest.TestConservedSum(t, NewDatabaseSnapshotIsolation())
+}
+
+func TestDatabaseSnapshotIsolationReadsFromStartSnapshot(t *testing.T) {
+	db := NewDatabaseSnapshotIsolation()
+	setup, _ := db.BeginTx("SNAPSHOT")
+	db.Set(setup, 1, 10)
+	db.Commit(setup)
+
+	reader, _ := db.BeginTx("SNAPSHOT")
+	writer, _ := db.BeginTx("SNAPSHOT")
+	db.Set(writer, 1, 11)
+	db.Set(writer, 2, 20)
+	value, _ := db.Get(writer, 1)
+	assert.Equal(t, 11, value, "a transaction reads its own writes")
+	value, _ = db.Get(reader, 1)
+	assert.Equal(t, 10, value, "pending writes are invisible")
+	db.Commit(writer)
+
+	value, _ = db.Get(reader, 1)
+	assert.Equal(t, 10, value, "writes committed after the reader began are invisible")
+	value, _ = db.Get(reader, 2)
+	assert.Equal(t, 0, value)
+
+	later, _ := db.BeginTx("SNAPSHOT")
+	value, _ = db.Get(later, 1)
+	assert.Equal(t, 11, value)
+	readTs, _ := db.ReadTimestamp(reader)
+	laterTs, _ := db.ReadTimestamp(later)
+	assert.Less(t, readTs, laterTs)
+}
+
+func TestDatabaseSnapshotIsolationManualClock(t *testing.T) {
+	db := NewDatabaseSnapshotIsolation()
+	clock := NewManualClock(100)
+	db.SetClock(clock)
+
+	setup, _ := db.BeginTx("SNAPSHOT")
+	db.Set(setup, 1, 10)
+	clock.Advance(10)
+	db.Commit(setup)
+
+	reader, _ := db.BeginTx("SNAPSHOT")
+	readTs, _ := db.ReadTimestamp(reader)
+	assert.Equal(t, int64(110), readTs)
+
+	writer, _ := db.BeginTx("SNAPSHOT")
+	db.Set(writer, 1, 11)
+	db.Commit(writer)
+	value, _ := db.Get(reader, 1)
+	assert.Equal(t, 10, value, "a commit while the clock stands still is still after the reader's snapshot")
+
+	writer, _ = db.BeginTx("SNAPSHOT")
+	db.Set(writer, 1, 12)
+	clock.Advance(20)
+	db.Commit(writer)
+
+	history := db.VersionHistory(1)
+	assert.Equal(t, []int64{110, 111, 130}, []int64{history[0].BeginTs, history[1].BeginTs, history[2].BeginTs})
+	assert.Panics(t, func() { clock.Advance(-1) })
+}
+
+func TestDatabaseSnapshotIsolationLastCommitterWins(t *testing.T) {
+	db := NewDatabaseSnapshotIsolation()
+	txn1, _ := db.BeginTx("SNAPSHOT")
+	txn2, _ := db.BeginTx("SNAPSHOT")
+	db.Set(txn1, 1, 1)
+	db.Set(txn2, 1, 2)
+	assert.NoError(t, db.Commit(txn2))
+	assert.NoError(t, db.Commit(txn1), "concurrent writers are not checked for conflicts")
+	assert.Equal(t, map[int]int{1: 1}, db.State())
+}
+
+func TestDatabaseSnapshotIsolationGarbageCollection(t *testing.T) {
+	db := NewDatabaseSnapshotIsolation()
+	setup, _ := db.BeginTx("SNAPSHOT")
+	db.Set(setup, 1, 10)
+	db.Set(setup, 2, 20)
+	db.Commit(setup)
+
+	reader, _ := db.BeginSnapshot()
+	for value := 11; value <= 13; value++ {
+		writer, _ := db.BeginTx("SNAPSHOT")
+		db.Set(writer, 1, value)
+		db.Commit(writer)
+	}
+	aborted, _ := db.BeginTx("SNAPSHOT")
+	db.Set(aborted, 1, 99)
+	db.Delete(aborted, 2)
+	db.Rollback(aborted)
+
+	// The reader still sees 10, so it and every later version are kept; the rolled back ones are shown as aborted
+	history := db.VersionHistory(1)
+	assert.Len(t, history, 5)
+	assert.Equal(t, anomalytest.VersionInfo{TxId: setup, Value: 10, BeginTs: 1, EndTs: 2, Status: anomalytest.VersionCommitted}, history[0])
+	assert.Equal(t, anomalytest.VersionAborted, history[4].Status)
+	value, _ := db.Get(reader, 1)
+	assert.Equal(t, 10, value)
+
+	// Collection runs on commit
+	deleter, _ := db.BeginTx("SNAPSHOT")
+	db.Delete(deleter, 2)
+	db.Commit(deleter)
+	assert.Len(t, db.VersionHistory(1), 4, "the aborted version is collected")
+	assert.Len(t, db.VersionHistory(2), 2, "the reader still sees 20 under the tombstone")
+
+	db.Commit(reader)
+	history = db.VersionHistory(1)
+	assert.Len(t, history, 1, "only the latest version is kept once no snapshot needs the older ones")
+	assert.Equal(t, 13, history[0].Value)
+	assert.Empty(t, db.VersionHistory(2), "a deleted key is dropped")
+	assert.Equal(t, map[int]int{1: 13}, db.State())
+	assert.Equal(t, []int{10, 11, 12, 13}, db.History(1), "History keeps the collected values")
+	assert.Equal(t, []int{20}, db.History(2))
+}
+
+func TestDatabaseSnapshotIsolationPhantomRead(t *testing.T) {
+	anomalytest.TestPhantomRead_G2(t, NewDatabaseSnapshotIsolation())
+}
+
+// Snapshot isolation lets write skew through: both doctors read a snapshot with the other on call, and
+// their writes do not overlap
+func TestDatabaseSnapshotIsolationAllowsWriteSkew(t *testing.T) {
+	exec := anomalytest.OnCallDoctors(NewDatabaseSnapshotIsolation())
+	results := exec.Execute(true)
+
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("alice"))
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("bob"))
+	final := exec.Reads("check")
+	assert.Equal(t, 0, results.GetValue(final[0])+results.GetValue(final[1]), "nobody is on call")
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// encodeState serializes committed data for DumpState, as a JSON object from key to value
+func encodeState(data map[int]int) ([]byte, error) {
+	return json.Marshal(data)
+}
+
+// decodeState parses the output of encodeState and builds the value index for it
+func decodeState(dump []byte) (map[int]int, valueIndex, error) {
+	var data map[int]int
+	if err := json.Unmarshal(dump, &data); err != nil {
+		return nil, nil, fmt.Errorf("decoding state: %w", err)
+	}
+	if data == nil {
+		data = make(map[int]int)
+	}
+	index := make(valueIndex)
+	for key, value := range data {
+		index.add(value, key)
+	}
+	return data, index, nil
+}
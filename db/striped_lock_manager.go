@@ -0,0 +1,343 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+)
+
+// StripedLockManager is a LockManager that splits its lock table into stripes, each with its own mutex, so
+// that transactions locking keys in different stripes do not contend for one mutex. Key k is in stripe
+// k mod the number of stripes, and each transaction's bookkeeping is striped the same way by its id.
+// Besides granting and releasing locks it has deadlock detection, HoldsLock, anomalytest.LockWaitCounter and
+// anomalytest.Resetter. FIFO
+// mode, range locks, lock timings and the other inspection methods of BlockingLockManager need the whole lock
+// table at once, so it has none of them. Deadlocks are left waiting unless detection is turned on with
+// SetDeadlockDetection.
+type StripedLockManager struct {
+	stripes []lockStripe
+	txns    []txnStripe
+	graph   waitGraph
+}
+
+// lockStripe is the part of the lock table for the keys in one stripe
+type lockStripe struct {
+	mu         sync.Mutex
+	released   *sync.Cond             // broadcast when a lock in the stripe is released or a txn waiting in it ends
+	exclusive  map[int]int64          // key -> txn holding it exclusively
+	shared     map[int]map[int64]bool // key -> txns holding it shared
+	generation int                    // incremented by Reset, so waiters from before it give up
+}
+
+// txnStripe is the bookkeeping of the transactions whose ids are in one stripe. Its mutex is taken after a
+// lockStripe's, never before.
+type txnStripe struct {
+	mu      sync.Mutex
+	held    map[int64][]int // txnId -> keys it holds a lock on
+	ended   map[int64]bool  // txns that have committed or rolled back with requests still waiting
+	waiting map[int64]int   // txnId -> number of its requests blocked waiting, several in a Parallel group
+	waits   map[int64]int   // txnId -> number of times it had to wait for a lock
+}
+
+// waitGraph is the wait-for graph deadlock detection walks. Its mutex is taken after a lockStripe's, never
+// before, and never together with a txnStripe's.
+type waitGraph struct {
+	mu       sync.Mutex
+	detect   bool              // fail requests that would deadlock; see SetDeadlockDetection
+	waitsFor map[int64][]int64 // txnId -> holders of the lock it is waiting for, recorded only while detect is on
+}
+
+// NewStripedLockManager creates a lock manager with the given number of stripes. It panics if stripes is
+// less than 1.
+func NewStripedLockManager(stripes int) *StripedLockManager {
+	if stripes < 1 {
+		panic(fmt.Sprintf("NewStripedLockManager: need at least 1 stripe, got %d", stripes))
+	}
+	m := &StripedLockManager{stripes: make([]lockStripe, stripes), txns: make([]txnStripe, stripes)}
+	m.graph.waitsFor = make(map[int64][]int64)
+	for i := range m.stripes {
+		s := &m.stripes[i]
+		s.released = sync.NewCond(&s.mu)
+		s.exclusive, s.shared = make(map[int]int64), make(map[int]map[int64]bool)
+	}
+	for i := range m.txns {
+		m.txns[i].reset()
+	}
+	return m
+}
+
+// stripeOf returns the index of the stripe key is in
+func (m *StripedLockManager) stripeOf(key int) int {
+	return int(uint(key) % uint(len(m.stripes)))
+}
+
+// txn returns the stripe holding txId's bookkeeping
+func (m *StripedLockManager) txn(txId int64) *txnStripe {
+	return &m.txns[uint64(txId)%uint64(len(m.txns))]
+}
+
+// Acquire grants txId the lock on key in mode, blocking while another transaction holds a conflicting lock.
+// It fails if the transaction ends while waiting, if the manager is reset while it waits, or, with deadlock
+// detection on, if waiting would deadlock.
+func (m *StripedLockManager) Acquire(txId int64, key int, mode LockMode) error {
+	s, t := &m.stripes[m.stripeOf(key)], m.txn(txId)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.holds(txId, key, mode) {
+		return nil // Already hold this lock
+	}
+
+	generation := s.generation
+	waited, recorded := false, false
+	for !s.grantable(txId, key, mode) {
+		cycle, detecting := m.graph.wait(txId, s.blockers(txId, key, mode))
+		if detecting && !recorded {
+			recorded = true
+			defer m.graph.doneWaiting(txId)
+		}
+		if cycle != nil {
+			if waited {
+				t.mu.Lock()
+				t.doneWaiting(txId)
+				t.mu.Unlock()
+			}
+			return &anomalytest.DeadlockError{Victim: txId, Cycle: cycle}
+		}
+		t.mu.Lock()
+		ended := t.ended[txId]
+		switch {
+		case ended && waited:
+			t.doneWaiting(txId)
+		case !ended && !waited:
+			t.waiting[txId]++
+			waited = true
+		}
+		t.mu.Unlock()
+		if ended {
+			return fmt.Errorf("txn %d locking key %d: %w", txId, key, anomalytest.ErrTxnNotActive)
+		}
+		s.released.Wait() // Held by another txn, block until it is released
+		if generation != s.generation {
+			return fmt.Errorf("txn %d locking key %d after a reset: %w", txId, key, anomalytest.ErrTxnNotActive)
+		}
+	}
+
+	t.mu.Lock()
+	ended := t.ended[txId]
+	if waited {
+		t.doneWaiting(txId)
+		t.waits[txId]++
+	}
+	if !ended && !s.holds(txId, key, LockShared) {
+		t.held[txId] = append(t.held[txId], key)
+	}
+	t.mu.Unlock()
+	if ended {
+		// Nothing would ever release a lock granted to an ended txn
+		return fmt.Errorf("txn %d locking key %d: %w", txId, key, anomalytest.ErrTxnNotActive)
+	}
+
+	if mode == LockExclusive {
+		s.exclusive[key] = txId
+		delete(s.shared[key], txId)
+	} else {
+		if s.shared[key] == nil {
+			s.shared[key] = make(map[int64]bool)
+		}
+		s.shared[key][txId] = true
+	}
+	return nil
+}
+
+// holds reports whether txId holds key in mode or a stronger one. Caller must hold mu.
+func (s *lockStripe) holds(txId int64, key int, mode LockMode) bool {
+	if holder, ok := s.exclusive[key]; ok && holder == txId {
+		return true
+	}
+	return mode == LockShared && s.shared[key][txId]
+}
+
+// grantable reports whether no other transaction holds a lock on key that conflicts with mode. Caller must hold mu.
+func (s *lockStripe) grantable(txId int64, key int, mode LockMode) bool {
+	if holder, ok := s.exclusive[key]; ok && holder != txId {
+		return false
+	}
+	if mode == LockShared {
+		return true
+	}
+	for holder := range s.shared[key] {
+		if holder != txId {
+			return false
+		}
+	}
+	return true
+}
+
+// blockers returns the transactions other than txId that hold a lock on key conflicting with mode, in
+// ascending order. Caller must hold mu.
+func (s *lockStripe) blockers(txId int64, key int, mode LockMode) []int64 {
+	var holders []int64
+	if holder, ok := s.exclusive[key]; ok && holder != txId {
+		holders = append(holders, holder)
+	}
+	if mode == LockExclusive {
+		for holder := range s.shared[key] {
+			if holder != txId {
+				holders = append(holders, holder)
+			}
+		}
+	}
+	slices.Sort(holders)
+	return holders
+}
+
+// wait records that txId is about to wait for blockers, if deadlock detection is on, and returns the wait-for
+// cycle waiting would close, starting with txId and each transaction waiting for the next, or nil if it would
+// not deadlock. recorded reports whether detection is on, in which case the caller must call doneWaiting once
+// it stops waiting. A transaction's holders are recorded anew each time it wakes up and has to wait again, so
+// a cycle is found by whichever of its transactions is the last to start waiting.
+func (g *waitGraph) wait(txId int64, blockers []int64) (cycle []int64, recorded bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.detect {
+		return nil, false
+	}
+	visited := make(map[int64]bool)
+	var find func(path []int64, blockers []int64) []int64
+	find = func(path []int64, blockers []int64) []int64 {
+		for _, blocker := range blockers {
+			if blocker == txId {
+				return slices.Clone(path)
+			}
+			next, waiting := g.waitsFor[blocker]
+			if visited[blocker] || !waiting {
+				continue
+			}
+			visited[blocker] = true
+			if cycle := find(append(path, blocker), next); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	if cycle = find([]int64{txId}, blockers); cycle == nil {
+		g.waitsFor[txId] = blockers
+	}
+	return cycle, true
+}
+
+// doneWaiting records that txId is no longer waiting
+func (g *waitGraph) doneWaiting(txId int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.waitsFor, txId)
+}
+
+// SetDeadlockDetection turns deadlock detection on or off, as described for
+// BlockingLockManager.SetDeadlockDetection. A request already waiting when it is turned on is checked the
+// next time it wakes up.
+func (m *StripedLockManager) SetDeadlockDetection(enabled bool) {
+	m.graph.mu.Lock()
+	defer m.graph.mu.Unlock()
+	m.graph.detect = enabled
+}
+
+// ReleaseAll releases every lock txId holds, one stripe at a time. If it still has requests waiting it is
+// marked ended until they have all failed, so that a lock it is waiting for is never granted.
+func (m *StripedLockManager) ReleaseAll(txId int64) {
+	t := m.txn(txId)
+	t.mu.Lock()
+	keys := t.held[txId]
+	delete(t.held, txId)
+	waiting := t.waiting[txId] > 0
+	if waiting {
+		t.ended[txId] = true
+	}
+	t.mu.Unlock()
+
+	for _, key := range keys {
+		s := &m.stripes[m.stripeOf(key)]
+		s.mu.Lock()
+		if s.exclusive[key] == txId {
+			delete(s.exclusive, key)
+		}
+		delete(s.shared[key], txId)
+		if len(s.shared[key]) == 0 {
+			delete(s.shared, key)
+		}
+		s.released.Broadcast()
+		s.mu.Unlock()
+	}
+	if waiting {
+		// Wake txId's waiting requests, wherever they are, so that they see it has ended and give up
+		for i := range m.stripes {
+			s := &m.stripes[i]
+			s.mu.Lock()
+			s.released.Broadcast()
+			s.mu.Unlock()
+		}
+	}
+}
+
+// HoldsLock reports whether txId currently holds a lock on key, in either mode
+func (m *StripedLockManager) HoldsLock(txId int64, key int) bool {
+	s := &m.stripes[m.stripeOf(key)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.holds(txId, key, LockShared)
+}
+
+// LockWaitCount returns how many times txId had to wait for a lock held by another transaction
+func (m *StripedLockManager) LockWaitCount(txId int64) int {
+	t := m.txn(txId)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.waits[txId]
+}
+
+// Reset releases every lock and forgets every transaction. Transactions still waiting for a lock fail with
+// ErrTxnNotActive instead of being granted it under an id that may be reused.
+func (m *StripedLockManager) Reset() {
+	for i := range m.stripes {
+		m.stripes[i].mu.Lock()
+	}
+	for i := range m.txns {
+		m.txns[i].mu.Lock()
+	}
+	for i := range m.stripes {
+		s := &m.stripes[i]
+		s.generation++
+		s.exclusive, s.shared = make(map[int]int64), make(map[int]map[int64]bool)
+		s.released.Broadcast()
+	}
+	for i := range m.txns {
+		m.txns[i].reset()
+		m.txns[i].mu.Unlock()
+	}
+	m.graph.mu.Lock()
+	m.graph.waitsFor = make(map[int64][]int64)
+	m.graph.mu.Unlock()
+	for i := range m.stripes {
+		m.stripes[i].mu.Unlock()
+	}
+}
+
+// doneWaiting records that one of txId's requests stopped waiting, and forgets that txId ended once none
+// is left. Caller must hold mu.
+func (t *txnStripe) doneWaiting(txId int64) {
+	t.waiting[txId]--
+	if t.waiting[txId] == 0 {
+		delete(t.waiting, txId)
+		delete(t.ended, txId)
+	}
+}
+
+// reset forgets every transaction in the stripe. Caller must hold mu, if the stripe is in use.
+func (t *txnStripe) reset() {
+	t.held = make(map[int64][]int)
+	t.ended = make(map[int64]bool)
+	t.waiting = make(map[int64]int)
+	t.waits = make(map[int64]int)
+}
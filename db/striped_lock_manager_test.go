@@ -0,0 +1,209 @@
+package db
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStripedLockManagerModes(t *testing.T) {
+	lm := NewStripedLockManager(4)
+
+	assert.NoError(t, lm.Acquire(1, 1, LockShared))
+	assertGranted(t, acquireAsync(lm, 2, 1, LockShared)) // shared locks are compatible
+	assertGranted(t, acquireAsync(lm, 3, 2, LockExclusive))
+
+	exclusive := acquireAsync(lm, 3, 1, LockExclusive)
+	assertBlocked(t, exclusive)
+	lm.ReleaseAll(1)
+	assertBlocked(t, exclusive) // txn 2 still holds it shared
+	lm.ReleaseAll(2)
+	assertGranted(t, exclusive)
+	assert.True(t, lm.HoldsLock(3, 1))
+	assert.True(t, lm.HoldsLock(3, 2))
+
+	lm.ReleaseAll(3)
+	assert.False(t, lm.HoldsLock(3, 1))
+	assert.False(t, lm.HoldsLock(3, 2))
+}
+
+func TestStripedLockManagerUpgrade(t *testing.T) {
+	lm := NewStripedLockManager(4)
+
+	assert.NoError(t, lm.Acquire(1, 1, LockShared))
+	assert.NoError(t, lm.Acquire(1, 1, LockExclusive), "the only shared holder can upgrade without waiting")
+	assert.NoError(t, lm.Acquire(1, 1, LockShared), "an exclusive lock covers a shared request")
+
+	waiting := acquireAsync(lm, 2, 1, LockShared)
+	assertBlocked(t, waiting)
+	lm.ReleaseAll(1)
+	assertGranted(t, waiting)
+}
+
+func TestStripedLockManagerFailsWaiterThatEnds(t *testing.T) {
+	lm := NewStripedLockManager(4)
+	assert.NoError(t, lm.Acquire(1, 1, LockExclusive))
+
+	waiting := acquireAsync(lm, 2, 1, LockExclusive)
+	assertBlocked(t, waiting)
+	lm.ReleaseAll(2) // e.g. rolled back after timing out
+	select {
+	case err := <-waiting:
+		assert.ErrorIs(t, err, anomalytest.ErrTxnNotActive)
+	case <-time.After(time.Second):
+		t.Fatal("waiter should fail once its txn ends")
+	}
+	assert.False(t, lm.HoldsLock(2, 1))
+	for i := range lm.txns {
+		assert.Empty(t, lm.txns[i].ended, "an ended txn is forgotten once none of its requests is waiting")
+	}
+
+	waiting = acquireAsync(lm, 3, 1, LockExclusive)
+	assertBlocked(t, waiting)
+	lm.Reset()
+	select {
+	case err := <-waiting:
+		assert.ErrorIs(t, err, anomalytest.ErrTxnNotActive, "a reset fails waiters from before it")
+	case <-time.After(time.Second):
+		t.Fatal("waiter should fail once the manager is reset")
+	}
+	assert.NoError(t, lm.Acquire(2, 1, LockExclusive), "a reset forgets ended txns, whose ids may be reused")
+}
+
+func TestStripedLockManagerDeadlockDetection(t *testing.T) {
+	lm := NewStripedLockManager(4)
+	lm.SetDeadlockDetection(true)
+
+	// 1 -> 2 -> 3 -> 1 through three keys in different stripes
+	assert.NoError(t, lm.Acquire(1, 1, LockExclusive))
+	assert.NoError(t, lm.Acquire(2, 2, LockExclusive))
+	assert.NoError(t, lm.Acquire(3, 3, LockExclusive))
+	first := acquireAsync(lm, 1, 2, LockExclusive)
+	assertBlocked(t, first)
+	second := acquireAsync(lm, 2, 3, LockExclusive)
+	assertBlocked(t, second)
+
+	err := lm.Acquire(3, 1, LockExclusive)
+	var deadlock *anomalytest.DeadlockError
+	assert.ErrorAs(t, err, &deadlock)
+	assert.Equal(t, int64(3), deadlock.Victim)
+	assert.Equal(t, []int64{3, 1, 2}, deadlock.Cycle)
+	assertBlocked(t, second) // the victim keeps its locks until it ends
+
+	lm.ReleaseAll(3)
+	assertGranted(t, second)
+	lm.ReleaseAll(2)
+	assertGranted(t, first)
+	assert.Empty(t, lm.graph.waitsFor, "granted requests are no longer waiting")
+}
+
+func TestStripedLockManagerDeadlockOnUpgrade(t *testing.T) {
+	lm := NewStripedLockManager(4)
+	lm.SetDeadlockDetection(true)
+
+	assert.NoError(t, lm.Acquire(1, 1, LockShared))
+	assert.NoError(t, lm.Acquire(2, 1, LockShared))
+	upgrade := acquireAsync(lm, 1, 1, LockExclusive)
+	assertBlocked(t, upgrade)
+
+	err := lm.Acquire(2, 1, LockExclusive)
+	var deadlock *anomalytest.DeadlockError
+	assert.ErrorAs(t, err, &deadlock)
+	assert.Equal(t, []int64{2, 1}, deadlock.Cycle)
+	lm.ReleaseAll(2)
+	assertGranted(t, upgrade)
+}
+
+func TestSimpleDBReadUncommittedWriteLockWithStripedLocksDirtyWrite(t *testing.T) {
+	anomalytest.TestDirtyWrite(t, NewSimpleDBReadUncommittedWriteLockWith(NewStripedLockManager(16)))
+}
+
+func TestSimpleDBReadUncommittedWriteLockWithStripedLocksDirtyWriteG0(t *testing.T) {
+	anomalytest.TestDirtyWrite_G0(t, NewSimpleDBReadUncommittedWriteLockWith(NewStripedLockManager(16)))
+}
+
+// TestDatabase2PLWithStripedLocks runs the anomaly tests of Database2PL with a StripedLockManager in place of
+// its BlockingLockManager. The striped manager cannot lock ranges, so the phantom test is skipped.
+func TestDatabase2PLWithStripedLocks(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		test func(*testing.T, anomalytest.Database)
+	}{
+		{"DirtyWrite", anomalytest.TestDirtyWrite},
+		{"DirtyWriteG0", anomalytest.TestDirtyWrite_G0},
+		{"ForeignKeyViolation", anomalytest.TestForeignKeyViolation},
+		{"LostUpdateAtomicIncrement", anomalytest.TestLostUpdateAtomicIncrement},
+		{"NonRepeatableRead", anomalytest.TestNonRepeatableRead},
+		{"PhantomRead", anomalytest.TestPhantomRead_G2},
+		{"ReadSkew", anomalytest.TestReadSkew},
+		{"ConservedSum", anomalytest.TestConservedSum},
+		{"ReadYourOwnWrites", anomalytest.TestReadYourOwnWrites},
+		{"AntiDependencyCyclesG2Item", anomalytest.TestAntiDependencyCycles_G2Item},
+		{"WriteSkew", anomalytest.TestWriteSkew}, // deadlocks, so needs detection
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newDatabase2PLWithStripedLocks())
+		})
+	}
+}
+
+func TestDatabase2PLWithStripedLocksCannotLockScans(t *testing.T) {
+	db := newDatabase2PLWithStripedLocks()
+	assert.Zero(t, db.Capabilities()&anomalytest.CapScan)
+	txn, _ := db.BeginTx("")
+	_, err := db.Scan(txn, 1, 10)
+	assert.ErrorIs(t, err, errors.ErrUnsupported, "a scan that cannot lock its range must not run unlocked")
+
+	db.SetPhantomProtection(false)
+	assert.NotZero(t, db.Capabilities()&anomalytest.CapScan)
+	_, err = db.Scan(txn, 1, 10)
+	assert.NoError(t, err)
+}
+
+// newDatabase2PLWithStripedLocks creates a Database2PL over a StripedLockManager with deadlock detection on
+func newDatabase2PLWithStripedLocks() *Database2PL {
+	lm := NewStripedLockManager(16)
+	lm.SetDeadlockDetection(true)
+	return &Database2PL{SimpleDBReadUncommittedWriteLock: NewSimpleDBReadUncommittedWriteLockWith(lm)}
+}
+
+// BenchmarkLockManagers runs the single-mutex BlockingLockManager and StripedLockManager, both with deadlock
+// detection on as the write-lock database has it, on transactions from parallel goroutines that each lock
+// one key out of many and release it. The two are not equivalent: BlockingLockManager also keeps lock
+// timings, stats and grant history, which StripedLockManager does not, so the numbers measure that
+// bookkeeping as well as the striping. Compare them across -cpu 1,4,8 to see how each scales.
+func BenchmarkLockManagers(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		new  func() LockManager
+	}{
+		{"Blocking", func() LockManager {
+			lm := NewBlockingLockManager()
+			lm.SetDeadlockDetection(true)
+			return lm
+		}},
+		{"Striped16", func() LockManager {
+			lm := NewStripedLockManager(16)
+			lm.SetDeadlockDetection(true)
+			return lm
+		}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			lm := tc.new()
+			var nextTxnId atomic.Int64
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					txId := nextTxnId.Add(1)
+					if err := lm.Acquire(txId, int(txId%1024), LockExclusive); err != nil {
+						b.Error(err)
+					}
+					lm.ReleaseAll(txId)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package db
+
+import "github.com/makalaaneesh/lonely-transactions/anomalytest"
+
+// Database2PL is the write-lock database under strict two-phase locking: every read takes a shared row
+// lock and every write an exclusive one, and a transaction holds them all until it commits or rolls
+// back. Reads wait for keys another transaction has written, writes wait for keys others have read, and
+// a deadlock rolls back the transaction whose request would close it, so lost updates and write skew are
+// prevented. Scan also locks its whole key range, so an insert into the range waits for the scanner and
+// there are no phantoms, unless SetPhantomProtection turns that off. Lookups by value and whole-state
+// snapshots take no such range lock, so it does not report CapIndex or CapSnapshot. SetReadPolicy has no
+// effect on it.
+type Database2PL struct {
+	*SimpleDBReadUncommittedWriteLock
+	phantoms bool // whether Scan skips its range lock; see SetPhantomProtection. Guarded by mu.
+}
+
+func NewDatabase2PL() *Database2PL {
+	return &Database2PL{SimpleDBReadUncommittedWriteLock: NewSimpleDBReadUncommittedWriteLock()}
+}
+
+// Capabilities reports those of the write-lock database except CapIndex and CapSnapshot: GetByValue and
+// Snapshot lock only the keys that exist when they run, so a key another transaction inserts or changes
+// to the value looked up afterwards would appear if they ran again. CapScan is left out too if Scan is to
+// lock its range and the lock manager is not a RangeLocker, since Scan then fails.
+func (d *Database2PL) Capabilities() anomalytest.Capability {
+	caps := d.SimpleDBReadUncommittedWriteLock.Capabilities() &^ (anomalytest.CapIndex | anomalytest.CapSnapshot)
+	d.mu.RLock()
+	phantoms := d.phantoms
+	d.mu.RUnlock()
+	if _, ok := d.locks.(RangeLocker); !ok && !phantoms {
+		caps &^= anomalytest.CapScan
+	}
+	return caps
+}
+
+// BeginTx begins a transaction whose reads take shared locks. The isolation level is ignored.
+func (d *Database2PL) BeginTx(isolationLevel string) (int64, error) {
+	return d.beginWithPolicy(ReadBlocking), nil
+}
+
+// SetPhantomProtection sets whether Scan locks its whole key range, which it does by default. With it off,
+// Scan locks only the keys it finds, as any read does, so a key inserted into the range by another
+// transaction can appear in a later scan. Point reads and writes are not affected.
+func (d *Database2PL) SetPhantomProtection(enabled bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.phantoms = !enabled
+}
+
+// Scan takes a range lock on the keys from lo to hi, unless phantom protection is off, waiting for any
+// transaction that has written one of them, then scans them like any read under ReadBlocking. The range lock
+// is held until the transaction ends, so a key inserted into the range by another transaction waits for it
+// rather than appearing in a later scan.
+func (d *Database2PL) Scan(txId int64, lo, hi int) (map[int]int, error) {
+	d.mu.RLock()
+	phantoms := d.phantoms
+	d.mu.RUnlock()
+	if !phantoms {
+		if err := d.lockRange(txId, lo, hi); err != nil {
+			return nil, err
+		}
+	}
+	return d.SimpleDBReadUncommittedWriteLock.Scan(txId, lo, hi)
+}
@@ -0,0 +1,154 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/makalaaneesh/lonely-transactions/anomalytest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatabase2PLDirtyWriteG0(t *testing.T) {
+	anomalytest.TestDirtyWrite_G0(t, NewDatabase2PL())
+}
+
+func TestDatabase2PLSkipsUnlockedReads(t *testing.T) {
+	db := NewDatabase2PL()
+	exec := anomalytest.NewTxnsExecutor(db)
+
+	txn1 := exec.NewTxn("txn1")
+	txn1.BeginTx()
+	txn1.GetByValue(10)    // would not lock the keys it returns
+	txn1.Checkpoint("all") // nor the state it copies
+	txn1.Commit()
+
+	results := exec.Execute(true)
+	skipped := results.SkippedOps()
+	assert.Len(t, skipped, 2)
+	assert.Equal(t, anomalytest.CapIndex, skipped[0].Missing)
+	assert.Equal(t, anomalytest.CapSnapshot, skipped[1].Missing)
+}
+
+func TestDatabase2PLAntiDependencyCyclesG2Item(t *testing.T) {
+	anomalytest.TestAntiDependencyCycles_G2Item(t, NewDatabase2PL())
+}
+
+func TestDatabase2PLLostUpdateAtomicIncrement(t *testing.T) {
+	anomalytest.TestLostUpdateAtomicIncrement(t, NewDatabase2PL())
+}
+
+func TestDatabase2PLConservedSum(t *testing.T) {
+	anomalytest.TestConservedSum(t, NewDatabase2PL())
+}
+
+func TestDatabase2PLNonRepeatableRead(t *testing.T) {
+	anomalytest.TestNonRepeatableRead(t, NewDatabase2PL())
+}
+
+func TestDatabase2PLPhantomRead(t *testing.T) {
+	anomalytest.TestPhantomRead_G2(t, NewDatabase2PL())
+}
+
+func TestDatabase2PLPhantomProtection(t *testing.T) {
+	for _, protected := range []bool{true, false} {
+		t.Run(fmt.Sprintf("protected=%t", protected), func(t *testing.T) {
+			db := NewDatabase2PL()
+			db.SetPhantomProtection(protected)
+			assert.Equal(t, !protected, anomalytest.DetectPhantom(db))
+		})
+	}
+}
+
+func TestDatabase2PLReadYourOwnWrites(t *testing.T) {
+	anomalytest.TestReadYourOwnWrites(t, NewDatabase2PL())
+}
+
+func TestDatabase2PLReadsAndWritesBlockEachOther(t *testing.T) {
+	db := NewDatabase2PL()
+	reader, _ := db.BeginTx("SERIALIZABLE")
+	writer, _ := db.BeginTx("SERIALIZABLE")
+	db.Get(reader, 1)
+
+	write := make(chan error, 1)
+	go func() { write <- db.Set(writer, 1, 10) }()
+	assertBlocked(t, write) // the reader's shared lock
+	db.Commit(reader)
+	assertGranted(t, write)
+
+	other, _ := db.BeginTx("SERIALIZABLE")
+	read := make(chan error, 1)
+	go func() {
+		_, err := db.Get(other, 1)
+		read <- err
+	}()
+	assertBlocked(t, read) // the writer's exclusive lock
+	db.Commit(writer)
+	assertGranted(t, read)
+	value, _ := db.Get(other, 1)
+	assert.Equal(t, 10, value)
+}
+
+func TestDatabase2PLDeadlockVictimIsUndoneBeforeWakingReaders(t *testing.T) {
+	lm := NewBlockingLockManager()
+	lm.SetDeadlockDetection(true)
+	db := &Database2PL{SimpleDBReadUncommittedWriteLock: NewSimpleDBReadUncommittedWriteLockWith(slowReleaseLockManager{lm})}
+	setup, _ := db.BeginTx("SERIALIZABLE")
+	db.Set(setup, 2, 20)
+	db.Commit(setup)
+
+	survivor, _ := db.BeginTx("SERIALIZABLE")
+	victim, _ := db.BeginTx("SERIALIZABLE")
+	reader, _ := db.BeginTx("SERIALIZABLE")
+	assert.NoError(t, db.Set(survivor, 1, 10))
+	assert.NoError(t, db.Set(victim, 2, 200))
+	assert.NoError(t, db.Set(victim, 3, 300))
+	read := make(chan int, 1)
+	go func() {
+		value, _ := db.Get(reader, 2)
+		read <- value
+	}()
+	write := make(chan error, 1)
+	go func() { write <- db.Set(survivor, 3, 30) }()
+	assertBlocked(t, write)
+
+	err := db.Set(victim, 1, 100) // closes the cycle, so the victim is rolled back
+	var deadlock *anomalytest.DeadlockError
+	if assert.ErrorAs(t, err, &deadlock) {
+		assert.Equal(t, victim, deadlock.Victim)
+	}
+	assert.Equal(t, 20, <-read, "the reader must not see the victim's write")
+	assertGranted(t, write)
+	assert.NoError(t, db.Commit(survivor))
+	assert.NoError(t, db.Commit(reader))
+	assert.Equal(t, map[int]int{1: 10, 2: 20, 3: 30}, db.State())
+}
+
+func TestDatabase2PLWriteSkew(t *testing.T) {
+	anomalytest.TestWriteSkew(t, NewDatabase2PL())
+}
+
+func TestDatabase2PLLostUpdateRetriesDeadlock(t *testing.T) {
+	db := NewDatabase2PL()
+	db.SetFIFOLocks(true) // so that the rerun queues behind the waiting upgrade instead of sharing the lock again
+	exec := anomalytest.NewTxnsExecutor(db)
+	// Both read the counter under a shared lock, then both try to upgrade it to increment: one of them
+	// deadlocks, is rolled back and runs again once the other has committed
+	for _, names := range [][2]string{{"txn1", "txn2"}, {"txn2", "txn1"}} {
+		txn := exec.NewTxn(names[0])
+		txn.WithRetry(1)
+		txn.BeginTx()
+		txn.Get(1)
+		txn.Barrier(names[0] + "_read")
+		txn.WaitFor(names[1] + "_read")
+		txn.Increment(1, 1)
+		txn.Commit()
+	}
+
+	results := exec.Execute(false)
+
+	assert.True(t, results.HadDeadlock())
+	assert.Equal(t, 1, results.Retries("txn1")+results.Retries("txn2"))
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("txn1"))
+	assert.Equal(t, anomalytest.OutcomeCommitted, results.Outcome("txn2"))
+	assert.Equal(t, map[int]int{1: 2}, db.State())
+}
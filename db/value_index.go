@@ -0,0 +1,30 @@
+package db
+
+import "sort"
+
+// valueIndex is a secondary index from a value to the set of keys currently holding it
+type valueIndex map[int]map[int]bool
+
+func (idx valueIndex) add(value int, key int) {
+	if idx[value] == nil {
+		idx[value] = make(map[int]bool)
+	}
+	idx[value][key] = true
+}
+
+func (idx valueIndex) remove(value int, key int) {
+	delete(idx[value], key)
+	if len(idx[value]) == 0 {
+		delete(idx, value)
+	}
+}
+
+// keys returns the keys holding value, in ascending order
+func (idx valueIndex) keys(value int) []int {
+	keys := make([]int, 0, len(idx[value]))
+	for key := range idx[value] {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+	return keys
+}